@@ -2,11 +2,20 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
+	"github.com/coldog/rds-operator/pkg/config"
+	"github.com/coldog/rds-operator/pkg/cost"
+	"github.com/coldog/rds-operator/pkg/leader"
 	"github.com/coldog/rds-operator/pkg/rds"
 	"github.com/coldog/rds-operator/version"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
@@ -15,7 +24,6 @@ import (
 )
 
 func printVersion() {
-	log.SetLevel(log.DebugLevel)
 	log.WithFields(log.Fields{
 		"goVersion":  runtime.Version(),
 		"goOs":       runtime.GOOS,
@@ -25,24 +33,98 @@ func printVersion() {
 	}).Info("starting")
 }
 
+// loadPricing loads the pricing table, a missing table disables the cost
+// estimates.
+func loadPricing(path string) *cost.Table {
+	if path == "" {
+		return nil
+	}
+	table, err := cost.Load(path)
+	if os.IsNotExist(err) {
+		log.WithField("path", path).Warn("pricing table not found, cost estimates are disabled")
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).Fatal("failed pricing table")
+	}
+	log.WithField("version", table.Version).Info("loaded pricing table")
+	return table
+}
+
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		log.WithField("signal", s).Info("shutting down")
+		cancel()
+	}()
+	return ctx
+}
+
+func runWithLeaderElection(ctx context.Context, c config.LeaderElection, run func(context.Context)) {
+	operatorName, err := k8sutil.GetOperatorName()
+	if err != nil {
+		log.WithError(err).Fatal("failed operator name")
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		log.WithError(err).Fatal("failed hostname")
+	}
+
+	cfg := leader.Config{
+		Namespace:     c.Namespace,
+		Name:          operatorName + "-lock",
+		Identity:      identity,
+		LeaseDuration: c.LeaseDuration.Duration,
+		RenewDeadline: c.RenewDeadline.Duration,
+		RetryPeriod:   c.RetryPeriod.Duration,
+	}
+	lock := leader.NewConfigMapLock(k8sclient.GetKubeClient().CoreV1(), cfg.Namespace, cfg.Name)
+	elector, err := leader.NewElector(cfg, lock)
+	if err != nil {
+		log.WithError(err).Fatal("failed leader election config")
+	}
+
+	if err := elector.Run(ctx, run); err != nil && err != context.Canceled {
+		log.WithError(err).Fatal("leader election stopped")
+	}
+}
+
+// reloadInterval is the time between checks of the config file.
+const reloadInterval = 10 * time.Second
+
 func main() {
+	args := os.Args[1:]
+	c, err := config.Load(args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Fatal("failed config")
+	}
+	c.Log.Setup()
 	printVersion()
 
 	sdk.ExposeMetricsPort()
 
-	handler, err := rds.NewHandler()
+	pricing := loadPricing(c.PricingFile)
+	cfg, err := c.Handler()
 	if err != nil {
-		log.WithError(err).Fatal("failed init handler")
+		log.WithError(err).Fatal("failed config")
 	}
+	cfg.Pricing = pricing
 
-	resource := "rds.aws.com/v1alpha1"
-	kind := "Database"
-	namespace, err := k8sutil.GetWatchNamespace()
+	handler, err := rds.NewHandler(cfg)
 	if err != nil {
-		log.WithError(err).Fatal("failed watch namespace")
+		log.WithError(err).Fatal("failed init handler")
 	}
-	resyncPeriod := time.Duration(5) * time.Second
 
+	resource := "rds.aws.com/v1alpha1"
+	kind := "Database"
+	namespace := c.WatchNamespace
+	resyncPeriod := c.Reconciler.ResyncPeriod.Duration
 	log.WithFields(log.Fields{
 		"resource":     resource,
 		"kind":         kind,
@@ -51,6 +133,52 @@ func main() {
 	}).Info("watching")
 
 	sdk.Watch(resource, kind, namespace, resyncPeriod)
-	sdk.Handle(handler)
-	sdk.Run(context.Background())
+	// Claims are only watched when enabled at start, enabling them while
+	// running takes effect on restart.
+	if cfg.Enabled(rds.FeatureClaims) {
+		sdk.Watch(resource, "DatabaseClaim", namespace, resyncPeriod)
+		// Instances are cluster-scoped.
+		sdk.Watch(resource, "DatabaseInstance", "", resyncPeriod)
+	}
+	reconciler := rds.NewReconciler(handler, c.ReconcilerConfig())
+	sdk.Handle(reconciler)
+
+	sweeper := rds.NewSweeper(handler, c.SweeperConfig())
+	run := func(ctx context.Context) {
+		if c.Orphans.SweepInterval.Duration > 0 {
+			go sweeper.Run(ctx)
+		}
+		go handler.RunCache(ctx)
+		go reconciler.Run(ctx)
+		sdk.Run(ctx)
+	}
+
+	ctx := signalContext()
+	// Every replica serves the webhook, not only the leader.
+	if c.Webhook.Port > 0 {
+		webhook := rds.NewWebhook(reconciler)
+		go func() {
+			addr := fmt.Sprintf(":%d", c.Webhook.Port)
+			if err := webhook.Run(ctx, addr, c.Webhook.CertFile, c.Webhook.KeyFile); err != nil {
+				log.WithError(err).Fatal("failed serving admission webhook")
+			}
+		}()
+	}
+	go config.Watch(ctx, args, c, reloadInterval, func(next *config.Config) {
+		next.Log.Setup()
+		cfg, err := next.Handler()
+		if err != nil {
+			log.WithError(err).Error("failed reloading config")
+			return
+		}
+		cfg.Pricing = pricing
+		// The sweeper keeps its config, Reload reports its fields as
+		// taking effect on restart.
+		reconciler.Reconfigure(cfg, next.ReconcilerConfig())
+	})
+	if !c.LeaderElection.Enabled {
+		run(ctx)
+		return
+	}
+	runWithLeaderElection(ctx, c.LeaderElection, run)
 }
@@ -30,6 +30,14 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Database{},
 		&DatabaseList{},
+		&DatabaseClass{},
+		&DatabaseClassList{},
+		&DatabaseClaim{},
+		&DatabaseClaimList{},
+		&DatabaseInstance{},
+		&DatabaseInstanceList{},
+		&DatabasePolicy{},
+		&DatabasePolicyList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
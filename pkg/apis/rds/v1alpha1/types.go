@@ -3,8 +3,12 @@ package v1alpha1
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"reflect"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // State represents the state.
@@ -12,6 +16,119 @@ const (
 	StatePending = "Pending"
 	StateCreated = "Created"
 	StateFailure = "Failure"
+	StatePlanned = "Planned"
+)
+
+// AnnotationIgnoreFreeze set to "true" marks changes to a database as urgent,
+// they are applied during change freezes.
+const AnnotationIgnoreFreeze = "rds.aws.com/ignore-freeze"
+
+// AnnotationPlanOnly marks a database to only plan AWS changes when set to
+// "true", the planned calls are written to the status instead of executed.
+const AnnotationPlanOnly = "rds.aws.com/plan-only"
+
+// AnnotationProtected set to "true" keeps the database from being deleted,
+// the protection finalizer holds the deletion until the annotation is
+// removed.
+const AnnotationProtected = "rds.aws.com/protected"
+
+// AnnotationAction requests a one off action on the instance, one of the
+// Action values. The annotation is removed once the action ran.
+const AnnotationAction = "rds.aws.com/action"
+
+// Actions requested with AnnotationAction.
+const (
+	ActionReboot                  = "reboot"
+	ActionFailover                = "failover"
+	ActionApplyPendingMaintenance = "apply-pending-maintenance"
+)
+
+// Results of an action.
+const (
+	ActionResultSucceeded = "Succeeded"
+	ActionResultFailed    = "Failed"
+)
+
+// FinalizerProtection is held on databases annotated as protected.
+const FinalizerProtection = "rds.aws.com/protection"
+
+// ConditionDeletionBlocked is true while the deletion of a protected
+// database is held back.
+const ConditionDeletionBlocked = "DeletionBlocked"
+
+// ConditionStopped is true while the instance is stopped by its schedule.
+const ConditionStopped = "Stopped"
+
+// Drift policies decide how changes made to an instance outside the operator
+// are handled.
+const (
+	DriftPolicyRevert = "Revert"
+	DriftPolicyReport = "Report"
+	DriftPolicyIgnore = "Ignore"
+)
+
+// Deletion policies decide what happens to the instance when its Database
+// is deleted.
+const (
+	DeletionPolicySnapshot = "Snapshot"
+	DeletionPolicyDelete   = "Delete"
+	DeletionPolicyRetain   = "Retain"
+)
+
+// ConditionDrifted is true while the instance differs from the spec.
+const ConditionDrifted = "Drifted"
+
+// Upgrade phases of a major or minor engine version upgrade.
+const (
+	UpgradePhaseSnapshotting = "Snapshotting"
+	UpgradePhaseUpgrading    = "Upgrading"
+	UpgradePhaseCompleted    = "Completed"
+	UpgradePhaseFailed       = "Failed"
+)
+
+// AnnotationConfirmEncryption set to "true" confirms clients use the
+// encrypted instance, the unencrypted instance is then deleted.
+const AnnotationConfirmEncryption = "rds.aws.com/confirm-encryption"
+
+// Encryption phases of the migration of an unencrypted instance.
+const (
+	EncryptionPhaseSnapshotting         = "Snapshotting"
+	EncryptionPhaseCopying              = "Copying"
+	EncryptionPhaseRestoring            = "Restoring"
+	EncryptionPhaseAwaitingConfirmation = "AwaitingConfirmation"
+	EncryptionPhaseRetiring             = "Retiring"
+	EncryptionPhaseRenaming             = "Renaming"
+	EncryptionPhaseCompleted            = "Completed"
+	EncryptionPhaseFailed               = "Failed"
+)
+
+// Replacement strategies for spec changes RDS cannot make in place.
+const (
+	// ReplacementStrategyNone only reports the required replacement.
+	ReplacementStrategyNone = "None"
+	// ReplacementStrategyBlueGreen provisions a new instance, switches the
+	// secret to it and deletes the old instance after a bake period.
+	ReplacementStrategyBlueGreen = "BlueGreen"
+)
+
+// Replacement phases of an instance replacement.
+const (
+	ReplacementPhaseRequired     = "Required"
+	ReplacementPhaseSnapshotting = "Snapshotting"
+	ReplacementPhaseProvisioning = "Provisioning"
+	ReplacementPhasePromoting    = "Promoting"
+	ReplacementPhaseBaking       = "Baking"
+	ReplacementPhaseRetiring     = "Retiring"
+	ReplacementPhaseRenaming     = "Renaming"
+	ReplacementPhaseCompleted    = "Completed"
+	ReplacementPhaseFailed       = "Failed"
+)
+
+// Replacement methods, the new instance is restored from a snapshot or
+// promoted from a read replica.
+const (
+	ReplacementMethodSnapshot = "Snapshot"
+	ReplacementMethodReplica  = "Replica"
 )
 
 // DatabaseList lists the database.
@@ -31,8 +148,189 @@ type Database struct {
 	Status            DatabaseStatus `json:"status,omitempty"`
 }
 
+// AnnotationDefaultClass set to "true" on a DatabaseClass makes it the class
+// of databases without spec.className.
+const AnnotationDefaultClass = "rds.aws.com/is-default-class"
+
+// DatabaseClassList lists the database classes.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DatabaseClass `json:"items"`
+}
+
+// DatabaseClass is a cluster-scoped preset of database spec fields, like a
+// StorageClass. Databases take the fields they leave empty from their class
+// when they are created.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DatabaseSpec `json:"spec"`
+	// ReclaimPolicy of the instances provisioned for claims of the class,
+	// defaults to Delete.
+	ReclaimPolicy string `json:"reclaimPolicy,omitempty"`
+}
+
+// DatabasePolicyList lists the database policies.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabasePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DatabasePolicy `json:"items"`
+}
+
+// DatabasePolicy is a cluster-scoped quota and policy for the databases of
+// the namespaces it selects. Databases violating it are not created.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabasePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DatabasePolicySpec `json:"spec"`
+}
+
+// DatabasePolicySpec lists the limits, zero values do not limit.
+type DatabasePolicySpec struct {
+	// NamespaceSelector selects the namespaces by their labels, empty
+	// selects all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// MaxInstances is the number of databases per namespace.
+	MaxInstances int64 `json:"maxInstances,omitempty"`
+	// MaxStorage is the total storage in GiB per namespace.
+	MaxStorage int64 `json:"maxStorage,omitempty"`
+	// InstanceClasses lists the allowed instance classes, shell patterns
+	// like db.t2.* match a family.
+	InstanceClasses []string `json:"instanceClasses,omitempty"`
+	// Engines lists the allowed engines.
+	Engines []string `json:"engines,omitempty"`
+	// RequireEncryption requires encrypted databases.
+	RequireEncryption bool `json:"requireEncryption,omitempty"`
+	// RequireMultiAZ requires Multi-AZ databases.
+	RequireMultiAZ bool `json:"requireMultiAz,omitempty"`
+}
+
+// Reclaim policies decide what happens to a DatabaseInstance once its claim
+// is deleted.
+const (
+	// ReclaimDelete deletes the instance and its RDS instance.
+	ReclaimDelete = "Delete"
+	// ReclaimRetain keeps the instance released until an administrator
+	// removes its claimRef.
+	ReclaimRetain = "Retain"
+	// ReclaimRecycle replaces the RDS instance with an empty one and makes
+	// the instance available to new claims.
+	ReclaimRecycle = "Recycle"
+)
+
+// Phases of a DatabaseClaim.
+const (
+	ClaimPhasePending = "Pending"
+	ClaimPhaseBound   = "Bound"
+	// ClaimPhaseLost is set when the bound instance is deleted.
+	ClaimPhaseLost = "Lost"
+)
+
+// Phases of a DatabaseInstance.
+const (
+	InstancePhaseAvailable = "Available"
+	InstancePhaseBound     = "Bound"
+	InstancePhaseReleased  = "Released"
+	InstancePhaseRecycling = "Recycling"
+	InstancePhaseFailed    = "Failed"
+)
+
+// DatabaseClaimList lists the database claims.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DatabaseClaim `json:"items"`
+}
+
+// DatabaseClaim requests a database for a namespace, like a
+// PersistentVolumeClaim. The claim is bound to an available DatabaseInstance
+// or to one provisioned from its class, the credentials are written to the
+// <name>-db-credentials secret of the claim.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DatabaseClaimSpec   `json:"spec"`
+	Status            DatabaseClaimStatus `json:"status,omitempty"`
+}
+
+// DatabaseClaimSpec describes the requested database.
+type DatabaseClaimSpec struct {
+	// ClassName is the class of the instance, empty uses the default class.
+	ClassName string `json:"className,omitempty"`
+	// Engine is the requested engine, empty matches any.
+	Engine string `json:"engine,omitempty"`
+	// Storage is the minimum storage in GiB.
+	Storage int64 `json:"storage,omitempty"`
+	// InstanceName binds the claim to this instance only.
+	InstanceName string `json:"instanceName,omitempty"`
+}
+
+// DatabaseClaimStatus reports the binding of a claim.
+type DatabaseClaimStatus struct {
+	Phase string `json:"phase,omitempty"`
+	// InstanceName is the bound instance.
+	InstanceName string `json:"instanceName,omitempty"`
+	// Secret holds the credentials once the instance is created.
+	Secret  string `json:"secret,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// DatabaseInstanceList lists the database instances.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseInstanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DatabaseInstance `json:"items"`
+}
+
+// DatabaseInstance is a cluster-scoped RDS instance claims are bound to,
+// like a PersistentVolume. Instances are created by administrators or
+// provisioned for claims, the RDS instance is managed through a Database of
+// the same name in the operator's instance namespace.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DatabaseInstanceSpec   `json:"spec"`
+	Status            DatabaseInstanceStatus `json:"status,omitempty"`
+}
+
+// DatabaseInstanceSpec configures the instance.
+type DatabaseInstanceSpec struct {
+	// Database configures the RDS instance.
+	Database DatabaseSpec `json:"database"`
+	// ClaimRef is the claim the instance is bound to.
+	ClaimRef *ClaimReference `json:"claimRef,omitempty"`
+	// ReclaimPolicy is Delete, Retain or Recycle, defaults to Retain.
+	ReclaimPolicy string `json:"reclaimPolicy,omitempty"`
+}
+
+// ClaimReference identifies a DatabaseClaim.
+type ClaimReference struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+}
+
+// DatabaseInstanceStatus reports the phase of an instance.
+type DatabaseInstanceStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
 // DatabaseSpec configures the RDS database.
 type DatabaseSpec struct {
+	// ClassName is the DatabaseClass filling in the fields left empty,
+	// empty uses the default class if there is one.
+	ClassName string `json:"className,omitempty"`
+
 	Engine                  string   `json:"engine"`
 	EngineVersion           string   `json:"engineVersion"`
 	Username                string   `json:"username"`
@@ -50,6 +348,154 @@ type DatabaseSpec struct {
 	Encrypted               bool     `json:"encrypted"`
 	StorageType             string   `json:"storageType"`
 	SecurityGroups          []string `json:"securityGroups"`
+	// DeletionProtection enables RDS deletion protection, the instance is
+	// kept when the database is deleted.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+	// KmsKeyID is the KMS key encrypting the storage, empty uses the
+	// account's default RDS key. Requires encrypted.
+	KmsKeyID string `json:"kmsKeyId,omitempty"`
+	// Tags are added to the RDS instance, ownership tags set by the operator
+	// take precedence.
+	Tags map[string]string `json:"tags"`
+	// PreferredBackupWindow is the daily UTC backup window, hh24:mi-hh24:mi.
+	PreferredBackupWindow string `json:"preferredBackupWindow,omitempty"`
+	// PreferredMaintenanceWindow is the weekly UTC maintenance window,
+	// ddd:hh24:mi-ddd:hh24:mi. It may not overlap the backup window.
+	PreferredMaintenanceWindow string `json:"preferredMaintenanceWindow,omitempty"`
+	// StorageAutoscaling grows storage as it fills up.
+	StorageAutoscaling *StorageAutoscaling `json:"storageAutoscaling,omitempty"`
+	// Monitoring configures Performance Insights, Enhanced Monitoring and
+	// log exports.
+	Monitoring *Monitoring `json:"monitoring,omitempty"`
+	// DisasterRecovery copies snapshots to other regions.
+	DisasterRecovery *DisasterRecovery `json:"disasterRecovery,omitempty"`
+	// Schedule stops the instance outside its active hours.
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// Replacement configures how changes that need a new instance are made.
+	Replacement *Replacement `json:"replacement,omitempty"`
+	// DriftPolicy is one of Revert, Report or Ignore, empty uses the
+	// operator default.
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+	// DeletionPolicy is one of Snapshot, Delete or Retain, empty uses the
+	// operator default.
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+}
+
+// Storage autoscaling modes.
+const (
+	// StorageAutoscalingNative maps to RDS MaxAllocatedStorage.
+	StorageAutoscalingNative = "Native"
+	// StorageAutoscalingOperator grows storage from the operator based on
+	// the free storage metric.
+	StorageAutoscalingOperator = "Operator"
+)
+
+// StorageAutoscaling configures storage growth.
+type StorageAutoscaling struct {
+	// MaxAllocatedStorage is the size in GiB storage is never grown beyond.
+	MaxAllocatedStorage int64 `json:"maxAllocatedStorage"`
+	// Mode is Native or Operator, defaults to Operator. Native hands growth
+	// to RDS storage autoscaling, thresholdPercent and step are not used.
+	Mode string `json:"mode,omitempty"`
+	// ThresholdPercent of free storage below which storage is grown,
+	// defaults to 10.
+	ThresholdPercent int64 `json:"thresholdPercent,omitempty"`
+	// Step is the GiB added per growth, defaults to 10. RDS requires each
+	// growth to be at least 10% of the allocated storage, smaller steps are
+	// rounded up.
+	Step int64 `json:"step,omitempty"`
+}
+
+// Monitoring configures the RDS observability settings.
+type Monitoring struct {
+	// PerformanceInsights enables Performance Insights.
+	PerformanceInsights bool `json:"performanceInsights,omitempty"`
+	// PerformanceInsightsRetentionPeriod is 7 or 731 days, defaults to 7.
+	PerformanceInsightsRetentionPeriod int64 `json:"performanceInsightsRetentionPeriod,omitempty"`
+	// PerformanceInsightsKMSKeyID encrypts the Performance Insights data. It
+	// is only used when Performance Insights is enabled and cannot be changed
+	// afterwards.
+	PerformanceInsightsKMSKeyID string `json:"performanceInsightsKmsKeyId,omitempty"`
+	// MonitoringInterval is the Enhanced Monitoring interval in seconds, one
+	// of 1, 5, 10, 15, 30 or 60. 0 disables Enhanced Monitoring.
+	MonitoringInterval int64 `json:"monitoringInterval,omitempty"`
+	// MonitoringRoleArn is the IAM role RDS publishes Enhanced Monitoring
+	// metrics with, required with a monitoring interval.
+	MonitoringRoleArn string `json:"monitoringRoleArn,omitempty"`
+	// EnableCloudwatchLogsExports lists the logs exported to CloudWatch Logs:
+	// postgresql and upgrade for postgres, error, general, slowquery and
+	// audit for mysql and mariadb.
+	EnableCloudwatchLogsExports []string `json:"enableCloudwatchLogsExports,omitempty"`
+}
+
+// DisasterRecovery configures cross-region snapshot copies.
+type DisasterRecovery struct {
+	// Regions the latest snapshot is copied to.
+	Regions []DisasterRecoveryRegion `json:"regions"`
+	// Retention is the number of copies kept in each region, defaults to 3.
+	Retention int64 `json:"retention,omitempty"`
+}
+
+// DisasterRecoveryRegion is a region snapshots are copied to.
+type DisasterRecoveryRegion struct {
+	Region string `json:"region"`
+	// KmsKeyID re-encrypts the copies in the region, KMS keys are regional so
+	// it is required for encrypted databases.
+	KmsKeyID string `json:"kmsKeyId,omitempty"`
+}
+
+// Schedule configures when the instance runs.
+type Schedule struct {
+	// ActiveHours is a cron expression, minute hour day-of-month month
+	// day-of-week, matching the minutes the instance runs, e.g.
+	// "* 8-19 * * mon-fri". Empty runs the instance all the time.
+	ActiveHours string `json:"activeHours,omitempty"`
+	// Timezone is the IANA time zone of the active hours, defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Stopped keeps the instance stopped regardless of the active hours.
+	Stopped bool `json:"stopped,omitempty"`
+}
+
+// Replacement configures instance replacements.
+type Replacement struct {
+	// Strategy is None or BlueGreen, defaults to None.
+	Strategy string `json:"strategy,omitempty"`
+	// BakePeriod is how long the old instance is kept after the secret is
+	// switched to the new one, defaults to 24h.
+	BakePeriod *metav1.Duration `json:"bakePeriod,omitempty"`
+}
+
+// ApplyClass fills the spec fields the database leaves empty from the class
+// and sets spec.className. Tags are merged, the database's tags take
+// precedence. As booleans cannot be told apart from unset ones a class
+// enabling, e.g., multiAz enables it on all its databases.
+func ApplyClass(db *Database, class *DatabaseClass) {
+	spec := reflect.ValueOf(&db.Spec).Elem()
+	defaults := reflect.ValueOf(class.Spec.DeepCopy()).Elem()
+	for i := 0; i < spec.NumField(); i++ {
+		if empty(spec.Field(i)) {
+			spec.Field(i).Set(defaults.Field(i))
+		}
+	}
+	if len(class.Spec.Tags) > 0 {
+		tags := map[string]string{}
+		for k, v := range class.Spec.Tags {
+			tags[k] = v
+		}
+		for k, v := range db.Spec.Tags {
+			tags[k] = v
+		}
+		db.Spec.Tags = tags
+	}
+	db.Spec.ClassName = class.Name
+}
+
+func empty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
 }
 
 // Defaults will set default configuration.
@@ -81,11 +527,194 @@ func Defaults(db *Database) {
 	if s.Storage == 0 {
 		s.Storage = 20
 	}
+	if a := s.StorageAutoscaling; a != nil {
+		a = a.DeepCopy()
+		if a.Mode == "" {
+			a.Mode = StorageAutoscalingOperator
+		}
+		if a.ThresholdPercent == 0 {
+			a.ThresholdPercent = 10
+		}
+		if a.Step == 0 {
+			a.Step = 10
+		}
+		s.StorageAutoscaling = a
+	}
+	if d := s.DisasterRecovery; d != nil && d.Retention == 0 {
+		d = d.DeepCopy()
+		d.Retention = 3
+		s.DisasterRecovery = d
+	}
+	if m := s.Monitoring; m != nil && m.PerformanceInsights && m.PerformanceInsightsRetentionPeriod == 0 {
+		m = m.DeepCopy()
+		m.PerformanceInsightsRetentionPeriod = 7
+		s.Monitoring = m
+	}
+	if r := s.Replacement; r != nil && (r.Strategy == "" || r.BakePeriod == nil) {
+		r = r.DeepCopy()
+		if r.Strategy == "" {
+			r.Strategy = ReplacementStrategyNone
+		}
+		if r.BakePeriod == nil {
+			r.BakePeriod = &metav1.Duration{Duration: 24 * time.Hour}
+		}
+		s.Replacement = r
+	}
 	db.Spec = s
 }
 
 // DatabaseStatus holds state and error structs.
 type DatabaseStatus struct {
-	State string `json:"state"`
-	Error string `json:"error"`
+	State string          `json:"state"`
+	Error string          `json:"error"`
+	Plan  []PlannedAction `json:"plan,omitempty"`
+	// InstanceIdentifier is the RDS instance identifier, chosen when the
+	// database is first created and kept when the naming template changes.
+	InstanceIdentifier string `json:"instanceIdentifier,omitempty"`
+	// Tags are the RDS tags last applied by the operator.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Drift lists the fields found to differ from the spec by the last audit.
+	Drift      []FieldDrift        `json:"drift,omitempty"`
+	Conditions []DatabaseCondition `json:"conditions,omitempty"`
+	// EngineVersion is the engine version last observed on the instance.
+	EngineVersion string `json:"engineVersion,omitempty"`
+	// Upgrade tracks the last engine version upgrade.
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+	// DeletionProtection is the deletion protection last applied.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+	// MaxAllocatedStorage is the limit of native storage autoscaling last
+	// applied, 0 when it is off.
+	MaxAllocatedStorage int64 `json:"maxAllocatedStorage,omitempty"`
+	// StorageEncrypted is true once the instance is observed to be
+	// encrypted.
+	StorageEncrypted bool `json:"storageEncrypted,omitempty"`
+	// Encryption tracks the migration of an unencrypted instance.
+	Encryption *EncryptionStatus `json:"encryption,omitempty"`
+	// Replacement tracks the last replacement of the instance.
+	Replacement *ReplacementStatus `json:"replacement,omitempty"`
+	// Monitoring is the monitoring configuration last applied.
+	Monitoring *Monitoring `json:"monitoring,omitempty"`
+	// DisasterRecovery reports the recovery point in each region.
+	DisasterRecovery []RecoveryPoint `json:"disasterRecovery,omitempty"`
+	// StorageGrowth lists the most recent storage growths.
+	StorageGrowth []StorageGrowth `json:"storageGrowth,omitempty"`
+	// Deferred lists modifications held back by a change freeze.
+	Deferred []DeferredAction `json:"deferred,omitempty"`
+	// LastAction is the last action requested with the action annotation.
+	LastAction *ActionStatus `json:"lastAction,omitempty"`
+	// EstimatedMonthlyCost is the approximate monthly cost of the instance
+	// in the currency of the pricing table, like "152.64 USD", empty when
+	// the pricing table has no prices for it.
+	EstimatedMonthlyCost string `json:"estimatedMonthlyCost,omitempty"`
+	// PricingVersion is the version of the pricing table of the estimate.
+	PricingVersion string `json:"pricingVersion,omitempty"`
+}
+
+// ActionStatus records an action requested with the action annotation.
+type ActionStatus struct {
+	Action  string      `json:"action"`
+	Time    metav1.Time `json:"time"`
+	Result  string      `json:"result"`
+	Message string      `json:"message,omitempty"`
+}
+
+// RecoveryPoint is the latest snapshot copy available in a region.
+type RecoveryPoint struct {
+	Region string `json:"region"`
+	// Snapshot is the latest available copy and Time when the copied
+	// snapshot was taken, empty until the first copy completes.
+	Snapshot string       `json:"snapshot,omitempty"`
+	Time     *metav1.Time `json:"time,omitempty"`
+	// Copying is the copy in progress.
+	Copying string `json:"copying,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StorageGrowth records a storage growth by the operator.
+type StorageGrowth struct {
+	Time metav1.Time `json:"time"`
+	// From and To are the allocated storage in GiB.
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// FreePercent is the free storage that triggered the growth.
+	FreePercent int64 `json:"freePercent"`
+}
+
+// DeferredAction is a modification held back by a change freeze.
+type DeferredAction struct {
+	// Reason is the operator step making the change, e.g. EngineUpgrade.
+	Reason string `json:"reason"`
+	// Input is the JSON encoded request with secrets redacted.
+	Input  string      `json:"input"`
+	Freeze string      `json:"freeze"`
+	Until  metav1.Time `json:"until"`
+}
+
+// UpgradeStatus tracks an engine version upgrade.
+type UpgradeStatus struct {
+	Phase       string `json:"phase"`
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+	// Snapshot is taken before the upgrade is applied.
+	Snapshot string `json:"snapshot,omitempty"`
+	// RestoredInstance is created from the snapshot when the upgrade fails.
+	RestoredInstance string `json:"restoredInstance,omitempty"`
+	Message          string `json:"message,omitempty"`
+}
+
+// EncryptionStatus reports the migration of an unencrypted instance to an
+// encrypted copy.
+type EncryptionStatus struct {
+	Phase    string `json:"phase"`
+	KmsKeyID string `json:"kmsKeyId,omitempty"`
+	// Snapshot of the unencrypted instance and its encrypted copy.
+	Snapshot          string `json:"snapshot,omitempty"`
+	EncryptedSnapshot string `json:"encryptedSnapshot,omitempty"`
+	// Instance is restored from the encrypted snapshot, it takes over the
+	// identifier of the unencrypted instance once that is retired.
+	Instance string `json:"instance,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ReplacementStatus reports the replacement of the instance by a new one.
+type ReplacementStatus struct {
+	Phase  string `json:"phase"`
+	Method string `json:"method,omitempty"`
+	// Changes lists the spec fields that require the replacement.
+	Changes []string `json:"changes,omitempty"`
+	// Snapshot the new instance is restored from.
+	Snapshot string `json:"snapshot,omitempty"`
+	// Instance is the new instance, it takes over the identifier once the
+	// old instance is retired.
+	Instance string `json:"instance,omitempty"`
+	// BakePeriod is the bake period of spec.replacement when the
+	// replacement started.
+	BakePeriod *metav1.Duration `json:"bakePeriod,omitempty"`
+	// BakeUntil is when the old instance is deleted.
+	BakeUntil *metav1.Time `json:"bakeUntil,omitempty"`
+	Message   string       `json:"message,omitempty"`
+}
+
+// FieldDrift is a spec field changed outside the operator.
+type FieldDrift struct {
+	Field    string `json:"field"`
+	Declared string `json:"declared"`
+	Actual   string `json:"actual"`
+}
+
+// DatabaseCondition describes an aspect of the database state.
+type DatabaseCondition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// PlannedAction is an AWS call the operator would make in plan mode.
+type PlannedAction struct {
+	// Action is the RDS API call, e.g. CreateDBInstance.
+	Action string `json:"action"`
+	// Input is the JSON encoded request with secrets redacted.
+	Input string `json:"input"`
 }
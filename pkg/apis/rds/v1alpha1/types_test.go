@@ -0,0 +1,40 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyClass(t *testing.T) {
+	class := &DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod-postgres"},
+		Spec: DatabaseSpec{
+			Engine:         "postgres",
+			InstanceClass:  "db.m4.large",
+			SubnetGroup:    "private",
+			SecurityGroups: []string{"sg-1"},
+			MultiAZ:        true,
+			Tags:           map[string]string{"team": "platform", "tier": "prod"},
+		},
+	}
+	db := &Database{Spec: DatabaseSpec{
+		InstanceClass:  "db.m4.xlarge",
+		SecurityGroups: []string{},
+		Tags:           map[string]string{"team": "payments"},
+	}}
+	ApplyClass(db, class)
+
+	require.Equal(t, "prod-postgres", db.Spec.ClassName)
+	require.Equal(t, "postgres", db.Spec.Engine)
+	require.Equal(t, "db.m4.xlarge", db.Spec.InstanceClass)
+	require.Equal(t, "private", db.Spec.SubnetGroup)
+	require.Equal(t, []string{"sg-1"}, db.Spec.SecurityGroups)
+	require.True(t, db.Spec.MultiAZ)
+	require.Equal(t, map[string]string{"team": "payments", "tier": "prod"}, db.Spec.Tags)
+
+	// The class is not shared with the database.
+	db.Spec.SecurityGroups[0] = "sg-2"
+	require.Equal(t, "sg-1", class.Spec.SecurityGroups[0])
+}
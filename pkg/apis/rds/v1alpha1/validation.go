@@ -0,0 +1,339 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+
+	// minWindow is the shortest backup or maintenance window RDS accepts.
+	minWindow = 30
+)
+
+var weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// Validate checks the parts of the spec RDS would otherwise reject.
+func Validate(db *Database) error {
+	s := db.Spec
+
+	var backup, maintenance *window
+	if s.PreferredBackupWindow != "" {
+		w, err := parseBackupWindow(s.PreferredBackupWindow)
+		if err != nil {
+			return fmt.Errorf("invalid preferredBackupWindow: %v", err)
+		}
+		backup = &w
+	}
+	if s.PreferredMaintenanceWindow != "" {
+		w, err := parseMaintenanceWindow(s.PreferredMaintenanceWindow)
+		if err != nil {
+			return fmt.Errorf("invalid preferredMaintenanceWindow: %v", err)
+		}
+		maintenance = &w
+	}
+
+	if a := s.StorageAutoscaling; a != nil {
+		if err := validateStorageAutoscaling(s.Storage, a); err != nil {
+			return fmt.Errorf("invalid storageAutoscaling: %v", err)
+		}
+	}
+
+	switch s.DeletionPolicy {
+	case "", DeletionPolicySnapshot, DeletionPolicyDelete, DeletionPolicyRetain:
+	default:
+		return fmt.Errorf("unknown deletionPolicy %q, use %s, %s or %s",
+			s.DeletionPolicy, DeletionPolicySnapshot, DeletionPolicyDelete, DeletionPolicyRetain)
+	}
+
+	if s.KmsKeyID != "" && !s.Encrypted {
+		return fmt.Errorf("kmsKeyId requires encrypted")
+	}
+
+	if d := s.DisasterRecovery; d != nil {
+		if err := validateDisasterRecovery(s.Encrypted, d); err != nil {
+			return fmt.Errorf("invalid disasterRecovery: %v", err)
+		}
+	}
+
+	if m := s.Monitoring; m != nil {
+		if err := validateMonitoring(s.Engine, m); err != nil {
+			return fmt.Errorf("invalid monitoring: %v", err)
+		}
+	}
+
+	if sc := s.Schedule; sc != nil {
+		if err := validateSchedule(sc); err != nil {
+			return fmt.Errorf("invalid schedule: %v", err)
+		}
+	}
+
+	if r := s.Replacement; r != nil {
+		if err := validateReplacement(r); err != nil {
+			return fmt.Errorf("invalid replacement: %v", err)
+		}
+	}
+
+	if backup != nil && maintenance != nil {
+		for day := 0; day < 7; day++ {
+			daily := window{start: backup.start + day*minutesPerDay, length: backup.length}
+			if daily.overlaps(*maintenance) {
+				return fmt.Errorf("preferredBackupWindow %s overlaps preferredMaintenanceWindow %s",
+					s.PreferredBackupWindow, s.PreferredMaintenanceWindow)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateClass checks the fields a class may not preset. The databases using
+// the class are validated with its fields filled in.
+func ValidateClass(c *DatabaseClass) error {
+	if c.Spec.Password != "" {
+		return fmt.Errorf("password may not be set on a class")
+	}
+	if c.Spec.ClassName != "" {
+		return fmt.Errorf("className may not be set on a class")
+	}
+	return nil
+}
+
+// ValidateInstance checks the reclaim policy and the database of an instance.
+func ValidateInstance(i *DatabaseInstance) error {
+	switch i.Spec.ReclaimPolicy {
+	case "", ReclaimDelete, ReclaimRetain, ReclaimRecycle:
+	default:
+		return fmt.Errorf("unknown reclaimPolicy %q, use %s, %s or %s",
+			i.Spec.ReclaimPolicy, ReclaimDelete, ReclaimRetain, ReclaimRecycle)
+	}
+	return Validate(&Database{Spec: i.Spec.Database})
+}
+
+// ValidatePolicy checks the selector, patterns and limits of a policy.
+func ValidatePolicy(p *DatabasePolicy) error {
+	if _, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespaceSelector: %v", err)
+	}
+	for _, pattern := range p.Spec.InstanceClasses {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid instanceClasses pattern %q", pattern)
+		}
+	}
+	if p.Spec.MaxInstances < 0 || p.Spec.MaxStorage < 0 {
+		return fmt.Errorf("maxInstances and maxStorage may not be negative")
+	}
+	return nil
+}
+
+func validateSchedule(s *Schedule) error {
+	if s.ActiveHours != "" {
+		if _, err := cron.Parse(s.ActiveHours); err != nil {
+			return fmt.Errorf("activeHours: %v", err)
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return nil
+}
+
+func validateReplacement(r *Replacement) error {
+	switch r.Strategy {
+	case "", ReplacementStrategyNone, ReplacementStrategyBlueGreen:
+	default:
+		return fmt.Errorf("unknown strategy %q, use %s or %s",
+			r.Strategy, ReplacementStrategyNone, ReplacementStrategyBlueGreen)
+	}
+	if r.BakePeriod != nil && r.BakePeriod.Duration < 0 {
+		return fmt.Errorf("bakePeriod may not be negative")
+	}
+	return nil
+}
+
+func validateStorageAutoscaling(storage int64, a *StorageAutoscaling) error {
+	switch a.Mode {
+	case "", StorageAutoscalingOperator, StorageAutoscalingNative:
+	default:
+		return fmt.Errorf("unknown mode %q", a.Mode)
+	}
+	if a.MaxAllocatedStorage <= 0 || a.MaxAllocatedStorage < storage {
+		return fmt.Errorf("maxAllocatedStorage must be at least storage")
+	}
+	if a.ThresholdPercent < 0 || a.ThresholdPercent >= 100 {
+		return fmt.Errorf("thresholdPercent must be between 1 and 99")
+	}
+	if a.Step < 0 {
+		return fmt.Errorf("step must be positive")
+	}
+	return nil
+}
+
+func validateDisasterRecovery(encrypted bool, d *DisasterRecovery) error {
+	if len(d.Regions) == 0 {
+		return fmt.Errorf("at least one region is required")
+	}
+	seen := map[string]bool{}
+	for _, r := range d.Regions {
+		if r.Region == "" {
+			return fmt.Errorf("region is required")
+		}
+		if seen[r.Region] {
+			return fmt.Errorf("region %s is listed twice", r.Region)
+		}
+		seen[r.Region] = true
+		if encrypted && r.KmsKeyID == "" {
+			return fmt.Errorf("kmsKeyId is required for region %s of an encrypted database", r.Region)
+		}
+	}
+	if d.Retention < 0 {
+		return fmt.Errorf("retention must be positive")
+	}
+	return nil
+}
+
+// logExports lists the CloudWatch log types each engine exports.
+var logExports = map[string][]string{
+	"postgres": {"postgresql", "upgrade"},
+	"mysql":    {"error", "general", "slowquery", "audit"},
+	"mariadb":  {"error", "general", "slowquery", "audit"},
+}
+
+func validateMonitoring(engine string, m *Monitoring) error {
+	switch m.PerformanceInsightsRetentionPeriod {
+	case 0, 7, 731:
+	default:
+		return fmt.Errorf("performanceInsightsRetentionPeriod must be 7 or 731")
+	}
+	if !m.PerformanceInsights && (m.PerformanceInsightsRetentionPeriod != 0 || m.PerformanceInsightsKMSKeyID != "") {
+		return fmt.Errorf("performanceInsightsRetentionPeriod and performanceInsightsKmsKeyId require performanceInsights")
+	}
+
+	switch m.MonitoringInterval {
+	case 0, 1, 5, 10, 15, 30, 60:
+	default:
+		return fmt.Errorf("monitoringInterval must be one of 0, 1, 5, 10, 15, 30 or 60")
+	}
+	if (m.MonitoringInterval == 0) != (m.MonitoringRoleArn == "") {
+		return fmt.Errorf("monitoringInterval and monitoringRoleArn must be set together")
+	}
+
+	if engine == "" {
+		engine = "postgres"
+	}
+	allowed, ok := logExports[engine]
+	for _, l := range m.EnableCloudwatchLogsExports {
+		if ok && !contains(allowed, l) {
+			return fmt.Errorf("log %q cannot be exported for engine %s, use one of %s",
+				l, engine, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// window is a span of minutes on the weekly UTC clock, it may wrap around
+// the end of the week.
+type window struct {
+	start, length int
+}
+
+func (w window) overlaps(o window) bool {
+	for _, m := range []int{o.start - minutesPerWeek, o.start, o.start + minutesPerWeek} {
+		if m < w.start+w.length && w.start < m+o.length {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBackupWindow parses a daily window in the format hh24:mi-hh24:mi.
+func parseBackupWindow(s string) (window, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return window{}, fmt.Errorf("%q is not in the format hh24:mi-hh24:mi", s)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return window{}, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return window{}, err
+	}
+	return newWindow(start, end, minutesPerDay)
+}
+
+// parseMaintenanceWindow parses a weekly window in the format
+// ddd:hh24:mi-ddd:hh24:mi.
+func parseMaintenanceWindow(s string) (window, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return window{}, fmt.Errorf("%q is not in the format ddd:hh24:mi-ddd:hh24:mi", s)
+	}
+	start, err := parseWeekClock(parts[0])
+	if err != nil {
+		return window{}, err
+	}
+	end, err := parseWeekClock(parts[1])
+	if err != nil {
+		return window{}, err
+	}
+	return newWindow(start, end, minutesPerWeek)
+}
+
+func newWindow(start, end, period int) (window, error) {
+	length := (end - start + period) % period
+	if length < minWindow {
+		return window{}, fmt.Errorf("window must be at least %d minutes", minWindow)
+	}
+	return window{start: start, length: length}, nil
+}
+
+func parseWeekClock(s string) (int, error) {
+	if len(s) < 4 || s[3] != ':' {
+		return 0, fmt.Errorf("%q is not in the format ddd:hh24:mi", s)
+	}
+	day := -1
+	for i, d := range weekdays {
+		if strings.ToLower(s[:3]) == d {
+			day = i
+		}
+	}
+	if day < 0 {
+		return 0, fmt.Errorf("%q is not a day of the week", s[:3])
+	}
+	m, err := parseClock(s[4:])
+	return day*minutesPerDay + m, err
+}
+
+// parseClock parses hh24:mi into minutes after midnight.
+func parseClock(s string) (int, error) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, fmt.Errorf("%q is not in the format hh24:mi", s)
+	}
+	h, err := strconv.Atoi(s[:2])
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("%q has an invalid hour", s)
+	}
+	m, err := strconv.Atoi(s[3:])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("%q has an invalid minute", s)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,177 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidate_Windows(t *testing.T) {
+	for _, test := range []struct {
+		backup, maintenance string
+		err                 string
+	}{
+		{"", "", ""},
+		{"03:00-03:30", "sun:05:00-sun:06:00", ""},
+		{"23:30-00:30", "mon:01:00-mon:02:00", ""},
+		{"03:00-03:29", "", "at least 30 minutes"},
+		{"3:00-04:00", "", "not in the format hh24:mi"},
+		{"03:00-24:00", "", "invalid hour"},
+		{"", "sun:05:00", "not in the format ddd:hh24:mi-ddd:hh24:mi"},
+		{"", "fun:05:00-fun:06:00", "not a day of the week"},
+		{"03:00-04:00", "wed:03:30-wed:04:30", "overlaps"},
+		// The backup window wraps into Monday morning.
+		{"23:30-00:30", "mon:00:00-mon:01:00", "overlaps"},
+		// The maintenance window wraps around the end of the week.
+		{"00:30-01:30", "sun:23:00-mon:01:00", "overlaps"},
+	} {
+		db := &Database{Spec: DatabaseSpec{
+			PreferredBackupWindow:      test.backup,
+			PreferredMaintenanceWindow: test.maintenance,
+		}}
+		err := Validate(db)
+		if test.err == "" {
+			require.NoError(t, err, "%s %s", test.backup, test.maintenance)
+			continue
+		}
+		require.Error(t, err, "%s %s", test.backup, test.maintenance)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestValidate_Monitoring(t *testing.T) {
+	role := "arn:aws:iam::123456789012:role/rds-monitoring"
+	for _, test := range []struct {
+		engine     string
+		monitoring Monitoring
+		err        string
+	}{
+		{"", Monitoring{PerformanceInsights: true, PerformanceInsightsRetentionPeriod: 731}, ""},
+		{"", Monitoring{MonitoringInterval: 60, MonitoringRoleArn: role}, ""},
+		{"", Monitoring{EnableCloudwatchLogsExports: []string{"postgresql", "upgrade"}}, ""},
+		{"mysql", Monitoring{EnableCloudwatchLogsExports: []string{"slowquery", "audit"}}, ""},
+		{"", Monitoring{PerformanceInsights: true, PerformanceInsightsRetentionPeriod: 30}, "must be 7 or 731"},
+		{"", Monitoring{PerformanceInsightsKMSKeyID: "alias/pi"}, "require performanceInsights"},
+		{"", Monitoring{MonitoringInterval: 20, MonitoringRoleArn: role}, "must be one of"},
+		{"", Monitoring{MonitoringInterval: 60}, "must be set together"},
+		{"", Monitoring{MonitoringRoleArn: role}, "must be set together"},
+		{"postgres", Monitoring{EnableCloudwatchLogsExports: []string{"slowquery"}}, `log "slowquery" cannot be exported`},
+	} {
+		m := test.monitoring
+		err := Validate(&Database{Spec: DatabaseSpec{Engine: test.engine, Monitoring: &m}})
+		if test.err == "" {
+			require.NoError(t, err, "%+v", m)
+			continue
+		}
+		require.Error(t, err, "%+v", m)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestValidate_KmsKeyID(t *testing.T) {
+	require.NoError(t, Validate(&Database{Spec: DatabaseSpec{Encrypted: true, KmsKeyID: "alias/app"}}))
+
+	err := Validate(&Database{Spec: DatabaseSpec{KmsKeyID: "alias/app"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "kmsKeyId requires encrypted")
+}
+
+func TestValidate_DeletionPolicy(t *testing.T) {
+	require.NoError(t, Validate(&Database{Spec: DatabaseSpec{DeletionPolicy: DeletionPolicyRetain}}))
+
+	err := Validate(&Database{Spec: DatabaseSpec{DeletionPolicy: "Archive"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown deletionPolicy")
+}
+
+func TestValidate_DisasterRecovery(t *testing.T) {
+	for _, test := range []struct {
+		encrypted bool
+		dr        DisasterRecovery
+		err       string
+	}{
+		{false, DisasterRecovery{Regions: []DisasterRecoveryRegion{{Region: "us-east-1"}}}, ""},
+		{true, DisasterRecovery{Regions: []DisasterRecoveryRegion{{Region: "us-east-1", KmsKeyID: "alias/dr"}}}, ""},
+		{false, DisasterRecovery{}, "at least one region"},
+		{false, DisasterRecovery{Regions: []DisasterRecoveryRegion{{Region: "us-east-1"}, {Region: "us-east-1"}}}, "listed twice"},
+		{true, DisasterRecovery{Regions: []DisasterRecoveryRegion{{Region: "us-east-1"}}}, "kmsKeyId is required"},
+		{false, DisasterRecovery{Regions: []DisasterRecoveryRegion{{Region: "us-east-1"}}, Retention: -1}, "retention"},
+	} {
+		dr := test.dr
+		err := Validate(&Database{Spec: DatabaseSpec{Encrypted: test.encrypted, DisasterRecovery: &dr}})
+		if test.err == "" {
+			require.NoError(t, err, "%+v", dr)
+			continue
+		}
+		require.Error(t, err, "%+v", dr)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestValidate_Replacement(t *testing.T) {
+	for _, test := range []struct {
+		r   Replacement
+		err string
+	}{
+		{Replacement{}, ""},
+		{Replacement{Strategy: ReplacementStrategyBlueGreen, BakePeriod: &metav1.Duration{Duration: time.Hour}}, ""},
+		{Replacement{Strategy: "Recreate"}, "unknown strategy"},
+		{Replacement{BakePeriod: &metav1.Duration{Duration: -time.Hour}}, "bakePeriod"},
+	} {
+		r := test.r
+		err := Validate(&Database{Spec: DatabaseSpec{Replacement: &r}})
+		if test.err == "" {
+			require.NoError(t, err, "%+v", r)
+			continue
+		}
+		require.Error(t, err, "%+v", r)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestValidate_Schedule(t *testing.T) {
+	for _, test := range []struct {
+		s   Schedule
+		err string
+	}{
+		{Schedule{ActiveHours: "* 8-19 * * mon-fri", Timezone: "Europe/Berlin"}, ""},
+		{Schedule{Stopped: true}, ""},
+		{Schedule{ActiveHours: "8-19 * *"}, "activeHours: expected 5 fields"},
+		{Schedule{ActiveHours: "* * * * *", Timezone: "Mars/Olympus"}, "unknown timezone"},
+	} {
+		sc := test.s
+		err := Validate(&Database{Spec: DatabaseSpec{Schedule: &sc}})
+		if test.err == "" {
+			require.NoError(t, err, "%+v", sc)
+			continue
+		}
+		require.Error(t, err, "%+v", sc)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
+
+func TestValidateClass(t *testing.T) {
+	require.NoError(t, ValidateClass(&DatabaseClass{Spec: DatabaseSpec{InstanceClass: "db.m4.large"}}))
+	require.Error(t, ValidateClass(&DatabaseClass{Spec: DatabaseSpec{Password: "secret"}}))
+	require.Error(t, ValidateClass(&DatabaseClass{Spec: DatabaseSpec{ClassName: "other"}}))
+}
+
+func TestValidateInstance(t *testing.T) {
+	require.NoError(t, ValidateInstance(&DatabaseInstance{Spec: DatabaseInstanceSpec{ReclaimPolicy: ReclaimRecycle}}))
+	err := ValidateInstance(&DatabaseInstance{Spec: DatabaseInstanceSpec{ReclaimPolicy: "Archive"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown reclaimPolicy")
+}
+
+func TestValidatePolicy(t *testing.T) {
+	require.NoError(t, ValidatePolicy(&DatabasePolicy{Spec: DatabasePolicySpec{InstanceClasses: []string{"db.t2.*"}}}))
+	require.Error(t, ValidatePolicy(&DatabasePolicy{Spec: DatabasePolicySpec{InstanceClasses: []string{"db.[t2"}}}))
+	require.Error(t, ValidatePolicy(&DatabasePolicy{Spec: DatabasePolicySpec{MaxStorage: -1}}))
+	require.Error(t, ValidatePolicy(&DatabasePolicy{Spec: DatabasePolicySpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "team", Operator: "Near"},
+		}},
+	}}))
+}
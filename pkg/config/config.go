@@ -0,0 +1,465 @@
+// Package config loads the operator configuration from a file, the
+// environment and flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/leader"
+	"github.com/coldog/rds-operator/pkg/logging"
+	"github.com/coldog/rds-operator/pkg/naming"
+	"github.com/coldog/rds-operator/pkg/rds"
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Config configures the operator. The fields follow the chart values.
+type Config struct {
+	// File is the file the config was loaded from.
+	File string `json:"-"`
+
+	// DryRun plans AWS changes without executing them.
+	DryRun bool `json:"dryRun"`
+	// ClusterID is stamped on RDS instances as an ownership tag.
+	ClusterID string `json:"clusterId"`
+	// WatchNamespace is the namespace of the watched Databases and
+	// DatabaseClaims, empty watches all namespaces.
+	WatchNamespace string `json:"watchNamespace"`
+	// InstanceNamespace holds the Databases managing DatabaseInstances.
+	InstanceNamespace string `json:"instanceNamespace"`
+	// InstanceNameTemplate renders the identifiers of new instances.
+	InstanceNameTemplate string `json:"instanceNameTemplate"`
+	// DeletionPolicy applies to databases without spec.deletionPolicy.
+	DeletionPolicy string `json:"deletionPolicy"`
+	// FreezeConfigMap is the namespace/name of the change freeze calendar.
+	FreezeConfigMap string `json:"freezeConfigMap"`
+	// PricingFile is the pricing table of the cost estimates.
+	PricingFile string `json:"pricingFile"`
+
+	Log            Log            `json:"log"`
+	Tags           Tags           `json:"tags"`
+	Reconciler     Reconciler     `json:"reconciler"`
+	AWS            AWS            `json:"aws"`
+	Drift          Drift          `json:"drift"`
+	Orphans        Orphans        `json:"orphans"`
+	LeaderElection LeaderElection `json:"leaderElection"`
+	Webhook        Webhook        `json:"webhook"`
+
+	StorageAutoscaling Interval `json:"storageAutoscaling"`
+	DisasterRecovery   Interval `json:"disasterRecovery"`
+	Schedule           Interval `json:"schedule"`
+
+	// FeatureGates switch features by name, see rds.Features.
+	FeatureGates map[string]bool `json:"featureGates"`
+}
+
+// Log configures the logger.
+type Log struct {
+	// Level is a logrus level like info or debug.
+	Level string `json:"level"`
+	// Format is text or json.
+	Format string `json:"format"`
+}
+
+// Tags configures the tags of the instances.
+type Tags struct {
+	// Defaults are applied to every instance.
+	Defaults map[string]string `json:"defaults"`
+	// Labels and Annotations list the keys copied from the database.
+	Labels      []string `json:"labels"`
+	Annotations []string `json:"annotations"`
+}
+
+// Reconciler configures the workers and the watches.
+type Reconciler struct {
+	Workers             int             `json:"workers"`
+	ResyncPeriod        metav1.Duration `json:"resyncPeriod"`
+	RequeueProvisioning metav1.Duration `json:"requeueProvisioning"`
+	RequeueStable       metav1.Duration `json:"requeueStable"`
+	RetryBaseDelay      metav1.Duration `json:"retryBaseDelay"`
+	RetryMaxDelay       metav1.Duration `json:"retryMaxDelay"`
+}
+
+// AWS configures the AWS clients.
+type AWS struct {
+	// Region defaults to $AWS_REGION.
+	Region string `json:"region"`
+	// Endpoints override the endpoint URL of AWS services by endpoint ID.
+	Endpoints     map[string]string `json:"endpoints"`
+	CacheInterval metav1.Duration   `json:"cacheInterval"`
+	CacheTagsTTL  metav1.Duration   `json:"cacheTagsTTL"`
+	Rate          float64           `json:"rate"`
+	Burst         int               `json:"burst"`
+}
+
+// Drift configures the drift audits.
+type Drift struct {
+	Policy   string          `json:"policy"`
+	Interval metav1.Duration `json:"interval"`
+}
+
+// Orphans configures the sweeper.
+type Orphans struct {
+	SweepInterval metav1.Duration `json:"sweepInterval"`
+	DeleteAfter   metav1.Duration `json:"deleteAfter"`
+}
+
+// LeaderElection configures the leader election.
+type LeaderElection struct {
+	Enabled       bool            `json:"enabled"`
+	Namespace     string          `json:"namespace"`
+	LeaseDuration metav1.Duration `json:"leaseDuration"`
+	RenewDeadline metav1.Duration `json:"renewDeadline"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod"`
+}
+
+// Webhook configures the validating admission webhook.
+type Webhook struct {
+	// Port serves the webhook with TLS, 0 disables it.
+	Port     int    `json:"port"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// Interval configures how often a check runs.
+type Interval struct {
+	Interval metav1.Duration `json:"interval"`
+}
+
+func duration(d time.Duration) metav1.Duration { return metav1.Duration{Duration: d} }
+
+// Default returns the default config.
+func Default() *Config {
+	election := leader.DefaultConfig()
+	return &Config{
+		ClusterID:            os.Getenv("CLUSTER_ID"),
+		WatchNamespace:       os.Getenv("WATCH_NAMESPACE"),
+		InstanceNamespace:    os.Getenv("POD_NAMESPACE"),
+		InstanceNameTemplate: naming.DefaultTemplate,
+		DeletionPolicy:       v1alpha1.DeletionPolicySnapshot,
+		PricingFile:          "/etc/rds-operator/pricing.json",
+		Log:                  Log{Level: "info", Format: LogFormatText},
+		Reconciler: Reconciler{
+			Workers:             4,
+			ResyncPeriod:        duration(10 * time.Minute),
+			RequeueProvisioning: duration(15 * time.Second),
+			RequeueStable:       duration(time.Minute),
+			RetryBaseDelay:      duration(time.Second),
+			RetryMaxDelay:       duration(5 * time.Minute),
+		},
+		AWS: AWS{
+			Region:        os.Getenv("AWS_REGION"),
+			CacheInterval: duration(30 * time.Second),
+			CacheTagsTTL:  duration(10 * time.Minute),
+			Rate:          10,
+			Burst:         20,
+		},
+		Drift:   Drift{Interval: duration(5 * time.Minute)},
+		Orphans: Orphans{SweepInterval: duration(10 * time.Minute)},
+		LeaderElection: LeaderElection{
+			Namespace:     os.Getenv("POD_NAMESPACE"),
+			LeaseDuration: duration(election.LeaseDuration),
+			RenewDeadline: duration(election.RenewDeadline),
+			RetryPeriod:   duration(election.RetryPeriod),
+		},
+		Webhook: Webhook{
+			CertFile: "/etc/rds-operator/webhook/tls.crt",
+			KeyFile:  "/etc/rds-operator/webhook/tls.key",
+		},
+		StorageAutoscaling: Interval{duration(5 * time.Minute)},
+		DisasterRecovery:   Interval{duration(15 * time.Minute)},
+		Schedule:           Interval{duration(time.Minute)},
+	}
+}
+
+// Load returns the config for the command line arguments. The file named by
+// --config overrides the defaults, RDS_OPERATOR_* environment variables
+// override the file and flags override both.
+func Load(args []string) (*Config, error) {
+	// The first pass finds the file and rejects unknown flags.
+	c := Default()
+	if err := c.parse(args, true); err != nil {
+		return nil, err
+	}
+	file := c.File
+
+	c = Default()
+	if file != "" {
+		if err := c.read(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.parse(args, false); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// read decodes the YAML or JSON file into c, unknown fields are rejected.
+func (c *Config) read(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %v", file, err)
+	}
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("invalid config %s: %v", file, err)
+	}
+	return nil
+}
+
+// Validate checks the config.
+func (c *Config) Validate() error {
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("invalid log.level: %v", err)
+	}
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log.format %q, use %s or %s", c.Log.Format, LogFormatText, LogFormatJSON)
+	}
+
+	template, err := naming.Parse(c.InstanceNameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid instanceNameTemplate: %v", err)
+	}
+	if template.UsesCluster() && c.ClusterID == "" {
+		return fmt.Errorf("instanceNameTemplate uses {cluster} without a clusterId")
+	}
+	if c.Orphans.DeleteAfter.Duration > 0 && c.ClusterID == "" {
+		return fmt.Errorf("orphans.deleteAfter needs a clusterId to tell this operator's instances apart")
+	}
+
+	switch c.DeletionPolicy {
+	case "", v1alpha1.DeletionPolicySnapshot, v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyRetain:
+	default:
+		return fmt.Errorf("invalid deletionPolicy %q, use %s, %s or %s", c.DeletionPolicy,
+			v1alpha1.DeletionPolicySnapshot, v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyRetain)
+	}
+	switch c.Drift.Policy {
+	case "", v1alpha1.DriftPolicyRevert, v1alpha1.DriftPolicyReport, v1alpha1.DriftPolicyIgnore:
+	default:
+		return fmt.Errorf("invalid drift.policy %q, use %s, %s or %s", c.Drift.Policy,
+			v1alpha1.DriftPolicyRevert, v1alpha1.DriftPolicyReport, v1alpha1.DriftPolicyIgnore)
+	}
+
+	for k := range c.Tags.Defaults {
+		if k == "" || strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return fmt.Errorf("invalid tags.defaults key %q", k)
+		}
+	}
+
+	for service, endpoint := range c.AWS.Endpoints {
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid aws.endpoints.%s %q, expected an absolute URL", service, endpoint)
+		}
+	}
+	if c.AWS.Rate < 0 {
+		return fmt.Errorf("invalid aws.rate %v, may not be negative", c.AWS.Rate)
+	}
+	if c.AWS.Rate > 0 && c.AWS.Burst < 1 {
+		return fmt.Errorf("invalid aws.burst %d, must be at least 1", c.AWS.Burst)
+	}
+
+	if c.Reconciler.Workers < 1 {
+		return fmt.Errorf("invalid reconciler.workers %d, must be at least 1", c.Reconciler.Workers)
+	}
+	if c.Reconciler.RetryMaxDelay.Duration < c.Reconciler.RetryBaseDelay.Duration {
+		return fmt.Errorf("reconciler.retryMaxDelay is shorter than reconciler.retryBaseDelay")
+	}
+
+	for name, d := range map[string]metav1.Duration{
+		"reconciler.resyncPeriod":        c.Reconciler.ResyncPeriod,
+		"reconciler.requeueProvisioning": c.Reconciler.RequeueProvisioning,
+		"reconciler.requeueStable":       c.Reconciler.RequeueStable,
+		"reconciler.retryBaseDelay":      c.Reconciler.RetryBaseDelay,
+		"drift.interval":                 c.Drift.Interval,
+		"storageAutoscaling.interval":    c.StorageAutoscaling.Interval,
+		"disasterRecovery.interval":      c.DisasterRecovery.Interval,
+		"schedule.interval":              c.Schedule.Interval,
+	} {
+		if d.Duration <= 0 {
+			return fmt.Errorf("invalid %s %v, must be positive", name, d.Duration)
+		}
+	}
+	for name, d := range map[string]metav1.Duration{
+		"aws.cacheInterval":     c.AWS.CacheInterval,
+		"aws.cacheTagsTTL":      c.AWS.CacheTagsTTL,
+		"orphans.sweepInterval": c.Orphans.SweepInterval,
+		"orphans.deleteAfter":   c.Orphans.DeleteAfter,
+	} {
+		if d.Duration < 0 {
+			return fmt.Errorf("invalid %s %v, may not be negative", name, d.Duration)
+		}
+	}
+
+	if c.Webhook.Port < 0 || c.Webhook.Port > 65535 {
+		return fmt.Errorf("invalid webhook.port %d", c.Webhook.Port)
+	}
+
+	for name := range c.FeatureGates {
+		if !knownFeature(name) {
+			return fmt.Errorf("unknown feature gate %q, use one of %s", name, strings.Join(rds.Features, ", "))
+		}
+	}
+	return nil
+}
+
+func knownFeature(name string) bool {
+	for _, f := range rds.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload returns the config to run with after next was loaded. Fields that
+// can change while running are taken from next, the others are kept and the
+// ones that differ are returned, they take effect on restart. The sweeper
+// isn't reconfigured, so dryRun, clusterId and orphans are always kept.
+func (c *Config) Reload(next *Config) (*Config, []string) {
+	reloaded := *c
+	reloaded.Log = next.Log
+	reloaded.Tags = next.Tags
+	reloaded.InstanceNameTemplate = next.InstanceNameTemplate
+	reloaded.DeletionPolicy = next.DeletionPolicy
+	reloaded.FreezeConfigMap = next.FreezeConfigMap
+	reloaded.Drift = next.Drift
+	reloaded.StorageAutoscaling = next.StorageAutoscaling
+	reloaded.DisasterRecovery = next.DisasterRecovery
+	reloaded.Schedule = next.Schedule
+	reloaded.Reconciler.RequeueProvisioning = next.Reconciler.RequeueProvisioning
+	reloaded.Reconciler.RequeueStable = next.Reconciler.RequeueStable
+	reloaded.FeatureGates = next.FeatureGates
+	return &reloaded, changed("", reflect.ValueOf(reloaded), reflect.ValueOf(*next))
+}
+
+// changed returns the JSON paths of the fields that differ between a and b.
+func changed(prefix string, a, b reflect.Value) (fields []string) {
+	for i := 0; i < a.NumField(); i++ {
+		name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Struct && fa.Type() != reflect.TypeOf(metav1.Duration{}) {
+			fields = append(fields, changed(prefix+name+".", fa, fb)...)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			fields = append(fields, prefix+name)
+		}
+	}
+	return fields
+}
+
+// Setup sets the level and format of the standard logger, secrets are
+// redacted from every entry.
+func (l Log) Setup() {
+	level, err := log.ParseLevel(l.Level)
+	if err != nil {
+		level = log.InfoLevel
+	}
+	log.SetLevel(level)
+	if l.Format == LogFormatJSON {
+		log.SetFormatter(logging.Formatter{Formatter: &log.JSONFormatter{}})
+	} else {
+		log.SetFormatter(logging.Formatter{Formatter: &log.TextFormatter{}})
+	}
+}
+
+// Handler returns the handler config without the pricing table.
+func (c *Config) Handler() (rds.Config, error) {
+	template, err := naming.Parse(c.InstanceNameTemplate)
+	if err != nil {
+		return rds.Config{}, err
+	}
+	cfg := rds.Config{
+		DryRun:         c.DryRun,
+		ClusterID:      c.ClusterID,
+		DefaultTags:    c.Tags.Defaults,
+		TagLabels:      c.Tags.Labels,
+		TagAnnotations: c.Tags.Annotations,
+		DeletionPolicy: c.DeletionPolicy,
+		DriftPolicy:    c.Drift.Policy,
+		DriftInterval:  c.Drift.Interval.Duration,
+
+		StorageInterval:          c.StorageAutoscaling.Interval.Duration,
+		DisasterRecoveryInterval: c.DisasterRecovery.Interval.Duration,
+		ScheduleInterval:         c.Schedule.Interval.Duration,
+
+		InstanceNamespace: c.InstanceNamespace,
+		Naming:            template,
+
+		Cache: rds.CacheConfig{
+			Interval: c.AWS.CacheInterval.Duration,
+			TagsTTL:  c.AWS.CacheTagsTTL.Duration,
+		},
+		AWSRate:      c.AWS.Rate,
+		AWSBurst:     c.AWS.Burst,
+		AWSRegion:    c.AWS.Region,
+		AWSEndpoints: c.AWS.Endpoints,
+		FeatureGates: c.FeatureGates,
+	}
+	cfg.FreezeNamespace, cfg.FreezeConfigMap = splitName(c.FreezeConfigMap, os.Getenv("POD_NAMESPACE"))
+	return cfg, nil
+}
+
+// ReconcilerConfig returns the reconciler config.
+func (c *Config) ReconcilerConfig() rds.ReconcilerConfig {
+	return rds.ReconcilerConfig{
+		Workers:              c.Reconciler.Workers,
+		ProvisioningInterval: c.Reconciler.RequeueProvisioning.Duration,
+		StableInterval:       c.Reconciler.RequeueStable.Duration,
+		RetryBaseDelay:       c.Reconciler.RetryBaseDelay.Duration,
+		RetryMaxDelay:        c.Reconciler.RetryMaxDelay.Duration,
+	}
+}
+
+// SweeperConfig returns the sweeper config.
+func (c *Config) SweeperConfig() rds.SweeperConfig {
+	return rds.SweeperConfig{
+		ClusterID:   c.ClusterID,
+		Namespace:   c.WatchNamespace,
+		Interval:    c.Orphans.SweepInterval.Duration,
+		DeleteAfter: c.Orphans.DeleteAfter.Duration,
+		DryRun:      c.DryRun,
+	}
+}
+
+// splitName splits namespace/name, using the default namespace when s has no
+// namespace.
+func splitName(s, defaultNamespace string) (namespace, name string) {
+	if i := strings.Index(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return defaultNamespace, s
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig writes the config to a temporary file, the returned func
+// removes it.
+func writeConfig(t *testing.T, data string) (string, func()) {
+	dir, err := ioutil.TempDir("", "rds-operator-config")
+	require.NoError(t, err)
+	file := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(data), 0644))
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file, remove := writeConfig(t, `
+log:
+  level: debug
+  format: json
+reconciler:
+  workers: 8
+  resyncPeriod: 5m
+aws:
+  rate: 5
+  endpoints:
+    rds: http://localhost:4566
+tags:
+  defaults:
+    team: platform
+featureGates:
+  Claims: false
+`)
+	defer remove()
+	os.Setenv("RDS_OPERATOR_WORKERS", "6")
+	os.Setenv("RDS_OPERATOR_AWS_RATE", "3")
+	defer os.Unsetenv("RDS_OPERATOR_WORKERS")
+	defer os.Unsetenv("RDS_OPERATOR_AWS_RATE")
+
+	c, err := Load([]string{"--config", file, "--aws-rate=2", "--deletion-policy", v1alpha1.DeletionPolicyRetain})
+	require.NoError(t, err)
+	require.Equal(t, file, c.File)
+	// Flags override the environment, which overrides the file.
+	require.Equal(t, 2.0, c.AWS.Rate)
+	require.Equal(t, 6, c.Reconciler.Workers)
+	require.Equal(t, 5*time.Minute, c.Reconciler.ResyncPeriod.Duration)
+	require.Equal(t, Log{Level: "debug", Format: LogFormatJSON}, c.Log)
+	require.Equal(t, v1alpha1.DeletionPolicyRetain, c.DeletionPolicy)
+	// Fields the file leaves out keep their defaults.
+	require.Equal(t, 20, c.AWS.Burst)
+	require.Equal(t, time.Minute, c.Reconciler.RequeueStable.Duration)
+
+	cfg, err := c.Handler()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "platform"}, cfg.DefaultTags)
+	require.Equal(t, map[string]string{"rds": "http://localhost:4566"}, cfg.AWSEndpoints)
+	require.Equal(t, map[string]bool{rds.FeatureClaims: false}, cfg.FeatureGates)
+}
+
+func TestLoad_Flags(t *testing.T) {
+	c, err := Load([]string{
+		"--tag-labels=team, app",
+		"--default-tags=env=prod,owner=dba",
+		"--feature-gates=Schedules=false",
+		"--aws-endpoints=rds=https://rds.internal",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "", c.File)
+	require.Equal(t, []string{"team", "app"}, c.Tags.Labels)
+	require.Equal(t, map[string]string{"env": "prod", "owner": "dba"}, c.Tags.Defaults)
+	require.Equal(t, map[string]bool{rds.FeatureSchedules: false}, c.FeatureGates)
+	require.Equal(t, "https://rds.internal", c.AWS.Endpoints["rds"])
+
+	_, err = Load([]string{"--default-tags=env"})
+	require.Error(t, err)
+	_, err = Load([]string{"--feature-gates=Schedules=maybe"})
+	require.Error(t, err)
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	file, remove := writeConfig(t, "reconciler:\n  worker: 2\n")
+	defer remove()
+	_, err := Load([]string{"--config", file})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "worker")
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(c *Config)
+		err    string
+	}{
+		{"LogLevel", func(c *Config) { c.Log.Level = "loud" }, "log.level"},
+		{"LogFormat", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"Template", func(c *Config) { c.InstanceNameTemplate = "{name}" }, "instanceNameTemplate"},
+		{"TemplateCluster", func(c *Config) {
+			c.ClusterID = ""
+			c.InstanceNameTemplate = "{cluster}-{namespace}-{name}"
+		}, "without a clusterId"},
+		{"OrphanCluster", func(c *Config) {
+			c.ClusterID = ""
+			c.Orphans.DeleteAfter.Duration = time.Hour
+		}, "orphans.deleteAfter needs a clusterId"},
+		{"DeletionPolicy", func(c *Config) { c.DeletionPolicy = "Archive" }, "deletionPolicy"},
+		{"DriftPolicy", func(c *Config) { c.Drift.Policy = "Fix" }, "drift.policy"},
+		{"DefaultTag", func(c *Config) { c.Tags.Defaults = map[string]string{"aws:team": "a"} }, "tags.defaults"},
+		{"Endpoint", func(c *Config) { c.AWS.Endpoints = map[string]string{"rds": "localhost"} }, "aws.endpoints.rds"},
+		{"Workers", func(c *Config) { c.Reconciler.Workers = 0 }, "reconciler.workers"},
+		{"Resync", func(c *Config) { c.Reconciler.ResyncPeriod.Duration = 0 }, "reconciler.resyncPeriod"},
+		{"RetryDelays", func(c *Config) { c.Reconciler.RetryMaxDelay.Duration = time.Millisecond }, "retryMaxDelay"},
+		{"Burst", func(c *Config) { c.AWS.Burst = 0 }, "aws.burst"},
+		{"WebhookPort", func(c *Config) { c.Webhook.Port = 70000 }, "webhook.port"},
+		{"FeatureGate", func(c *Config) { c.FeatureGates = map[string]bool{"Backups": false} }, "unknown feature gate"},
+	} {
+		c := Default()
+		require.NoError(t, c.Validate(), test.name)
+		test.change(c)
+		err := c.Validate()
+		require.Error(t, err, test.name)
+		require.Contains(t, err.Error(), test.err, test.name)
+	}
+}
+
+func TestReload(t *testing.T) {
+	c := Default()
+	next := Default()
+	next.Log.Level = "debug"
+	next.DeletionPolicy = v1alpha1.DeletionPolicyDelete
+	next.Reconciler.RequeueStable.Duration = 2 * time.Minute
+	next.Reconciler.Workers = 8
+	next.AWS.Rate = 1
+	next.FeatureGates = map[string]bool{rds.FeaturePolicies: false}
+
+	reloaded, restart := c.Reload(next)
+	require.Equal(t, "debug", reloaded.Log.Level)
+	require.Equal(t, v1alpha1.DeletionPolicyDelete, reloaded.DeletionPolicy)
+	require.Equal(t, 2*time.Minute, reloaded.Reconciler.RequeueStable.Duration)
+	require.Equal(t, next.FeatureGates, reloaded.FeatureGates)
+	require.Equal(t, 4, reloaded.Reconciler.Workers)
+	require.Equal(t, 10.0, reloaded.AWS.Rate)
+	require.Equal(t, []string{"reconciler.workers", "aws.rate"}, restart)
+}
+
+func TestReload_Sweeper(t *testing.T) {
+	c := Default()
+	next := Default()
+	next.DryRun = true
+	next.ClusterID = "other"
+	next.Orphans.DeleteAfter.Duration = time.Hour
+
+	reloaded, restart := c.Reload(next)
+	require.Equal(t, c.SweeperConfig(), reloaded.SweeperConfig())
+	require.False(t, reloaded.DryRun)
+	require.Equal(t, []string{"dryRun", "clusterId", "orphans.deleteAfter"}, restart)
+}
+
+func TestWatcher(t *testing.T) {
+	file, remove := writeConfig(t, "log:\n  level: info\n")
+	defer remove()
+	args := []string{"--config", file}
+	c, err := Load(args)
+	require.NoError(t, err)
+
+	var applied []*Config
+	w := &watcher{args: args, current: c, apply: func(c *Config) { applied = append(applied, c) }}
+	w.data, _ = ioutil.ReadFile(file)
+	w.check()
+	require.Empty(t, applied)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("log:\n  level: debug\n"), 0644))
+	w.check()
+	require.Len(t, applied, 1)
+	require.Equal(t, "debug", applied[0].Log.Level)
+
+	// Invalid configs keep the running config.
+	require.NoError(t, ioutil.WriteFile(file, []byte("log:\n  level: loud\n"), 0644))
+	w.check()
+	require.Len(t, applied, 1)
+
+	// Restart-only changes are not applied.
+	require.NoError(t, ioutil.WriteFile(file, []byte("log:\n  level: debug\nreconciler:\n  workers: 2\n"), 0644))
+	w.check()
+	require.Len(t, applied, 1)
+	require.Equal(t, 4, w.current.Reconciler.Workers)
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coldog/rds-operator/pkg/rds"
+)
+
+// EnvPrefix prefixes the environment variables setting flags, --aws-rate is
+// set by RDS_OPERATOR_AWS_RATE.
+const EnvPrefix = "RDS_OPERATOR_"
+
+// parse applies the environment and the arguments to c. Usage is only
+// printed by the first pass.
+func (c *Config) parse(args []string, usage bool) error {
+	fs := c.flagSet()
+	if !usage {
+		fs.SetOutput(ioutil.Discard)
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := EnvPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if v, ok := os.LookupEnv(env); ok && err == nil {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid %s: %v", env, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fs.Parse(args)
+}
+
+// flagSet binds the flags to the fields of c, the current values are the
+// defaults.
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("rds-operator", flag.ContinueOnError)
+
+	fs.StringVar(&c.File, "config", c.File,
+		"YAML or JSON config file, reloaded when it changes.")
+
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun,
+		"Plan AWS changes and write them to the database status without executing them.")
+	fs.StringVar(&c.ClusterID, "cluster-id", c.ClusterID,
+		"Cluster identifier stamped on RDS instances as an ownership tag.")
+	fs.StringVar(&c.WatchNamespace, "watch-namespace", c.WatchNamespace,
+		"Namespace of the watched Databases and DatabaseClaims, empty watches all namespaces.")
+	fs.StringVar(&c.InstanceNamespace, "instance-namespace", c.InstanceNamespace,
+		"Namespace of the Databases managing DatabaseInstances, defaults to $POD_NAMESPACE.")
+	fs.StringVar(&c.InstanceNameTemplate, "instance-name-template", c.InstanceNameTemplate,
+		"Template of new RDS instance identifiers using {cluster}, {namespace} and {name}.")
+	fs.StringVar(&c.DeletionPolicy, "deletion-policy", c.DeletionPolicy,
+		"Deletion policy for databases without spec.deletionPolicy: Snapshot, Delete or Retain.")
+	fs.StringVar(&c.FreezeConfigMap, "freeze-configmap", c.FreezeConfigMap,
+		"Namespace/name of the ConfigMap listing change freezes, a name alone uses $POD_NAMESPACE.")
+	fs.StringVar(&c.PricingFile, "pricing-file", c.PricingFile,
+		"JSON pricing table of the cost estimates, empty disables them.")
+
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level,
+		"Log level: debug, info, warning or error.")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format,
+		"Log format: text or json.")
+
+	fs.Var(mapValue{&c.Tags.Defaults}, "default-tags",
+		"Comma separated key=value tags applied to every RDS instance.")
+	fs.Var(listValue{&c.Tags.Labels}, "tag-labels",
+		"Comma separated database label keys copied to RDS tags.")
+	fs.Var(listValue{&c.Tags.Annotations}, "tag-annotations",
+		"Comma separated database annotation keys copied to RDS tags.")
+
+	fs.StringVar(&c.Drift.Policy, "drift-policy", c.Drift.Policy,
+		"Drift policy for databases without spec.driftPolicy: Revert, Report or Ignore (default).")
+	fs.DurationVar(&c.Drift.Interval.Duration, "drift-interval", c.Drift.Interval.Duration,
+		"Minimum time between drift audits of a database.")
+
+	fs.DurationVar(&c.StorageAutoscaling.Interval.Duration, "storage-interval", c.StorageAutoscaling.Interval.Duration,
+		"Minimum time between free storage checks of databases with storage autoscaling.")
+	fs.DurationVar(&c.DisasterRecovery.Interval.Duration, "disaster-recovery-interval", c.DisasterRecovery.Interval.Duration,
+		"Minimum time between snapshot copies to the disaster recovery regions of a database.")
+	fs.DurationVar(&c.Schedule.Interval.Duration, "schedule-interval", c.Schedule.Interval.Duration,
+		"Minimum time between checks of the stop and start schedule of a database.")
+
+	fs.IntVar(&c.Reconciler.Workers, "workers", c.Reconciler.Workers,
+		"Number of objects synced concurrently.")
+	fs.DurationVar(&c.Reconciler.ResyncPeriod.Duration, "resync-period", c.Reconciler.ResyncPeriod.Duration,
+		"Interval between full resyncs of the watched objects.")
+	fs.DurationVar(&c.Reconciler.RequeueProvisioning.Duration, "requeue-provisioning", c.Reconciler.RequeueProvisioning.Duration,
+		"Delay before syncing an object being created or changed again.")
+	fs.DurationVar(&c.Reconciler.RequeueStable.Duration, "requeue-stable", c.Reconciler.RequeueStable.Duration,
+		"Delay before syncing a stable object again.")
+	fs.DurationVar(&c.Reconciler.RetryBaseDelay.Duration, "retry-base-delay", c.Reconciler.RetryBaseDelay.Duration,
+		"Delay before retrying a failed sync, doubled on each failure.")
+	fs.DurationVar(&c.Reconciler.RetryMaxDelay.Duration, "retry-max-delay", c.Reconciler.RetryMaxDelay.Duration,
+		"Maximum delay before retrying a failed sync.")
+
+	fs.StringVar(&c.AWS.Region, "aws-region", c.AWS.Region,
+		"Region of the RDS instances, defaults to $AWS_REGION.")
+	fs.Var(mapValue{&c.AWS.Endpoints}, "aws-endpoints",
+		"Comma separated endpoint-id=url overrides of AWS endpoints in the region, like rds=http://localhost:4566.")
+	fs.DurationVar(&c.AWS.CacheInterval.Duration, "cache-interval", c.AWS.CacheInterval.Duration,
+		"Interval between listings of all RDS instances for the shared instance cache, 0 disables the cache.")
+	fs.DurationVar(&c.AWS.CacheTagsTTL.Duration, "cache-tags-ttl", c.AWS.CacheTagsTTL.Duration,
+		"Time the cached tags of an RDS instance are used before they are listed again.")
+	fs.Float64Var(&c.AWS.Rate, "aws-rate", c.AWS.Rate,
+		"Maximum AWS API requests per second, 0 is unlimited.")
+	fs.IntVar(&c.AWS.Burst, "aws-burst", c.AWS.Burst,
+		"Maximum burst of AWS API requests above the rate.")
+
+	fs.DurationVar(&c.Orphans.SweepInterval.Duration, "orphan-sweep-interval", c.Orphans.SweepInterval.Duration,
+		"Interval between sweeps for RDS instances without a Database, 0 disables the sweeper.")
+	fs.DurationVar(&c.Orphans.DeleteAfter.Duration, "orphan-delete-after", c.Orphans.DeleteAfter.Duration,
+		"Delete orphaned RDS instances with a final snapshot after this long, 0 only reports them.")
+
+	fs.BoolVar(&c.LeaderElection.Enabled, "leader-elect", c.LeaderElection.Enabled,
+		"Enable leader election so only one replica reconciles at a time.")
+	fs.StringVar(&c.LeaderElection.Namespace, "leader-elect-namespace", c.LeaderElection.Namespace,
+		"Namespace of the leader election lock, defaults to $POD_NAMESPACE.")
+	fs.DurationVar(&c.LeaderElection.LeaseDuration.Duration, "leader-elect-lease-duration", c.LeaderElection.LeaseDuration.Duration,
+		"Duration standbys wait before taking over an unrenewed lease.")
+	fs.DurationVar(&c.LeaderElection.RenewDeadline.Duration, "leader-elect-renew-deadline", c.LeaderElection.RenewDeadline.Duration,
+		"Duration the leader retries renewing before giving up leadership.")
+	fs.DurationVar(&c.LeaderElection.RetryPeriod.Duration, "leader-elect-retry-period", c.LeaderElection.RetryPeriod.Duration,
+		"Duration between leader election attempts.")
+
+	fs.IntVar(&c.Webhook.Port, "webhook-port", c.Webhook.Port,
+		"Port of the validating admission webhook, 0 disables the webhook.")
+	fs.StringVar(&c.Webhook.CertFile, "webhook-cert-file", c.Webhook.CertFile,
+		"TLS certificate of the admission webhook.")
+	fs.StringVar(&c.Webhook.KeyFile, "webhook-key-file", c.Webhook.KeyFile,
+		"TLS key of the admission webhook.")
+
+	fs.Var(gatesValue{&c.FeatureGates}, "feature-gates",
+		"Comma separated Feature=true|false switches, features: "+strings.Join(rds.Features, ", ")+".")
+	return fs
+}
+
+// splitList splits a comma separated list, skipping empty items.
+func splitList(s string) (out []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// splitPairs splits a comma separated list of key=value pairs.
+func splitPairs(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, item := range splitList(s) {
+		i := strings.Index(item, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		out[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+	}
+	return out, nil
+}
+
+// joinPairs is the inverse of splitPairs.
+func joinPairs(m map[string]string) string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// listValue is a comma separated list flag, it replaces the list.
+type listValue struct{ p *[]string }
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = splitList(s)
+	return nil
+}
+
+// mapValue is a key=value list flag, it replaces the map.
+type mapValue struct{ p *map[string]string }
+
+func (v mapValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return joinPairs(*v.p)
+}
+
+func (v mapValue) Set(s string) error {
+	m, err := splitPairs(s)
+	if err != nil {
+		return err
+	}
+	*v.p = m
+	return nil
+}
+
+// gatesValue is a Feature=bool list flag, it replaces the gates.
+type gatesValue struct{ p *map[string]bool }
+
+func (v gatesValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	pairs := map[string]string{}
+	for k, enabled := range *v.p {
+		pairs[k] = strconv.FormatBool(enabled)
+	}
+	return joinPairs(pairs)
+}
+
+func (v gatesValue) Set(s string) error {
+	pairs, err := splitPairs(s)
+	if err != nil {
+		return err
+	}
+	gates := map[string]bool{}
+	for k, value := range pairs {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for feature gate %s", value, k)
+		}
+		gates[k] = enabled
+	}
+	*v.p = gates
+	return nil
+}
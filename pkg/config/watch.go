@@ -0,0 +1,72 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// watcher reloads the config when its file changes.
+type watcher struct {
+	args    []string
+	current *Config
+	data    []byte
+	apply   func(*Config)
+}
+
+// Watch checks the file of the config every interval until ctx is done.
+// When it changed the arguments are loaded again and apply is called with the
+// reloaded config, see Reload. Invalid configs are logged and skipped.
+func Watch(ctx context.Context, args []string, current *Config, interval time.Duration, apply func(*Config)) {
+	if current.File == "" {
+		return
+	}
+	w := &watcher{args: args, current: current, apply: apply}
+	w.data, _ = ioutil.ReadFile(current.File)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		w.check()
+	}
+}
+
+// check reloads the config if the file changed.
+func (w *watcher) check() {
+	logger := log.WithField("file", w.current.File)
+	data, err := ioutil.ReadFile(w.current.File)
+	if err != nil {
+		logger.WithError(err).Warn("failed reading config")
+		return
+	}
+	if bytes.Equal(data, w.data) {
+		return
+	}
+	w.data = data
+
+	next, err := Load(w.args)
+	if err != nil {
+		logger.WithError(err).Error("invalid config, keeping the running config")
+		return
+	}
+	reloaded, restart := w.current.Reload(next)
+	if err := reloaded.Validate(); err != nil {
+		logger.WithError(err).Error("invalid config, keeping the running config")
+		return
+	}
+	if len(restart) > 0 {
+		logger.WithField("fields", restart).Warn("config changes take effect on restart")
+	}
+	if reflect.DeepEqual(reloaded, w.current) {
+		return
+	}
+	logger.Info("reloading config")
+	w.current = reloaded
+	w.apply(reloaded)
+}
@@ -0,0 +1,108 @@
+// Package cost estimates the monthly cost of RDS instances from a pricing
+// table.
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// HoursPerMonth is the average number of hours in a month AWS bills with.
+const HoursPerMonth = 730
+
+// Table holds on-demand prices by region. Prices are approximate and only
+// cover the instance, storage, provisioned IOPS and backup storage, not data
+// transfer or I/O requests.
+type Table struct {
+	// Version identifies the prices, it is reported with each estimate.
+	Version  string `json:"version"`
+	Currency string `json:"currency"`
+	// BackupChangeRate is the fraction of the storage assumed to change each
+	// day, backups beyond the free backup storage grow by it per day of
+	// retention.
+	BackupChangeRate float64           `json:"backupChangeRate"`
+	Regions          map[string]Prices `json:"regions"`
+}
+
+// Prices are the single-AZ prices of a region, Multi-AZ doubles the
+// instance, storage and IOPS prices.
+type Prices struct {
+	// Instances is the hourly price by engine and instance class.
+	Instances map[string]map[string]float64 `json:"instances"`
+	// Storage is the price of a GiB-month by storage type.
+	Storage map[string]float64 `json:"storage"`
+	// IOPS is the price of a provisioned IOPS-month.
+	IOPS float64 `json:"iops"`
+	// Backup is the price of a GiB-month of backup storage.
+	Backup float64 `json:"backup"`
+}
+
+// Instance describes the billed configuration of an instance.
+type Instance struct {
+	Region          string
+	Engine          string
+	InstanceClass   string
+	MultiAZ         bool
+	StorageType     string
+	Storage         int64
+	Iops            int64
+	BackupRetention int64
+}
+
+// Load reads a JSON pricing table.
+func Load(path string) (*Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a JSON pricing table.
+func Parse(data []byte) (*Table, error) {
+	t := &Table{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("invalid pricing table: %v", err)
+	}
+	if t.Version == "" {
+		return nil, fmt.Errorf("invalid pricing table: missing version")
+	}
+	if len(t.Regions) == 0 {
+		return nil, fmt.Errorf("invalid pricing table: no regions")
+	}
+	return t, nil
+}
+
+// Estimate returns the monthly cost of the instance. An empty storage type
+// is priced as gp2, the RDS default.
+func (t *Table) Estimate(i Instance) (float64, error) {
+	p, ok := t.Regions[i.Region]
+	if !ok {
+		return 0, fmt.Errorf("no prices for region %q", i.Region)
+	}
+	hourly, ok := p.Instances[i.Engine][i.InstanceClass]
+	if !ok {
+		return 0, fmt.Errorf("no price for %s instance class %q in %s", i.Engine, i.InstanceClass, i.Region)
+	}
+	storageType := i.StorageType
+	if storageType == "" {
+		storageType = "gp2"
+	}
+	gib, ok := p.Storage[storageType]
+	if !ok {
+		return 0, fmt.Errorf("no price for storage type %q in %s", storageType, i.Region)
+	}
+
+	monthly := hourly*HoursPerMonth + gib*float64(i.Storage)
+	if storageType == "io1" {
+		monthly += p.IOPS * float64(i.Iops)
+	}
+	if i.MultiAZ {
+		monthly *= 2
+	}
+	// Backup storage up to the allocated storage is free, it covers the
+	// full backup, only the daily changes kept are billed.
+	backup := float64(i.Storage) * t.BackupChangeRate * float64(i.BackupRetention)
+	return monthly + p.Backup*backup, nil
+}
@@ -0,0 +1,92 @@
+package cost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var table = &Table{
+	Version:          "test",
+	Currency:         "USD",
+	BackupChangeRate: 0.1,
+	Regions: map[string]Prices{
+		"us-west-2": {
+			Instances: map[string]map[string]float64{
+				"postgres": {"db.t2.small": 0.1},
+			},
+			Storage: map[string]float64{"gp2": 0.1, "io1": 0.2},
+			IOPS:    0.1,
+			Backup:  0.1,
+		},
+	},
+}
+
+func TestEstimate(t *testing.T) {
+	base := Instance{Region: "us-west-2", Engine: "postgres", InstanceClass: "db.t2.small", Storage: 100}
+	for _, test := range []struct {
+		name     string
+		change   func(i *Instance)
+		expected float64
+	}{
+		{"Defaults", func(i *Instance) {}, 73 + 10},
+		{"MultiAZ", func(i *Instance) { i.MultiAZ = true }, 2 * (73 + 10)},
+		{"ProvisionedIOPS", func(i *Instance) { i.StorageType = "io1"; i.Iops = 1000 }, 73 + 20 + 100},
+		// Ignored unless io1.
+		{"GeneralPurposeIOPS", func(i *Instance) { i.StorageType = "gp2"; i.Iops = 1000 }, 73 + 10},
+		{"Backups", func(i *Instance) { i.BackupRetention = 7 }, 73 + 10 + 7},
+		{"MultiAZBackups", func(i *Instance) { i.MultiAZ = true; i.BackupRetention = 7 }, 2*(73+10) + 7},
+	} {
+		i := base
+		test.change(&i)
+		estimate, err := table.Estimate(i)
+		require.NoError(t, err, test.name)
+		require.InDelta(t, test.expected, estimate, 0.001, test.name)
+	}
+}
+
+func TestEstimate_Errors(t *testing.T) {
+	base := Instance{Region: "us-west-2", Engine: "postgres", InstanceClass: "db.t2.small", Storage: 100}
+	for err, change := range map[string]func(i *Instance){
+		`no prices for region "eu-west-1"`:             func(i *Instance) { i.Region = "eu-west-1" },
+		`no price for mysql instance class`:            func(i *Instance) { i.Engine = "mysql" },
+		`no price for postgres instance class "db.x1"`: func(i *Instance) { i.InstanceClass = "db.x1" },
+		`no price for storage type "standard"`:         func(i *Instance) { i.StorageType = "standard" },
+	} {
+		i := base
+		change(&i)
+		_, e := table.Estimate(i)
+		require.Error(t, e, err)
+		require.Contains(t, e.Error(), err)
+	}
+}
+
+func TestLoad_Shipped(t *testing.T) {
+	shipped, err := Load("../../config/pricing.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, shipped.Version)
+	for region, prices := range shipped.Regions {
+		for _, engine := range []string{"postgres", "mysql", "mariadb"} {
+			_, err := shipped.Estimate(Instance{
+				Region:        region,
+				Engine:        engine,
+				InstanceClass: "db.t2.micro",
+				Storage:       20,
+			})
+			require.NoError(t, err, region+" "+engine)
+		}
+		require.NotZero(t, prices.IOPS, region)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for data, err := range map[string]string{
+		`{`:                      "invalid pricing table",
+		`{"regions": {"a": {}}}`: "missing version",
+		`{"version": "1"}`:       "no regions",
+	} {
+		_, e := Parse([]byte(data))
+		require.Error(t, e, data)
+		require.Contains(t, e.Error(), err, data)
+	}
+}
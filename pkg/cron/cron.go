@@ -0,0 +1,128 @@
+// Package cron matches times against five field cron expressions.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed cron expression of minute, hour, day of month, month and
+// day of week fields. Fields hold *, values, ranges, lists and steps, months
+// and weekdays may be given by their three letter English names.
+type Expr struct {
+	fields [5]uint64
+	// Like cron, when both day fields are restricted a day matching either
+	// matches.
+	anyDom, anyDow bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday as well.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Parse parses an expression like "* 8-19 * * mon-fri".
+func Parse(s string) (*Expr, error) {
+	parts := strings.Fields(s)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+	e := &Expr{anyDom: parts[2] == "*", anyDow: parts[4] == "*"}
+	for i, part := range parts {
+		bits, err := fields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", fields[i].name, part, err)
+		}
+		e.fields[i] = bits
+	}
+	if e.fields[4]&(1<<7) != 0 {
+		e.fields[4] |= 1
+	}
+	return e, nil
+}
+
+// Match reports whether the minute of t matches the expression.
+func (e *Expr) Match(t time.Time) bool {
+	has := func(i, v int) bool { return e.fields[i]&(1<<uint(v)) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(2, t.Day()), has(4, int(t.Weekday()))
+	switch {
+	case e.anyDom && e.anyDow:
+		return true
+	case e.anyDom:
+		return dow
+	case e.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", item[i+1:])
+			}
+			step = n
+			item = item[:i]
+		}
+
+		lo, hi := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %s ends before it starts", item)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
@@ -0,0 +1,52 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Errors(t *testing.T) {
+	for expr, err := range map[string]string{
+		"* * * *":          "expected 5 fields",
+		"60 * * * *":       "60 is outside 0-59",
+		"* 20-8 * * *":     "ends before it starts",
+		"* * * * fun":      `invalid value "fun"`,
+		"*/0 * * * *":      "invalid step",
+		"* * 0 * *":        "0 is outside 1-31",
+		"* * * 13 mon-fri": "13 is outside 1-12",
+	} {
+		_, e := Parse(expr)
+		require.Error(t, e, expr)
+		require.Contains(t, e.Error(), err, expr)
+	}
+}
+
+func TestExpr_Match(t *testing.T) {
+	// A Wednesday.
+	wed := time.Date(2018, 10, 17, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expr  string
+		time  time.Time
+		match bool
+	}{
+		{"* * * * *", wed, true},
+		{"* 8-19 * * mon-fri", wed.Add(8 * time.Hour), true},
+		{"* 8-19 * * mon-fri", wed.Add(20 * time.Hour), false},
+		{"* 8-19 * * mon-fri", wed.Add(3*24*time.Hour + 9*time.Hour), false},
+		{"*/15 * * * *", wed.Add(30 * time.Minute), true},
+		{"*/15 * * * *", wed.Add(31 * time.Minute), false},
+		{"0,30 9 * * *", wed.Add(9*time.Hour + 30*time.Minute), true},
+		{"* * * * 7", wed.Add(4 * 24 * time.Hour), true},
+		{"* * * dec *", wed, false},
+		// Either day field matches when both are restricted.
+		{"* * 1 * wed", wed, true},
+		{"* * 17 * mon", wed, true},
+		{"* * 1 * mon", wed, false},
+	} {
+		e, err := Parse(test.expr)
+		require.NoError(t, err, test.expr)
+		require.Equal(t, test.match, e.Match(test.time), "%s at %s", test.expr, test.time)
+	}
+}
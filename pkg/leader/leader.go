@@ -0,0 +1,330 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// RecordAnnotation is the annotation holding the leader record on the lock.
+const RecordAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// ErrLeadershipLost is returned from Run when the lease could not be renewed.
+var ErrLeadershipLost = errors.New("leader: leadership lost")
+
+// Config configures the leader election.
+type Config struct {
+	// Namespace and Name locate the ConfigMap used as the lock.
+	Namespace string
+	Name      string
+	// Identity uniquely identifies this candidate, usually the pod name.
+	Identity string
+	// LeaseDuration is how long standbys wait before taking over a lease
+	// that has not been renewed.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying a renewal before
+	// giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between acquire and renew attempts.
+	RetryPeriod time.Duration
+}
+
+// DefaultConfig returns a configuration with the default durations.
+func DefaultConfig() Config {
+	return Config{
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+}
+
+// Validate checks the durations are consistent.
+func (c Config) Validate() error {
+	if c.Namespace == "" || c.Name == "" {
+		return errors.New("leader: lock namespace and name are required")
+	}
+	if c.Identity == "" {
+		return errors.New("leader: identity is required")
+	}
+	if c.RetryPeriod <= 0 {
+		return errors.New("leader: retry period must be positive")
+	}
+	if c.RenewDeadline <= c.RetryPeriod {
+		return errors.New("leader: renew deadline must be greater than retry period")
+	}
+	if c.LeaseDuration <= c.RenewDeadline {
+		return errors.New("leader: lease duration must be greater than renew deadline")
+	}
+	return nil
+}
+
+// Record is the leader record stored on the lock.
+type Record struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// Lock stores a leader record. Implementations must fail Update with a
+// conflict if the lock changed since the last Get.
+type Lock interface {
+	Get() (*Record, error)
+	Create(Record) error
+	Update(Record) error
+}
+
+// NewConfigMapLock returns a lock backed by a ConfigMap annotation.
+func NewConfigMapLock(client corev1client.ConfigMapsGetter, namespace, name string) Lock {
+	return &configMapLock{client: client, namespace: namespace, name: name}
+}
+
+type configMapLock struct {
+	client    corev1client.ConfigMapsGetter
+	namespace string
+	name      string
+	cm        *corev1.ConfigMap
+}
+
+func (l *configMapLock) Get() (*Record, error) {
+	cm, err := l.client.ConfigMaps(l.namespace).Get(l.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	l.cm = cm
+
+	rec := &Record{}
+	if raw, ok := cm.Annotations[RecordAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), rec); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+func (l *configMapLock) Create(rec Record) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	cm, err := l.client.ConfigMaps(l.namespace).Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   l.namespace,
+			Name:        l.name,
+			Annotations: map[string]string{RecordAnnotation: string(raw)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+func (l *configMapLock) Update(rec Record) error {
+	if l.cm == nil {
+		return errors.New("leader: lock not initialized, call get or create first")
+	}
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	cm := l.cm.DeepCopy()
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[RecordAnnotation] = string(raw)
+	cm, err = l.client.ConfigMaps(l.namespace).Update(cm)
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+// Elector runs a leader election against a lock.
+type Elector struct {
+	cfg   Config
+	lock  Lock
+	clock clock.Clock
+
+	observed     Record
+	observedTime time.Time
+}
+
+// NewElector returns an elector using the given lock.
+func NewElector(cfg Config, lock Lock) (*Elector, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Elector{cfg: cfg, lock: lock, clock: clock.RealClock{}}, nil
+}
+
+// Run blocks until leadership is acquired, then calls run with a context that
+// is cancelled when leadership is lost or ctx is done. Run waits for run to
+// return before returning itself, so callers can rely on reconciliation having
+// stopped. ErrLeadershipLost is returned if the lease could not be renewed.
+func (e *Elector) Run(ctx context.Context, run func(context.Context)) error {
+	if !e.acquire(ctx) {
+		return ctx.Err()
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(runCtx)
+	}()
+
+	lost := e.renew(runCtx, done)
+	cancel()
+	<-done
+
+	if lost {
+		return ErrLeadershipLost
+	}
+	e.release()
+	return nil
+}
+
+// IsLeader reports whether this candidate held the lease at the last attempt.
+func (e *Elector) IsLeader() bool {
+	return e.observed.HolderIdentity == e.cfg.Identity
+}
+
+func (e *Elector) acquire(ctx context.Context) bool {
+	logger := log.WithField("lock", e.cfg.Namespace+"/"+e.cfg.Name).
+		WithField("identity", e.cfg.Identity)
+	logger.Info("attempting to acquire leader lease")
+
+	for {
+		if e.tryAcquireOrRenew() {
+			logger.Info("acquired leader lease")
+			return true
+		}
+		logger.WithField("leader", e.observed.HolderIdentity).Debug("waiting for leader lease")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-e.clock.After(e.cfg.RetryPeriod):
+		}
+	}
+}
+
+// renew keeps renewing the lease until ctx is done, run returns or a renewal
+// does not succeed within the renew deadline. It returns true when the lease
+// was lost.
+func (e *Elector) renew(ctx context.Context, done <-chan struct{}) bool {
+	logger := log.WithField("lock", e.cfg.Namespace+"/"+e.cfg.Name).
+		WithField("identity", e.cfg.Identity)
+
+	lastRenew := e.clock.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-done:
+			return false
+		case <-e.clock.After(e.cfg.RetryPeriod):
+		}
+
+		if e.tryAcquireOrRenew() {
+			lastRenew = e.clock.Now()
+			continue
+		}
+		if e.clock.Since(lastRenew) >= e.cfg.RenewDeadline {
+			logger.Error("failed to renew leader lease, stopping")
+			return true
+		}
+		logger.Warn("failed to renew leader lease, retrying")
+	}
+}
+
+func (e *Elector) tryAcquireOrRenew() bool {
+	now := metav1.NewTime(e.clock.Now())
+	rec := Record{
+		HolderIdentity:       e.cfg.Identity,
+		LeaseDurationSeconds: int(e.cfg.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	old, err := e.lock.Get()
+	if err != nil {
+		if !k8errors.IsNotFound(err) {
+			log.WithError(err).Error("failed to get leader lock")
+			return false
+		}
+		if err := e.lock.Create(rec); err != nil {
+			log.WithError(err).Error("failed to create leader lock")
+			return false
+		}
+		e.observe(rec)
+		return true
+	}
+
+	// Track when the record last changed using the local clock, so clock skew
+	// between candidates does not matter.
+	if !recordEqual(*old, e.observed) {
+		e.observed = *old
+		e.observedTime = e.clock.Now()
+	}
+	if old.HolderIdentity != "" && old.HolderIdentity != e.cfg.Identity &&
+		e.observedTime.Add(e.cfg.LeaseDuration).After(e.clock.Now()) {
+		return false
+	}
+
+	if old.HolderIdentity == e.cfg.Identity {
+		rec.AcquireTime = old.AcquireTime
+		rec.LeaderTransitions = old.LeaderTransitions
+	} else {
+		rec.LeaderTransitions = old.LeaderTransitions + 1
+	}
+
+	if err := e.lock.Update(rec); err != nil {
+		log.WithError(err).Debug("failed to update leader lock")
+		return false
+	}
+	e.observe(rec)
+	return true
+}
+
+// release clears the holder so a standby can take over without waiting for
+// the lease to expire.
+func (e *Elector) release() {
+	if !e.IsLeader() {
+		return
+	}
+	rec := e.observed
+	rec.HolderIdentity = ""
+	if err := e.lock.Update(rec); err != nil {
+		log.WithError(err).Warn("failed to release leader lock")
+		return
+	}
+	e.observe(rec)
+}
+
+func (e *Elector) observe(rec Record) {
+	e.observed = rec
+	e.observedTime = e.clock.Now()
+}
+
+func recordEqual(a, b Record) bool {
+	return a.HolderIdentity == b.HolderIdentity &&
+		a.LeaseDurationSeconds == b.LeaseDurationSeconds &&
+		a.AcquireTime.Equal(&b.AcquireTime) &&
+		a.RenewTime.Equal(&b.RenewTime) &&
+		a.LeaderTransitions == b.LeaderTransitions
+}
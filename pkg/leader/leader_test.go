@@ -0,0 +1,162 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// memoryStore is a shared record store with optimistic concurrency, each
+// candidate gets its own memoryLock view on it.
+type memoryStore struct {
+	mu      sync.Mutex
+	rec     *Record
+	version int
+	fail    bool
+}
+
+type memoryLock struct {
+	store   *memoryStore
+	version int
+}
+
+func (l *memoryLock) Get() (*Record, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.fail {
+		return nil, errors.New("unavailable")
+	}
+	if l.store.rec == nil {
+		return nil, k8errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "lock")
+	}
+	l.version = l.store.version
+	rec := *l.store.rec
+	return &rec, nil
+}
+
+func (l *memoryLock) Create(rec Record) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.rec != nil {
+		return k8errors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "lock")
+	}
+	l.store.rec = &rec
+	l.store.version++
+	l.version = l.store.version
+	return nil
+}
+
+func (l *memoryLock) Update(rec Record) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.fail {
+		return errors.New("unavailable")
+	}
+	if l.version != l.store.version {
+		return k8errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "lock", nil)
+	}
+	l.store.rec = &rec
+	l.store.version++
+	l.version = l.store.version
+	return nil
+}
+
+func elector(t *testing.T, store *memoryStore, id string, c clock.Clock) *Elector {
+	cfg := DefaultConfig()
+	cfg.Namespace = "default"
+	cfg.Name = "rds-operator-lock"
+	cfg.Identity = id
+	e, err := NewElector(cfg, &memoryLock{store: store})
+	require.NoError(t, err)
+	e.clock = c
+	return e
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := DefaultConfig()
+	require.Error(t, cfg.Validate())
+
+	cfg.Namespace, cfg.Name, cfg.Identity = "default", "lock", "a"
+	require.NoError(t, cfg.Validate())
+
+	cfg.LeaseDuration = cfg.RenewDeadline
+	require.Error(t, cfg.Validate())
+}
+
+func TestElector_StandbyWaitsForExpiry(t *testing.T) {
+	store := &memoryStore{}
+	c := clock.NewFakeClock(time.Now())
+	a := elector(t, store, "a", c)
+	b := elector(t, store, "b", c)
+
+	require.True(t, a.tryAcquireOrRenew())
+	require.False(t, b.tryAcquireOrRenew())
+	require.Equal(t, "a", b.observed.HolderIdentity)
+
+	c.Step(10 * time.Second)
+	require.True(t, a.tryAcquireOrRenew())
+	require.False(t, b.tryAcquireOrRenew())
+
+	c.Step(16 * time.Second)
+	require.True(t, b.tryAcquireOrRenew())
+	require.Equal(t, "b", store.rec.HolderIdentity)
+	require.Equal(t, 1, store.rec.LeaderTransitions)
+
+	require.False(t, a.tryAcquireOrRenew())
+	require.False(t, a.IsLeader())
+}
+
+func TestElector_ReleaseAllowsImmediateTakeover(t *testing.T) {
+	store := &memoryStore{}
+	c := clock.NewFakeClock(time.Now())
+	a := elector(t, store, "a", c)
+	b := elector(t, store, "b", c)
+
+	require.True(t, a.tryAcquireOrRenew())
+	a.release()
+	require.True(t, b.tryAcquireOrRenew())
+}
+
+func TestElector_RunStopsOnLostLease(t *testing.T) {
+	store := &memoryStore{}
+	e := elector(t, store, "a", clock.RealClock{})
+	e.cfg.RetryPeriod = 5 * time.Millisecond
+	e.cfg.RenewDeadline = 20 * time.Millisecond
+	e.cfg.LeaseDuration = 50 * time.Millisecond
+
+	started := make(chan struct{})
+	stopped := false
+	err := e.Run(context.Background(), func(ctx context.Context) {
+		close(started)
+		store.mu.Lock()
+		store.fail = true
+		store.mu.Unlock()
+		<-ctx.Done()
+		stopped = true
+	})
+
+	<-started
+	require.Equal(t, ErrLeadershipLost, err)
+	require.True(t, stopped)
+}
+
+func TestElector_RunCancelled(t *testing.T) {
+	store := &memoryStore{rec: &Record{HolderIdentity: "b"}}
+	e := elector(t, store, "a", clock.RealClock{})
+	e.cfg.RetryPeriod = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	called := false
+	err := e.Run(ctx, func(context.Context) { called = true })
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.False(t, called)
+}
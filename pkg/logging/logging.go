@@ -0,0 +1,106 @@
+// Package logging redacts secrets from log entries and names the fields
+// shared by the operator's logs.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	log "github.com/sirupsen/logrus"
+)
+
+// Fields shared by the operator's logs.
+const (
+	// FieldDatabase and FieldNamespace name the Database being synced.
+	FieldDatabase  = "database"
+	FieldNamespace = "namespace"
+	// FieldIdentifier is the RDS instance identifier.
+	FieldIdentifier = "identifier"
+	// FieldOperation is the AWS API operation.
+	FieldOperation = "operation"
+	// FieldAWSRequestID is the ID AWS assigned to the request.
+	FieldAWSRequestID = "awsRequestId"
+	// FieldReconcileID correlates the logs of one sync of an object.
+	FieldReconcileID = "reconcileId"
+)
+
+// Formatter redacts the fields and message of each entry, then formats it
+// with the wrapped formatter. Errors from AWS add the operation and request
+// ID fields.
+type Formatter struct {
+	log.Formatter
+}
+
+// Format implements log.Formatter.
+func (f Formatter) Format(e *log.Entry) ([]byte, error) {
+	data := make(log.Fields, len(e.Data)+2)
+	for k, v := range e.Data {
+		data[k] = Redact(v)
+	}
+	if err, ok := e.Data[log.ErrorKey].(error); ok {
+		for k, v := range ErrorFields(err) {
+			if _, ok := data[k]; !ok {
+				data[k] = v
+			}
+		}
+	}
+	redacted := *e
+	redacted.Data = data
+	redacted.Message = RedactString(e.Message)
+	return f.Formatter.Format(&redacted)
+}
+
+// ErrorFields returns the AWS operation and request ID of the error, if
+// known.
+func ErrorFields(err error) log.Fields {
+	fields := log.Fields{}
+	if op, ok := err.(interface{ Operation() string }); ok {
+		fields[FieldOperation] = op.Operation()
+	}
+	if rf, ok := err.(awserr.RequestFailure); ok && rf.RequestID() != "" {
+		fields[FieldAWSRequestID] = rf.RequestID()
+	}
+	return fields
+}
+
+// operationError adds the operation to a failed AWS request, the error keeps
+// its code, status and request ID.
+type operationError struct {
+	awserr.RequestFailure
+	operation string
+}
+
+func (e operationError) Operation() string { return e.operation }
+
+// WithOperation records the operation on AWS request failures, other errors
+// are returned unchanged.
+func WithOperation(operation string, err error) error {
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		if _, ok := err.(operationError); !ok {
+			return operationError{RequestFailure: rf, operation: operation}
+		}
+	}
+	return err
+}
+
+type reconcileKey struct{}
+
+// NewReconcileID returns a random reconcile ID.
+func NewReconcileID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithReconcileID returns a context carrying the reconcile ID.
+func WithReconcileID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, reconcileKey{}, id)
+}
+
+// ReconcileID returns the reconcile ID of the context, empty if it has none.
+func ReconcileID(ctx context.Context) string {
+	id, _ := ctx.Value(reconcileKey{}).(string)
+	return id
+}
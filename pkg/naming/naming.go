@@ -0,0 +1,114 @@
+// Package naming renders RDS instance identifiers from a template.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the maximum length of an RDS instance identifier.
+const MaxLength = 63
+
+// hashLength is the length of the hash suffix of altered identifiers.
+const hashLength = 8
+
+// DefaultTemplate names instances namespace-name.
+const DefaultTemplate = "{namespace}-{name}"
+
+var (
+	placeholder = regexp.MustCompile(`\{[^}]*\}`)
+	invalid     = regexp.MustCompile(`[^a-z0-9-]+`)
+	hyphens     = regexp.MustCompile(`-{2,}`)
+	valid       = regexp.MustCompile(`^[a-z]([a-z0-9]|-[a-z0-9])*$`)
+)
+
+// Template renders identifiers from the {cluster}, {namespace} and {name}
+// placeholders.
+type Template struct {
+	s string
+}
+
+// Parse parses a template. Templates must contain {namespace} and {name} so
+// identifiers are unique within a cluster.
+func Parse(s string) (*Template, error) {
+	for _, p := range placeholder.FindAllString(s, -1) {
+		switch p {
+		case "{cluster}", "{namespace}", "{name}":
+		default:
+			return nil, fmt.Errorf("unknown placeholder %s, expected {cluster}, {namespace} or {name}", p)
+		}
+	}
+	for _, p := range []string{"{namespace}", "{name}"} {
+		if !strings.Contains(s, p) {
+			return nil, fmt.Errorf("template %q is missing %s", s, p)
+		}
+	}
+	return &Template{s: s}, nil
+}
+
+// UsesCluster reports whether the template contains {cluster}.
+func (t *Template) UsesCluster() bool { return strings.Contains(t.s, "{cluster}") }
+
+func (t *Template) String() string { return t.s }
+
+// Identifier renders the identifier of a database. Identifiers are
+// lowercased, invalid characters and repeated hyphens are replaced by a
+// single hyphen and identifiers not starting with a letter are prefixed with
+// "db-". Identifiers altered beyond lowercasing, or longer than MaxLength,
+// end with a hash of the rendered template so they stay unique.
+func (t *Template) Identifier(cluster, namespace, name string) string {
+	rendered := strings.NewReplacer(
+		"{cluster}", cluster,
+		"{namespace}", namespace,
+		"{name}", name,
+	).Replace(t.s)
+	rendered = strings.ToLower(rendered)
+
+	id := invalid.ReplaceAllString(rendered, "-")
+	id = hyphens.ReplaceAllString(id, "-")
+	id = strings.Trim(id, "-")
+	if id == "" || id[0] < 'a' || id[0] > 'z' {
+		id = strings.TrimRight("db-"+id, "-")
+	}
+	if id == rendered && len(id) <= MaxLength {
+		return id
+	}
+	return truncate(id, MaxLength-hashLength-1) + "-" + hash(rendered)
+}
+
+// Suffix appends a suffix to an identifier, like "-replacement",
+// truncating the identifier with a hash when the result would be longer than
+// MaxLength.
+func Suffix(id, suffix string) string {
+	if len(id)+len(suffix) <= MaxLength {
+		return id + suffix
+	}
+	return truncate(id, MaxLength-len(suffix)-hashLength-1) + "-" + hash(id) + suffix
+}
+
+// Validate checks an identifier is valid for RDS: 1 to 63 letters, digits or
+// hyphens starting with a letter, without repeated or trailing hyphens.
+func Validate(id string) error {
+	if len(id) > MaxLength {
+		return fmt.Errorf("identifier %q is longer than %d characters", id, MaxLength)
+	}
+	if !valid.MatchString(id) {
+		return fmt.Errorf("identifier %q must start with a letter and contain only lowercase letters, digits and single hyphens", id)
+	}
+	return nil
+}
+
+func truncate(id string, n int) string {
+	if len(id) > n {
+		id = id[:n]
+	}
+	return strings.TrimRight(id, "-")
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
@@ -0,0 +1,70 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Errors(t *testing.T) {
+	for template, err := range map[string]string{
+		"{namespace}-{name}-{zone}": "unknown placeholder {zone}",
+		"{cluster}-{name}":          "missing {namespace}",
+		"{namespace}":               "missing {name}",
+	} {
+		_, e := Parse(template)
+		require.Error(t, e, template)
+		require.Contains(t, e.Error(), err, template)
+	}
+}
+
+func TestTemplate_Identifier(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	for _, test := range []struct {
+		template, cluster, namespace, name string
+		expected                           string
+	}{
+		{DefaultTemplate, "", "default", "app", "default-app"},
+		{"{cluster}-{namespace}-{name}", "Prod", "default", "app", "prod-default-app"},
+		{DefaultTemplate, "", "default", "app.v2", "default-app-v2-" + hash("default-app.v2")},
+		{DefaultTemplate, "", "default", "my--app", "default-my-app-" + hash("default-my--app")},
+		{DefaultTemplate, "", "1team", "app", "db-1team-app-" + hash("1team-app")},
+		{DefaultTemplate, "", "default", long, "default-" + long[:46] + "-" + hash("default-"+long)},
+	} {
+		tmpl, err := Parse(test.template)
+		require.NoError(t, err)
+		id := tmpl.Identifier(test.cluster, test.namespace, test.name)
+		require.Equal(t, test.expected, id)
+		require.NoError(t, Validate(id))
+	}
+}
+
+func TestTemplate_IdentifierUnique(t *testing.T) {
+	tmpl, err := Parse(DefaultTemplate)
+	require.NoError(t, err)
+	require.NotEqual(t,
+		tmpl.Identifier("", "default", "app.v2"),
+		tmpl.Identifier("", "default", "app-v2"))
+	long := strings.Repeat("a", 70)
+	require.NotEqual(t,
+		tmpl.Identifier("", "default", long+"1"),
+		tmpl.Identifier("", "default", long+"2"))
+}
+
+func TestSuffix(t *testing.T) {
+	require.Equal(t, "default-app-replacement", Suffix("default-app", "-replacement"))
+
+	id := strings.Repeat("a", MaxLength)
+	suffixed := Suffix(id, "-replacement")
+	require.Len(t, suffixed, MaxLength)
+	require.True(t, strings.HasSuffix(suffixed, "-"+hash(id)+"-replacement"))
+	require.NoError(t, Validate(suffixed))
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate("default-app"))
+	for _, id := range []string{"", "1app", "app-", "my--app", "app_1", strings.Repeat("a", 64)} {
+		require.Error(t, Validate(id), id)
+	}
+}
@@ -0,0 +1,105 @@
+package rds
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runAction runs the action requested with the action annotation once the
+// instance is available, records the result in status.lastAction and removes
+// the annotation. Actions are not retried, the annotation is set again to
+// repeat a failed action.
+func (h *Handler) runAction(o *v1alpha1.Database) (handled bool, err error) {
+	action := o.Annotations[v1alpha1.AnnotationAction]
+	logger := h.logger(o).WithField("action", action)
+
+	var message string
+	switch action {
+	case v1alpha1.ActionReboot, v1alpha1.ActionFailover, v1alpha1.ActionApplyPendingMaintenance:
+		var db *rds.DBInstance
+		if db, err = h.getDB(o); err != nil || db == nil {
+			return false, err
+		}
+		// Busy instances reject the actions, they run once it is
+		// available. Stopped instances stay stopped, the action fails.
+		if status := aws.StringValue(db.DBInstanceStatus); status != "available" && status != "stopped" {
+			logger.WithField("status", status).Debug("waiting for instance to run action")
+			return false, nil
+		}
+		// Transient errors keep the action requested, the sync retries it.
+		if message, err = h.act(db, action); isTransient(err) {
+			return false, err
+		}
+	default:
+		err = fmt.Errorf("unknown action %q, expected %s, %s or %s", action,
+			v1alpha1.ActionReboot, v1alpha1.ActionFailover, v1alpha1.ActionApplyPendingMaintenance)
+	}
+
+	status := &v1alpha1.ActionStatus{
+		Action:  action,
+		Time:    metav1.Now(),
+		Result:  v1alpha1.ActionResultSucceeded,
+		Message: message,
+	}
+	if err != nil {
+		logger.WithError(err).Warn("action failed")
+		status.Result = v1alpha1.ActionResultFailed
+		status.Message = err.Error()
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "ActionFailed",
+			"Action "+action+" failed: "+err.Error())
+	} else {
+		logger.Info("action ran")
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "ActionSucceeded",
+			"Action "+action+": "+message)
+	}
+
+	copy := o.DeepCopy()
+	delete(copy.Annotations, v1alpha1.AnnotationAction)
+	copy.Status.LastAction = status
+	return true, h.sdk.Update(copy)
+}
+
+func (h *Handler) act(db *rds.DBInstance, action string) (string, error) {
+	switch action {
+	case v1alpha1.ActionReboot:
+		_, err := h.rds.RebootDBInstance(&rds.RebootDBInstanceInput{DBInstanceIdentifier: db.DBInstanceIdentifier})
+		return "rebooting instance " + aws.StringValue(db.DBInstanceIdentifier), err
+	case v1alpha1.ActionFailover:
+		_, err := h.rds.RebootDBInstance(&rds.RebootDBInstanceInput{
+			DBInstanceIdentifier: db.DBInstanceIdentifier,
+			ForceFailover:        aws.Bool(true),
+		})
+		return "failing over instance " + aws.StringValue(db.DBInstanceIdentifier), err
+	}
+
+	out, err := h.rds.DescribePendingMaintenanceActions(&rds.DescribePendingMaintenanceActionsInput{
+		ResourceIdentifier: db.DBInstanceArn,
+	})
+	if err != nil {
+		return "", err
+	}
+	var applied []string
+	for _, resource := range out.PendingMaintenanceActions {
+		for _, pending := range resource.PendingMaintenanceActionDetails {
+			_, err := h.rds.ApplyPendingMaintenanceAction(&rds.ApplyPendingMaintenanceActionInput{
+				ResourceIdentifier: resource.ResourceIdentifier,
+				ApplyAction:        pending.Action,
+				OptInType:          str("immediate"),
+			})
+			if err != nil {
+				return "", err
+			}
+			applied = append(applied, aws.StringValue(pending.Action))
+		}
+	}
+	if len(applied) == 0 {
+		return "no pending maintenance actions", nil
+	}
+	return "applying " + strings.Join(applied, ", "), nil
+}
@@ -0,0 +1,112 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func annotateAction(s *scenario, name, action string) {
+	db := s.sdk.database(name)
+	db.Annotations = map[string]string{v1alpha1.AnnotationAction: action}
+	s.apply(db)
+}
+
+func TestActions_Reboot(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	annotateAction(s, "app", v1alpha1.ActionReboot)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("RebootDBInstance"))
+	require.Equal(t, fake.StatusRebooting, *s.rds.Instance("default-app").DBInstanceStatus)
+
+	db := s.sdk.database("app")
+	require.NotContains(t, db.Annotations, v1alpha1.AnnotationAction)
+	require.Equal(t, v1alpha1.ActionReboot, db.Status.LastAction.Action)
+	require.Equal(t, v1alpha1.ActionResultSucceeded, db.Status.LastAction.Result)
+	require.Len(t, events(s, "ActionSucceeded"), 1)
+
+	// The action is consumed once.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("RebootDBInstance"))
+}
+
+func TestActions_WaitsForAvailable(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	annotateAction(s, "app", v1alpha1.ActionReboot)
+	require.NoError(t, s.sync("app"))
+	annotateAction(s, "app", v1alpha1.ActionReboot)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("RebootDBInstance"))
+	require.Contains(t, s.sdk.database("app").Annotations, v1alpha1.AnnotationAction)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("RebootDBInstance"))
+	require.NotContains(t, s.sdk.database("app").Annotations, v1alpha1.AnnotationAction)
+}
+
+func TestActions_Failover(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	// The test instance is not Multi-AZ.
+	annotateAction(s, "app", v1alpha1.ActionFailover)
+	require.NoError(t, s.sync("app"))
+	db := s.sdk.database("app")
+	require.Equal(t, v1alpha1.ActionResultFailed, db.Status.LastAction.Result)
+	require.Contains(t, db.Status.LastAction.Message, "not Multi-AZ")
+	require.NotContains(t, db.Annotations, v1alpha1.AnnotationAction)
+	require.Len(t, events(s, "ActionFailed"), 1)
+}
+
+func TestActions_ApplyPendingMaintenance(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+	s.rds.AddPendingMaintenance("default-app", "system-update", "OS upgrade")
+
+	annotateAction(s, "app", v1alpha1.ActionApplyPendingMaintenance)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ApplyPendingMaintenanceAction"))
+	require.Equal(t, "applying system-update", s.sdk.database("app").Status.LastAction.Message)
+
+	s.rds.Advance(2 * time.Minute)
+	annotateAction(s, "app", v1alpha1.ActionApplyPendingMaintenance)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ApplyPendingMaintenanceAction"))
+	require.Equal(t, "no pending maintenance actions", s.sdk.database("app").Status.LastAction.Message)
+}
+
+func TestActions_Unknown(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	annotateAction(s, "app", "restart")
+	require.NoError(t, s.sync("app"))
+	db := s.sdk.database("app")
+	require.Equal(t, v1alpha1.ActionResultFailed, db.Status.LastAction.Result)
+	require.Contains(t, db.Status.LastAction.Message, `unknown action "restart"`)
+}
+
+func TestActions_TransientError(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	annotateAction(s, "app", v1alpha1.ActionReboot)
+	s.rds.Fail("RebootDBInstance", fake.Throttling(), 1)
+	require.Error(t, s.sync("app"))
+	db := s.sdk.database("app")
+	require.Nil(t, db.Status.LastAction)
+	require.Contains(t, db.Annotations, v1alpha1.AnnotationAction)
+	require.Empty(t, events(s, "ActionFailed"))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("RebootDBInstance"))
+	require.Equal(t, v1alpha1.ActionResultSucceeded, s.sdk.database("app").Status.LastAction.Result)
+}
@@ -0,0 +1,364 @@
+package rds
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// CacheConfig configures the instance cache.
+type CacheConfig struct {
+	// Interval between listings of all instances. Cached instances are used
+	// for twice as long, in case a listing fails.
+	Interval time.Duration
+	// TagsTTL is how long the tags of an instance are used before they are
+	// listed again.
+	TagsTTL time.Duration
+}
+
+type cachedInstance struct {
+	db      *rds.DBInstance
+	fetched time.Time
+}
+
+type cachedTags struct {
+	tags    []*rds.Tag
+	fetched time.Time
+}
+
+// resourceTagger lists the tags of many resources with one call, it is
+// implemented by the resource groups tagging API client.
+type resourceTagger interface {
+	GetResourcesPages(*resourcegroupstaggingapi.GetResourcesInput,
+		func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool) error
+}
+
+// instanceCache serves single instance describes and tag listings from a
+// periodic listing of all instances, shared by every sync. Writes through
+// the cache invalidate the instance they change, the next lookup describes
+// it again. Other calls go straight to the client.
+type instanceCache struct {
+	rdsiface.RDSAPI
+	tagger resourceTagger
+	cfg    CacheConfig
+	clock  clock.Clock
+
+	mu        sync.Mutex
+	instances map[string]cachedInstance
+	tags      map[string]cachedTags
+	// listed is the start of the last complete listing, instances missing
+	// from it do not exist unless they were written since.
+	listed  time.Time
+	written map[string]time.Time
+}
+
+func newInstanceCache(client rdsiface.RDSAPI, tagger resourceTagger, cfg CacheConfig) *instanceCache {
+	return &instanceCache{
+		RDSAPI:    client,
+		tagger:    tagger,
+		cfg:       cfg,
+		clock:     clock.RealClock{},
+		instances: map[string]cachedInstance{},
+		tags:      map[string]cachedTags{},
+		written:   map[string]time.Time{},
+	}
+}
+
+// Run refreshes the cache every interval until ctx is done.
+func (c *instanceCache) Run(ctx context.Context) {
+	log.WithField("interval", c.cfg.Interval).Info("starting instance cache")
+	for {
+		if err := c.Refresh(); err != nil {
+			log.WithError(err).Warn("listing instances failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(c.cfg.Interval):
+		}
+	}
+}
+
+// Refresh lists all instances and the tags missing from the cache or older
+// than the tags TTL. Only a failed listing of the instances is returned,
+// tags that cannot be listed keep their previous entry.
+func (c *instanceCache) Refresh() error {
+	start := c.clock.Now()
+	var instances []*rds.DBInstance
+	err := c.RDSAPI.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{},
+		func(out *rds.DescribeDBInstancesOutput, last bool) bool {
+			instances = append(instances, out.DBInstances...)
+			return true
+		})
+	if err != nil {
+		return err
+	}
+
+	listed := map[string]cachedInstance{}
+	for _, db := range instances {
+		listed[aws.StringValue(db.DBInstanceIdentifier)] = cachedInstance{db: db, fetched: start}
+	}
+	c.mu.Lock()
+	for id, i := range c.instances {
+		// Instances written or described during the listing are newer.
+		if i.fetched.After(start) {
+			listed[id] = i
+		}
+	}
+	for id, t := range c.written {
+		if t.After(start) {
+			delete(listed, id)
+		} else {
+			delete(c.written, id)
+		}
+	}
+	c.instances = listed
+	c.listed = start
+	arns := map[string]bool{}
+	for _, i := range listed {
+		arns[aws.StringValue(i.db.DBInstanceArn)] = true
+	}
+	for arn := range c.tags {
+		if !arns[arn] {
+			delete(c.tags, arn)
+		}
+	}
+	c.mu.Unlock()
+
+	var stale []string
+	for arn := range arns {
+		if _, ok := c.cachedTags(arn); !ok {
+			stale = append(stale, arn)
+		}
+	}
+	if len(stale) > 0 {
+		c.refreshTags(stale)
+	}
+	return nil
+}
+
+// refreshTags caches the tags of the instances from one listing of all
+// tagged RDS instances. If that listing fails the tags are listed per
+// instance.
+func (c *instanceCache) refreshTags(arns []string) {
+	now := c.clock.Now()
+	tags := map[string][]*rds.Tag{}
+	err := c.tagger.GetResourcesPages(&resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []*string{aws.String("rds:db")},
+	}, func(out *resourcegroupstaggingapi.GetResourcesOutput, last bool) bool {
+		for _, r := range out.ResourceTagMappingList {
+			arn := aws.StringValue(r.ResourceARN)
+			for _, t := range r.Tags {
+				tags[arn] = append(tags[arn], &rds.Tag{Key: t.Key, Value: t.Value})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.WithError(err).Warn("listing tagged instances failed, listing tags per instance")
+		for _, arn := range arns {
+			if _, err := c.fetchTags(&rds.ListTagsForResourceInput{ResourceName: str(arn)}); err != nil {
+				log.WithError(err).WithField("arn", arn).Warn("listing tags failed")
+			}
+		}
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, arn := range arns {
+		if written, ok := c.written[arn]; !ok || !written.After(now) {
+			c.tags[arn] = cachedTags{tags: tags[arn], fetched: now}
+		}
+	}
+}
+
+// DescribeDBInstances serves describes of a single instance from the cache.
+func (c *instanceCache) DescribeDBInstances(in *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	id := aws.StringValue(in.DBInstanceIdentifier)
+	if id == "" || len(in.Filters) > 0 || in.Marker != nil {
+		return c.RDSAPI.DescribeDBInstances(in)
+	}
+
+	if db, found, ok := c.lookup(id); ok {
+		cacheLookups.WithLabelValues("hit").Inc()
+		if !found {
+			return nil, awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance "+id+" not found.", nil)
+		}
+		return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{db}}, nil
+	}
+	cacheLookups.WithLabelValues("miss").Inc()
+
+	now := c.clock.Now()
+	out, err := c.RDSAPI.DescribeDBInstances(in)
+	if err != nil || len(out.DBInstances) == 0 {
+		return out, err
+	}
+	c.mu.Lock()
+	if written, ok := c.written[id]; !ok || !written.After(now) {
+		c.instances[id] = cachedInstance{db: copyDB(out.DBInstances[0]), fetched: now}
+	}
+	c.mu.Unlock()
+	return out, nil
+}
+
+// lookup returns the cached instance, found is false if the instance is
+// known not to exist and ok is false if the cache cannot tell.
+func (c *instanceCache) lookup(id string) (db *rds.DBInstance, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	maxAge := 2 * c.cfg.Interval
+	if i, cached := c.instances[id]; cached {
+		if now.Sub(i.fetched) < maxAge {
+			return copyDB(i.db), true, true
+		}
+		return nil, false, false
+	}
+	if c.listed.IsZero() || now.Sub(c.listed) >= maxAge {
+		return nil, false, false
+	}
+	if written, ok := c.written[id]; ok && !written.Before(c.listed) {
+		return nil, false, false
+	}
+	return nil, false, true
+}
+
+// ListTagsForResource serves tag listings from the cache.
+func (c *instanceCache) ListTagsForResource(in *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+	arn := aws.StringValue(in.ResourceName)
+	if tags, ok := c.cachedTags(arn); ok && len(in.Filters) == 0 {
+		cacheLookups.WithLabelValues("hit").Inc()
+		return &rds.ListTagsForResourceOutput{TagList: copyTags(tags)}, nil
+	}
+	cacheLookups.WithLabelValues("miss").Inc()
+	return c.fetchTags(in)
+}
+
+func (c *instanceCache) fetchTags(in *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+	arn := aws.StringValue(in.ResourceName)
+	now := c.clock.Now()
+	out, err := c.RDSAPI.ListTagsForResource(in)
+	if err != nil || len(in.Filters) > 0 {
+		return out, err
+	}
+	c.mu.Lock()
+	if written, ok := c.written[arn]; !ok || !written.After(now) {
+		c.tags[arn] = cachedTags{tags: copyTags(out.TagList), fetched: now}
+	}
+	c.mu.Unlock()
+	return out, nil
+}
+
+func (c *instanceCache) cachedTags(arn string) ([]*rds.Tag, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tags[arn]
+	if !ok || c.clock.Since(t.fetched) >= c.cfg.TagsTTL {
+		return nil, false
+	}
+	return t.tags, true
+}
+
+// invalidate drops instances or tags, by identifier or ARN, after a write.
+func (c *instanceCache) invalidate(keys ...*string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		k := aws.StringValue(key)
+		for id, i := range c.instances {
+			if id == k || aws.StringValue(i.db.DBInstanceArn) == k {
+				delete(c.instances, id)
+				c.written[id] = now
+			}
+		}
+		delete(c.instances, k)
+		delete(c.tags, k)
+		c.written[k] = now
+	}
+}
+
+func (c *instanceCache) AddTagsToResource(in *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+	defer c.invalidate(in.ResourceName)
+	return c.RDSAPI.AddTagsToResource(in)
+}
+
+func (c *instanceCache) RemoveTagsFromResource(in *rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error) {
+	defer c.invalidate(in.ResourceName)
+	return c.RDSAPI.RemoveTagsFromResource(in)
+}
+
+func (c *instanceCache) CreateDBInstance(in *rds.CreateDBInstanceInput) (*rds.CreateDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.CreateDBInstance(in)
+}
+
+func (c *instanceCache) CreateDBInstanceReadReplica(in *rds.CreateDBInstanceReadReplicaInput) (*rds.CreateDBInstanceReadReplicaOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.CreateDBInstanceReadReplica(in)
+}
+
+func (c *instanceCache) RestoreDBInstanceFromDBSnapshot(in *rds.RestoreDBInstanceFromDBSnapshotInput) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.RestoreDBInstanceFromDBSnapshot(in)
+}
+
+func (c *instanceCache) ModifyDBInstance(in *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier, in.NewDBInstanceIdentifier)
+	return c.RDSAPI.ModifyDBInstance(in)
+}
+
+func (c *instanceCache) PromoteReadReplica(in *rds.PromoteReadReplicaInput) (*rds.PromoteReadReplicaOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.PromoteReadReplica(in)
+}
+
+func (c *instanceCache) DeleteDBInstance(in *rds.DeleteDBInstanceInput) (*rds.DeleteDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.DeleteDBInstance(in)
+}
+
+func (c *instanceCache) RebootDBInstance(in *rds.RebootDBInstanceInput) (*rds.RebootDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.RebootDBInstance(in)
+}
+
+func (c *instanceCache) StartDBInstance(in *rds.StartDBInstanceInput) (*rds.StartDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.StartDBInstance(in)
+}
+
+func (c *instanceCache) StopDBInstance(in *rds.StopDBInstanceInput) (*rds.StopDBInstanceOutput, error) {
+	defer c.invalidate(in.DBInstanceIdentifier)
+	return c.RDSAPI.StopDBInstance(in)
+}
+
+func (c *instanceCache) ApplyPendingMaintenanceAction(in *rds.ApplyPendingMaintenanceActionInput) (*rds.ApplyPendingMaintenanceActionOutput, error) {
+	defer c.invalidate(in.ResourceIdentifier)
+	return c.RDSAPI.ApplyPendingMaintenanceAction(in)
+}
+
+func copyDB(db *rds.DBInstance) *rds.DBInstance {
+	return awsutil.CopyOf(db).(*rds.DBInstance)
+}
+
+func copyTags(tags []*rds.Tag) []*rds.Tag {
+	out := make([]*rds.Tag, len(tags))
+	for i, t := range tags {
+		out[i] = &rds.Tag{Key: t.Key, Value: t.Value}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+)
+
+// cachedScenario routes the handler through an instance cache on the fake's
+// clock.
+func cachedScenario(t *testing.T, names ...string) (*scenario, *instanceCache) {
+	s := createdScenario(t, names...)
+	c := newInstanceCache(s.rds, s.rds, CacheConfig{Interval: 30 * time.Second, TagsTTL: 10 * time.Minute})
+	c.clock = s.rds.Clock
+	s.h.rds = c
+	return s, c
+}
+
+func describe(c *instanceCache, id string) (*rds.DBInstance, error) {
+	out, err := c.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: str(id)})
+	if err != nil {
+		return nil, err
+	}
+	return out.DBInstances[0], nil
+}
+
+func TestInstanceCache_ServesListing(t *testing.T) {
+	s, c := cachedScenario(t, "app", "other")
+	require.NoError(t, c.Refresh())
+	calls := s.rds.Calls("DescribeDBInstances")
+	tagCalls := s.rds.Calls("ListTagsForResource")
+
+	db, err := describe(c, "default-app")
+	require.NoError(t, err)
+	require.Equal(t, "default-app", aws.StringValue(db.DBInstanceIdentifier))
+	_, err = describe(c, "default-missing")
+	require.True(t, isNotFound(err))
+	tags, err := c.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: db.DBInstanceArn})
+	require.NoError(t, err)
+	require.NotEmpty(t, tags.TagList)
+
+	// Settled databases sync without calling AWS.
+	s.settle("app")
+	require.NoError(t, s.sync("other"))
+	require.Equal(t, calls, s.rds.Calls("DescribeDBInstances"))
+	require.Equal(t, tagCalls, s.rds.Calls("ListTagsForResource"))
+}
+
+func TestInstanceCache_InvalidatesWrites(t *testing.T) {
+	s, c := cachedScenario(t, "app")
+	require.NoError(t, c.Refresh())
+	s.rds.Advance(time.Second)
+
+	_, err := c.StopDBInstance(&rds.StopDBInstanceInput{DBInstanceIdentifier: str("default-app")})
+	require.NoError(t, err)
+	calls := s.rds.Calls("DescribeDBInstances")
+	db, err := describe(c, "default-app")
+	require.NoError(t, err)
+	require.Equal(t, fake.StatusStopping, aws.StringValue(db.DBInstanceStatus))
+	require.Equal(t, calls+1, s.rds.Calls("DescribeDBInstances"))
+
+	// Described again once, then cached.
+	_, err = describe(c, "default-app")
+	require.NoError(t, err)
+	require.Equal(t, calls+1, s.rds.Calls("DescribeDBInstances"))
+
+	// Instances created after the listing are not reported missing.
+	created := testDatabase("new")
+	v1alpha1.Defaults(created)
+	_, err = c.CreateDBInstance(createInput(created, nil))
+	require.NoError(t, err)
+	db, err = describe(c, "default-new")
+	require.NoError(t, err)
+	require.Equal(t, fake.StatusCreating, aws.StringValue(db.DBInstanceStatus))
+
+	_, err = c.AddTagsToResource(&rds.AddTagsToResourceInput{
+		ResourceName: db.DBInstanceArn,
+		Tags:         []*rds.Tag{{Key: str("team"), Value: str("payments")}},
+	})
+	require.NoError(t, err)
+	tags, err := c.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: db.DBInstanceArn})
+	require.NoError(t, err)
+	require.Contains(t, tags.TagList, &rds.Tag{Key: str("team"), Value: str("payments")})
+}
+
+func TestInstanceCache_Expires(t *testing.T) {
+	s, c := cachedScenario(t, "app")
+	require.NoError(t, c.Refresh())
+
+	// Without a listing for twice the interval lookups go to AWS.
+	s.rds.Advance(time.Minute)
+	calls := s.rds.Calls("DescribeDBInstances")
+	_, err := describe(c, "default-app")
+	require.NoError(t, err)
+	_, err = describe(c, "default-missing")
+	require.True(t, isNotFound(err))
+	require.Equal(t, calls+2, s.rds.Calls("DescribeDBInstances"))
+}
+
+func TestInstanceCache_BulkTags(t *testing.T) {
+	s, c := cachedScenario(t, "app", "other")
+	tagCalls := s.rds.Calls("ListTagsForResource")
+	require.NoError(t, c.Refresh())
+	require.Equal(t, 1, s.rds.Calls("GetResources"))
+	require.Equal(t, tagCalls, s.rds.Calls("ListTagsForResource"))
+
+	db, err := describe(c, "default-other")
+	require.NoError(t, err)
+	tags, err := c.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: db.DBInstanceArn})
+	require.NoError(t, err)
+	require.NotEmpty(t, tags.TagList)
+	require.Len(t, tags.TagList, len(s.rds.Tags("default-other")))
+	require.Equal(t, tagCalls, s.rds.Calls("ListTagsForResource"))
+}
+
+func TestInstanceCache_TagErrors(t *testing.T) {
+	s, c := cachedScenario(t, "app", "other")
+	require.NoError(t, c.Refresh())
+
+	// Once the tags expire a failed bulk listing falls back to listing the
+	// tags per instance, a failure keeps the previous entry.
+	s.rds.Advance(11 * time.Minute)
+	s.rds.Fail("GetResources", fake.Throttling(), 1)
+	s.rds.Fail("ListTagsForResource", fake.Throttling(), 1)
+	tagCalls := s.rds.Calls("ListTagsForResource")
+	require.NoError(t, c.Refresh())
+	require.Equal(t, tagCalls+2, s.rds.Calls("ListTagsForResource"))
+
+	fresh := 0
+	for _, id := range []string{"default-app", "default-other"} {
+		db, err := describe(c, id)
+		require.NoError(t, err)
+		if _, ok := c.cachedTags(aws.StringValue(db.DBInstanceArn)); ok {
+			fresh++
+		}
+	}
+	require.Equal(t, 1, fresh)
+	c.mu.Lock()
+	require.Len(t, c.tags, 2)
+	c.mu.Unlock()
+}
@@ -0,0 +1,392 @@
+package rds
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// labelInstance marks the Database managing the RDS instance of a
+// DatabaseInstance.
+const labelInstance = "rds.aws.com/instance"
+
+func typeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{Kind: kind, APIVersion: v1alpha1.SchemeGroupVersion.String()}
+}
+
+// instanceDatabase is the Database managing the RDS instance of the
+// instance.
+func (h *Handler) instanceDatabase(i *v1alpha1.DatabaseInstance) *v1alpha1.Database {
+	return &v1alpha1.Database{
+		TypeMeta: typeMeta("Database"),
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: h.cfg.InstanceNamespace,
+			Name:      i.Name,
+			Labels:    map[string]string{labelInstance: i.Name},
+		},
+		Spec: *i.Spec.Database.DeepCopy(),
+	}
+}
+
+// syncInstance keeps the Database of an available or bound instance and
+// reclaims released instances by their reclaim policy.
+func (h *Handler) syncInstance(i *v1alpha1.DatabaseInstance) error {
+	if err := v1alpha1.ValidateInstance(i); err != nil {
+		return h.setInstancePhase(i, v1alpha1.InstancePhaseFailed, err.Error())
+	}
+
+	db := h.instanceDatabase(i)
+	err := h.sdk.Get(db)
+	if err != nil && !k8errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	bound := false
+	if ref := i.Spec.ClaimRef; ref != nil {
+		claim, err := h.getClaim(ref)
+		if err != nil {
+			return err
+		}
+		if claim == nil {
+			return h.reclaim(i, db, exists)
+		}
+		bound = true
+	}
+
+	if !exists {
+		h.logger(i).Info("creating database of instance")
+		if err := h.sdk.Create(h.instanceDatabase(i)); err != nil && !k8errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	if bound {
+		return h.setInstancePhase(i, v1alpha1.InstancePhaseBound, "")
+	}
+	return h.setInstancePhase(i, v1alpha1.InstancePhaseAvailable, "")
+}
+
+// getClaim returns the referenced claim, or nil if it was deleted.
+func (h *Handler) getClaim(ref *v1alpha1.ClaimReference) (*v1alpha1.DatabaseClaim, error) {
+	claim := &v1alpha1.DatabaseClaim{
+		TypeMeta:   typeMeta("DatabaseClaim"),
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+	}
+	err := h.sdk.Get(claim)
+	if k8errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A claim of the same name created after the bound one was deleted.
+	if ref.UID != "" && claim.UID != "" && ref.UID != claim.UID {
+		return nil, nil
+	}
+	return claim, nil
+}
+
+// reclaim handles an instance whose claim was deleted.
+func (h *Handler) reclaim(i *v1alpha1.DatabaseInstance, db *v1alpha1.Database, exists bool) error {
+	logger := h.logger(i).WithField("policy", i.Spec.ReclaimPolicy)
+	ref := objectRef("DatabaseInstance", "", i.Name)
+	claim := i.Spec.ClaimRef.Namespace + "/" + i.Spec.ClaimRef.Name
+
+	switch i.Spec.ReclaimPolicy {
+	case v1alpha1.ReclaimDelete:
+		logger.Info("deleting released instance")
+		if exists {
+			if err := h.sdk.Delete(db); err != nil && !k8errors.IsNotFound(err) {
+				return err
+			}
+		}
+		recordEvent(h.sdk, ref, corev1.EventTypeNormal, "InstanceDeleted",
+			"Deleted instance "+i.Name+" released by claim "+claim)
+		return h.sdk.Delete(i)
+
+	case v1alpha1.ReclaimRecycle:
+		if exists {
+			logger.Info("recycling released instance")
+			if err := h.sdk.Delete(db); err != nil && !k8errors.IsNotFound(err) {
+				return err
+			}
+			return h.setInstancePhase(i, v1alpha1.InstancePhaseRecycling,
+				"deleting the RDS instance released by claim "+claim)
+		}
+		// The new RDS instance takes the identifier of the old one, it is
+		// created once the old one is gone.
+		if _, err := h.getDB(db); !isNotFound(err) {
+			return h.setInstancePhase(i, v1alpha1.InstancePhaseRecycling,
+				"deleting the RDS instance released by claim "+claim)
+		}
+		recordEvent(h.sdk, ref, corev1.EventTypeNormal, "InstanceRecycled",
+			"Recycled instance "+i.Name+" released by claim "+claim)
+		copy := i.DeepCopy()
+		copy.Spec.ClaimRef = nil
+		copy.Status = v1alpha1.DatabaseInstanceStatus{Phase: v1alpha1.InstancePhaseAvailable}
+		return h.sdk.Update(copy)
+	}
+
+	if i.Status.Phase != v1alpha1.InstancePhaseReleased {
+		recordEvent(h.sdk, ref, corev1.EventTypeNormal, "InstanceReleased",
+			"Instance "+i.Name+" is retained after claim "+claim+" was deleted")
+	}
+	return h.setInstancePhase(i, v1alpha1.InstancePhaseReleased,
+		"claim "+claim+" was deleted, remove spec.claimRef to make the instance available")
+}
+
+// deleteInstance deletes the Database of a deleted instance with the Delete
+// reclaim policy, other instances keep it.
+func (h *Handler) deleteInstance(i *v1alpha1.DatabaseInstance) error {
+	if i.Spec.ReclaimPolicy != v1alpha1.ReclaimDelete {
+		return nil
+	}
+	err := h.sdk.Delete(h.instanceDatabase(i))
+	if k8errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (h *Handler) setInstancePhase(i *v1alpha1.DatabaseInstance, phase, message string) error {
+	if i.Status.Phase == phase && i.Status.Message == message {
+		return nil
+	}
+	h.logger(i).WithField("phase", phase).Debug("set instance phase")
+	copy := i.DeepCopy()
+	copy.Status.Phase = phase
+	copy.Status.Message = message
+	return h.sdk.Update(copy)
+}
+
+// syncClaim binds a pending claim and copies the credentials of the bound
+// instance to the claim's namespace.
+func (h *Handler) syncClaim(c *v1alpha1.DatabaseClaim) error {
+	if c.Status.InstanceName == "" {
+		return h.bindClaim(c)
+	}
+
+	i := &v1alpha1.DatabaseInstance{
+		TypeMeta:   typeMeta("DatabaseInstance"),
+		ObjectMeta: metav1.ObjectMeta{Name: c.Status.InstanceName},
+	}
+	err := h.sdk.Get(i)
+	if err != nil && !k8errors.IsNotFound(err) {
+		return err
+	}
+	if err != nil || !claims(i, c) {
+		if c.Status.Phase == v1alpha1.ClaimPhaseLost {
+			return nil
+		}
+		recordEvent(h.sdk, objectRef("DatabaseClaim", c.Namespace, c.Name), corev1.EventTypeWarning, "ClaimLost",
+			"Instance "+c.Status.InstanceName+" is no longer bound to the claim")
+		copy := c.DeepCopy()
+		copy.Status.Phase = v1alpha1.ClaimPhaseLost
+		copy.Status.Message = "instance " + c.Status.InstanceName + " is no longer bound to the claim"
+		return h.sdk.Update(copy)
+	}
+	return h.syncClaimSecret(c, i)
+}
+
+func claims(i *v1alpha1.DatabaseInstance, c *v1alpha1.DatabaseClaim) bool {
+	ref := i.Spec.ClaimRef
+	return ref != nil && ref.Namespace == c.Namespace && ref.Name == c.Name &&
+		(ref.UID == "" || c.UID == "" || ref.UID == c.UID)
+}
+
+// syncClaimSecret copies the credentials secret of the instance's Database,
+// once it is created, to the claim.
+func (h *Handler) syncClaimSecret(c *v1alpha1.DatabaseClaim, i *v1alpha1.DatabaseInstance) error {
+	source := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: h.cfg.InstanceNamespace, Name: i.Name + "-db-credentials"},
+	}
+	err := h.sdk.Get(source)
+	if k8errors.IsNotFound(err) {
+		h.logger(c).Debug("waiting for instance credentials")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   c.Namespace,
+			Name:        c.Name + "-db-credentials",
+			Annotations: map[string]string{"rds.aws.com/claim": c.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(c, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "DatabaseClaim",
+				}),
+			},
+		},
+	}
+	existing := secret.DeepCopy()
+	err = h.sdk.Get(existing)
+	switch {
+	case k8errors.IsNotFound(err):
+		secret.Data = source.Data
+		if err := h.sdk.Create(secret); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !reflect.DeepEqual(existing.Data, source.Data):
+		existing.Data = source.Data
+		if err := h.sdk.Update(existing); err != nil {
+			return err
+		}
+	}
+
+	if c.Status.Secret == secret.Name {
+		return nil
+	}
+	copy := c.DeepCopy()
+	copy.Status.Secret = secret.Name
+	return h.sdk.Update(copy)
+}
+
+// bindClaim binds the claim to the smallest matching available instance,
+// or provisions one from the claim's class.
+func (h *Handler) bindClaim(c *v1alpha1.DatabaseClaim) error {
+	logger := h.logger(c)
+
+	className := c.Spec.ClassName
+	class, err := h.class(className)
+	if err != nil && !isClassError(err) {
+		return err
+	}
+	if err != nil && className == "" {
+		return h.pendClaim(c, err.Error())
+	}
+	if class != nil {
+		className = class.Name
+	}
+
+	list := &v1alpha1.DatabaseInstanceList{TypeMeta: typeMeta("DatabaseInstanceList")}
+	if err := h.sdk.List("", list); err != nil {
+		return err
+	}
+	var candidates []*v1alpha1.DatabaseInstance
+	for n := range list.Items {
+		i := &list.Items[n]
+		if matches(i, c, className) {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		// Instances reserved for the claim come first.
+		if ra, rb := candidates[a].Spec.ClaimRef != nil, candidates[b].Spec.ClaimRef != nil; ra != rb {
+			return ra
+		}
+		sa, sb := candidates[a].Spec.Database.Storage, candidates[b].Spec.Database.Storage
+		if sa != sb {
+			return sa < sb
+		}
+		return candidates[a].Name < candidates[b].Name
+	})
+
+	var instance *v1alpha1.DatabaseInstance
+	switch {
+	case len(candidates) > 0:
+		instance = candidates[0].DeepCopy()
+		instance.Spec.ClaimRef = claimReference(c)
+		logger.WithField("instance", instance.Name).Info("binding claim")
+		if err := h.sdk.Update(instance); err != nil {
+			return err
+		}
+	case class != nil && c.Spec.InstanceName == "":
+		instance = h.provisionInstance(c, class)
+		// Policies apply to provisioned instances in the claim's namespace.
+		db := &v1alpha1.Database{
+			ObjectMeta: metav1.ObjectMeta{Namespace: c.Namespace, Name: c.Name},
+			Spec:       instance.Spec.Database,
+		}
+		v1alpha1.ApplyClass(db, class)
+		if err := h.checkPolicies(db); isPolicyError(err) {
+			if c.Status.Message != err.Error() {
+				recordEvent(h.sdk, objectRef("DatabaseClaim", c.Namespace, c.Name), corev1.EventTypeWarning,
+					"PolicyViolation", err.Error())
+			}
+			return h.pendClaim(c, err.Error())
+		} else if err != nil {
+			return err
+		}
+		logger.WithField("instance", instance.Name).Info("provisioning instance for claim")
+		if err := h.sdk.Create(instance); err != nil && !k8errors.IsAlreadyExists(err) {
+			return err
+		}
+	case err != nil:
+		return h.pendClaim(c, err.Error())
+	default:
+		return h.pendClaim(c, "no available instance matches the claim")
+	}
+
+	recordEvent(h.sdk, objectRef("DatabaseClaim", c.Namespace, c.Name), corev1.EventTypeNormal, "ClaimBound",
+		"Bound to instance "+instance.Name)
+	copy := c.DeepCopy()
+	copy.Status = v1alpha1.DatabaseClaimStatus{Phase: v1alpha1.ClaimPhaseBound, InstanceName: instance.Name}
+	return h.sdk.Update(copy)
+}
+
+// matches reports whether the instance can be bound to the claim.
+func matches(i *v1alpha1.DatabaseInstance, c *v1alpha1.DatabaseClaim, className string) bool {
+	if i.Spec.ClaimRef != nil {
+		// Instances may be reserved for a claim by setting the claimRef.
+		return claims(i, c)
+	}
+	if i.Status.Phase != v1alpha1.InstancePhaseAvailable {
+		return false
+	}
+	if c.Spec.InstanceName != "" && c.Spec.InstanceName != i.Name {
+		return false
+	}
+	spec := i.Spec.Database
+	return spec.ClassName == className &&
+		(c.Spec.Engine == "" || c.Spec.Engine == spec.Engine) &&
+		spec.Storage >= c.Spec.Storage
+}
+
+func claimReference(c *v1alpha1.DatabaseClaim) *v1alpha1.ClaimReference {
+	return &v1alpha1.ClaimReference{Namespace: c.Namespace, Name: c.Name, UID: c.UID}
+}
+
+func (h *Handler) provisionInstance(c *v1alpha1.DatabaseClaim, class *v1alpha1.DatabaseClass) *v1alpha1.DatabaseInstance {
+	policy := class.ReclaimPolicy
+	if policy == "" {
+		policy = v1alpha1.ReclaimDelete
+	}
+	return &v1alpha1.DatabaseInstance{
+		TypeMeta:   typeMeta("DatabaseInstance"),
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%s", c.Namespace, c.Name)},
+		Spec: v1alpha1.DatabaseInstanceSpec{
+			Database: v1alpha1.DatabaseSpec{
+				ClassName: class.Name,
+				Engine:    c.Spec.Engine,
+				Storage:   c.Spec.Storage,
+			},
+			ClaimRef:      claimReference(c),
+			ReclaimPolicy: policy,
+		},
+	}
+}
+
+func (h *Handler) pendClaim(c *v1alpha1.DatabaseClaim, message string) error {
+	if c.Status.Phase == v1alpha1.ClaimPhasePending && c.Status.Message == message {
+		return nil
+	}
+	h.logger(c).WithField("reason", message).Info("claim pending")
+	copy := c.DeepCopy()
+	copy.Status = v1alpha1.DatabaseClaimStatus{Phase: v1alpha1.ClaimPhasePending, Message: message}
+	return h.sdk.Update(copy)
+}
@@ -0,0 +1,190 @@
+package rds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newClaimScenario(t *testing.T) *scenario {
+	s := newScenario(t)
+	s.h.cfg.InstanceNamespace = "rds-system"
+	return s
+}
+
+func (m *memorySDK) object(key string) sdk.Object {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return nil
+	}
+	return o.DeepCopyObject()
+}
+
+// handle syncs the stored object with the key.
+func (s *scenario) handle(key string) {
+	o := s.sdk.object(key)
+	require.NotNil(s.t, o, key)
+	require.NoError(s.t, s.h.Handle(context.Background(), sdk.Event{Object: o}))
+}
+
+// flushDeleted delivers the deletion events of the deleted databases and
+// removes their secrets, as the garbage collector would.
+func (s *scenario) flushDeleted() {
+	s.sdk.mu.Lock()
+	deleted := s.sdk.deleted
+	s.sdk.deleted = nil
+	s.sdk.mu.Unlock()
+	for _, o := range deleted {
+		if db, ok := o.(*v1alpha1.Database); ok {
+			require.NoError(s.t, s.h.Handle(context.Background(), sdk.Event{Object: db, Deleted: true}))
+			s.sdk.delete(&corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: db.Namespace, Name: secretName(db)},
+			})
+		}
+	}
+}
+
+func instance(s *scenario, name string) *v1alpha1.DatabaseInstance {
+	o := s.sdk.object("DatabaseInstance//" + name)
+	if o == nil {
+		return nil
+	}
+	return o.(*v1alpha1.DatabaseInstance)
+}
+
+func claim(s *scenario, name string) *v1alpha1.DatabaseClaim {
+	return s.sdk.object("DatabaseClaim/default/" + name).(*v1alpha1.DatabaseClaim)
+}
+
+func testClaim(name string, spec v1alpha1.DatabaseClaimSpec) *v1alpha1.DatabaseClaim {
+	return &v1alpha1.DatabaseClaim{
+		TypeMeta:   typeMeta("DatabaseClaim"),
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       spec,
+	}
+}
+
+func testInstance(name string, storage int64, policy string) *v1alpha1.DatabaseInstance {
+	return &v1alpha1.DatabaseInstance{
+		TypeMeta:   typeMeta("DatabaseInstance"),
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.DatabaseInstanceSpec{
+			Database:      v1alpha1.DatabaseSpec{Storage: storage},
+			ReclaimPolicy: policy,
+		},
+	}
+}
+
+func TestClaims_Provision(t *testing.T) {
+	s := newClaimScenario(t)
+	class := testClass("small-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.t2.small"})
+	class.Annotations = map[string]string{v1alpha1.AnnotationDefaultClass: "true"}
+	require.NoError(t, s.sdk.Create(class))
+	require.NoError(t, s.sdk.Create(testClaim("app", v1alpha1.DatabaseClaimSpec{Storage: 50})))
+
+	s.handle("DatabaseClaim/default/app")
+	require.Equal(t, v1alpha1.ClaimPhaseBound, claim(s, "app").Status.Phase)
+	i := instance(s, "default-app")
+	require.Equal(t, v1alpha1.ReclaimDelete, i.Spec.ReclaimPolicy)
+	require.Equal(t, "app", i.Spec.ClaimRef.Name)
+
+	s.handle("DatabaseInstance//default-app")
+	require.Equal(t, v1alpha1.InstancePhaseBound, instance(s, "default-app").Status.Phase)
+	s.handle("Database/rds-system/default-app")
+	rdsInstance := s.rds.Instance("rds-system-default-app")
+	require.Equal(t, "db.t2.small", *rdsInstance.DBInstanceClass)
+	require.Equal(t, int64(50), *rdsInstance.AllocatedStorage)
+
+	s.rds.Advance(10 * time.Minute)
+	s.handle("Database/rds-system/default-app")
+	s.handle("DatabaseClaim/default/app")
+	secret := s.sdk.secret("app-db-credentials")
+	require.NotNil(t, secret)
+	source := s.sdk.object("Secret/rds-system/default-app-db-credentials").(*corev1.Secret)
+	require.Equal(t, source.Data, secret.Data)
+	require.Equal(t, "app-db-credentials", claim(s, "app").Status.Secret)
+
+	// Deleting the claim deletes the instance and the RDS instance.
+	s.sdk.delete(claim(s, "app"))
+	s.handle("DatabaseInstance//default-app")
+	require.Nil(t, instance(s, "default-app"))
+	s.flushDeleted()
+	require.Equal(t, 1, s.rds.Calls("DeleteDBInstance"))
+}
+
+func TestClaims_StaticAndRecycle(t *testing.T) {
+	s := newClaimScenario(t)
+	require.NoError(t, s.sdk.Create(testInstance("small", 20, v1alpha1.ReclaimRetain)))
+	require.NoError(t, s.sdk.Create(testInstance("large", 100, v1alpha1.ReclaimRecycle)))
+	s.handle("DatabaseInstance//small")
+	s.handle("DatabaseInstance//large")
+	require.Equal(t, v1alpha1.InstancePhaseAvailable, instance(s, "large").Status.Phase)
+	s.handle("Database/rds-system/large")
+	s.rds.Advance(10 * time.Minute)
+	s.handle("Database/rds-system/large")
+
+	// The smallest instance with enough storage is bound.
+	require.NoError(t, s.sdk.Create(testClaim("app", v1alpha1.DatabaseClaimSpec{Storage: 50})))
+	s.handle("DatabaseClaim/default/app")
+	require.Equal(t, "large", claim(s, "app").Status.InstanceName)
+	require.Equal(t, "app", instance(s, "large").Spec.ClaimRef.Name)
+
+	require.NoError(t, s.sdk.Create(testClaim("other", v1alpha1.DatabaseClaimSpec{Storage: 50})))
+	s.handle("DatabaseClaim/default/other")
+	require.Equal(t, v1alpha1.ClaimPhasePending, claim(s, "other").Status.Phase)
+	require.Equal(t, "no available instance matches the claim", claim(s, "other").Status.Message)
+
+	// Recycling replaces the RDS instance and makes the instance available.
+	s.sdk.delete(claim(s, "app"))
+	s.handle("DatabaseInstance//large")
+	require.Equal(t, v1alpha1.InstancePhaseRecycling, instance(s, "large").Status.Phase)
+	s.flushDeleted()
+	s.handle("DatabaseInstance//large")
+	require.Equal(t, v1alpha1.InstancePhaseRecycling, instance(s, "large").Status.Phase)
+
+	s.rds.Advance(3 * time.Minute)
+	s.handle("DatabaseInstance//large")
+	require.Nil(t, instance(s, "large").Spec.ClaimRef)
+	require.Equal(t, v1alpha1.InstancePhaseAvailable, instance(s, "large").Status.Phase)
+	s.handle("DatabaseInstance//large")
+	s.handle("Database/rds-system/large")
+	require.Equal(t, 2, s.rds.Calls("CreateDBInstance"))
+
+	s.handle("DatabaseClaim/default/other")
+	require.Equal(t, "large", claim(s, "other").Status.InstanceName)
+}
+
+func TestClaims_RetainAndLost(t *testing.T) {
+	s := newClaimScenario(t)
+	require.NoError(t, s.sdk.Create(testInstance("pg", 20, "")))
+	s.handle("DatabaseInstance//pg")
+	require.NoError(t, s.sdk.Create(testClaim("app", v1alpha1.DatabaseClaimSpec{InstanceName: "pg"})))
+	s.handle("DatabaseClaim/default/app")
+	require.Equal(t, "pg", claim(s, "app").Status.InstanceName)
+
+	s.sdk.delete(claim(s, "app"))
+	s.handle("DatabaseInstance//pg")
+	s.handle("DatabaseInstance//pg")
+	require.Equal(t, v1alpha1.InstancePhaseReleased, instance(s, "pg").Status.Phase)
+	require.Len(t, events(s, "InstanceReleased"), 1)
+	require.Empty(t, s.sdk.deleted)
+
+	// A claim whose instance is deleted is lost.
+	require.NoError(t, s.sdk.Create(testInstance("other", 20, "")))
+	s.handle("DatabaseInstance//other")
+	require.NoError(t, s.sdk.Create(testClaim("next", v1alpha1.DatabaseClaimSpec{})))
+	s.handle("DatabaseClaim/default/next")
+	require.Equal(t, "other", claim(s, "next").Status.InstanceName)
+	s.sdk.delete(instance(s, "other"))
+	s.handle("DatabaseClaim/default/next")
+	require.Equal(t, v1alpha1.ClaimPhaseLost, claim(s, "next").Status.Phase)
+}
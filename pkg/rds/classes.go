@@ -0,0 +1,88 @@
+package rds
+
+import (
+	"fmt"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// applyClass fills the spec of a database that is not created yet from its
+// class, spec.className or the default class. The class is applied to the
+// database being handled and written with its next status update. A missing
+// or invalid class is recorded as the status error, the database waits for
+// it to be fixed.
+func (h *Handler) applyClass(o *v1alpha1.Database) (handled bool, err error) {
+	class, err := h.class(o.Spec.ClassName)
+	if err != nil && !isClassError(err) {
+		return true, err
+	}
+	if err == nil && class != nil {
+		err = v1alpha1.ValidateClass(class)
+		if err != nil {
+			err = fmt.Errorf("invalid databaseClass %s: %v", class.Name, err)
+		}
+	}
+	if err != nil {
+		return true, h.hold(o, "ClassUnavailable", err)
+	}
+	if class != nil {
+		v1alpha1.ApplyClass(o, class)
+	}
+	return false, nil
+}
+
+// hold records why a database that is not created yet waits as its status
+// error, with an event when the reason changes.
+func (h *Handler) hold(o *v1alpha1.Database, reason string, err error) error {
+	if o.Status.Error == err.Error() {
+		return nil
+	}
+	h.logger(o).WithError(err).WithField("reason", reason).Warn("database held")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, reason, err.Error())
+	state := o.Status.State
+	if state == "" {
+		state = v1alpha1.StatePending
+	}
+	return h.setStatus(o, state, err)
+}
+
+type classError struct{ msg string }
+
+func (e classError) Error() string { return e.msg }
+
+func isClassError(err error) bool {
+	_, ok := err.(classError)
+	return ok
+}
+
+// class gets the named class, or the default class when the name is empty.
+// Without a default class it returns nil.
+func (h *Handler) class(name string) (*v1alpha1.DatabaseClass, error) {
+	if name != "" {
+		class := &v1alpha1.DatabaseClass{TypeMeta: typeMeta("DatabaseClass"), ObjectMeta: metav1.ObjectMeta{Name: name}}
+		err := h.sdk.Get(class)
+		if k8errors.IsNotFound(err) {
+			return nil, classError{fmt.Sprintf("databaseClass %s not found", name)}
+		}
+		return class, err
+	}
+
+	list := &v1alpha1.DatabaseClassList{TypeMeta: typeMeta("DatabaseClassList")}
+	if err := h.sdk.List("", list); err != nil {
+		return nil, err
+	}
+	var class *v1alpha1.DatabaseClass
+	for i, c := range list.Items {
+		if c.Annotations[v1alpha1.AnnotationDefaultClass] != "true" {
+			continue
+		}
+		if class != nil {
+			return nil, classError{fmt.Sprintf("databaseClasses %s and %s are both marked as default", class.Name, c.Name)}
+		}
+		class = &list.Items[i]
+	}
+	return class, nil
+}
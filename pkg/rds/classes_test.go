@@ -0,0 +1,93 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testClass(name string, spec v1alpha1.DatabaseSpec) *v1alpha1.DatabaseClass {
+	return &v1alpha1.DatabaseClass{
+		TypeMeta:   typeMeta("DatabaseClass"),
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       spec,
+	}
+}
+
+func TestClasses_ClassName(t *testing.T) {
+	s := newScenario(t)
+	require.NoError(t, s.sdk.Create(testClass("prod-postgres", v1alpha1.DatabaseSpec{
+		InstanceClass:         "db.m4.large",
+		BackupRetentionPeriod: 7,
+		Tags:                  map[string]string{"tier": "prod"},
+	})))
+
+	db := testDatabase("app")
+	db.Spec.ClassName = "prod-postgres"
+	db.Spec.Storage = 100
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+
+	instance := s.rds.Instance("default-app")
+	require.Equal(t, "db.m4.large", *instance.DBInstanceClass)
+	require.Equal(t, int64(7), *instance.BackupRetentionPeriod)
+	require.Equal(t, int64(100), *instance.AllocatedStorage)
+	require.Equal(t, "prod", s.rds.Tags("default-app")["tier"])
+	require.Equal(t, "db.m4.large", s.sdk.database("app").Spec.InstanceClass)
+
+	// Created databases keep the fields they took from the class.
+	class := testClass("prod-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.m4.xlarge"})
+	require.NoError(t, s.sdk.Update(class))
+	s.rds.Advance(10 * time.Minute)
+	s.settle("app")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "db.m4.large", s.sdk.database("app").Spec.InstanceClass)
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestClasses_Default(t *testing.T) {
+	s := newScenario(t)
+	require.NoError(t, s.sdk.Create(testClass("small-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.t2.small"})))
+	class := testClass("default-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.t2.medium"})
+	class.Annotations = map[string]string{v1alpha1.AnnotationDefaultClass: "true"}
+	require.NoError(t, s.sdk.Create(class))
+
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "db.t2.medium", *s.rds.Instance("default-app").DBInstanceClass)
+	require.Equal(t, "default-postgres", s.sdk.database("app").Spec.ClassName)
+
+	// A second default class is ambiguous.
+	class = testClass("other-postgres", v1alpha1.DatabaseSpec{})
+	class.Annotations = map[string]string{v1alpha1.AnnotationDefaultClass: "true"}
+	require.NoError(t, s.sdk.Create(class))
+	s.apply(testDatabase("other"))
+	require.NoError(t, s.sync("other"))
+	require.Contains(t, s.sdk.database("other").Status.Error, "both marked as default")
+	require.Nil(t, s.rds.Instance("default-other"))
+}
+
+func TestClasses_Missing(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.ClassName = "prod-postgres"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "databaseClass prod-postgres not found", s.sdk.database("app").Status.Error)
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+	require.Len(t, events(s, "ClassUnavailable"), 1)
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+
+	require.NoError(t, s.sdk.Create(testClass("prod-postgres", v1alpha1.DatabaseSpec{Password: "secret"})))
+	require.NoError(t, s.sync("app"))
+	require.Contains(t, s.sdk.database("app").Status.Error, "invalid databaseClass prod-postgres")
+
+	require.NoError(t, s.sdk.Update(testClass("prod-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.m4.large"})))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "db.m4.large", *s.rds.Instance("default-app").DBInstanceClass)
+	require.Empty(t, s.sdk.database("app").Status.Error)
+}
@@ -0,0 +1,55 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// StorageMetrics reports the free storage of instances.
+type StorageMetrics interface {
+	// FreeStorageBytes returns the latest free storage of the instance.
+	FreeStorageBytes(id string) (float64, error)
+}
+
+// CloudWatchMetrics reads the RDS FreeStorageSpace metric.
+type CloudWatchMetrics struct {
+	client *cloudwatch.CloudWatch
+}
+
+// NewCloudWatchMetrics returns a CloudWatch backed metrics source.
+func NewCloudWatchMetrics(p client.ConfigProvider) *CloudWatchMetrics {
+	return &CloudWatchMetrics{client: cloudwatch.New(p)}
+}
+
+// FreeStorageBytes returns the minimum free storage of the latest five
+// minute period reported in the last half hour.
+func (m *CloudWatchMetrics) FreeStorageBytes(id string) (float64, error) {
+	now := time.Now()
+	out, err := m.client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/RDS"),
+		MetricName: aws.String("FreeStorageSpace"),
+		Dimensions: []*cloudwatch.Dimension{{Name: aws.String("DBInstanceIdentifier"), Value: aws.String(id)}},
+		StartTime:  aws.Time(now.Add(-30 * time.Minute)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(300),
+		Statistics: []*string{aws.String(cloudwatch.StatisticMinimum)},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var latest *cloudwatch.Datapoint
+	for _, d := range out.Datapoints {
+		if d.Timestamp != nil && d.Minimum != nil && (latest == nil || d.Timestamp.After(*latest.Timestamp)) {
+			latest = d
+		}
+	}
+	if latest == nil {
+		return 0, fmt.Errorf("no FreeStorageSpace datapoints for %s", id)
+	}
+	return *latest.Minimum, nil
+}
@@ -0,0 +1,62 @@
+package rds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/require"
+)
+
+const getMetricStatisticsResponse = `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <GetMetricStatisticsResult>
+    <Datapoints>
+      <member>
+        <Timestamp>2018-10-20T10:00:00Z</Timestamp>
+        <Minimum>2.0E9</Minimum>
+        <Unit>Bytes</Unit>
+      </member>
+      <member>
+        <Timestamp>2018-10-20T10:05:00Z</Timestamp>
+        <Minimum>1.5E9</Minimum>
+        <Unit>Bytes</Unit>
+      </member>
+    </Datapoints>
+    <Label>FreeStorageSpace</Label>
+  </GetMetricStatisticsResult>
+  <ResponseMetadata>
+    <RequestId>1</RequestId>
+  </ResponseMetadata>
+</GetMetricStatisticsResponse>`
+
+func TestCloudWatchMetrics_FreeStorageBytes(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		w.Write([]byte(getMetricStatisticsResponse))
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+
+	free, err := NewCloudWatchMetrics(sess).FreeStorageBytes("default-app")
+	require.NoError(t, err)
+	require.Equal(t, 1.5e9, free)
+
+	require.Equal(t, "GetMetricStatistics", form.Get("Action"))
+	require.Equal(t, "2010-08-01", form.Get("Version"))
+	require.Equal(t, "FreeStorageSpace", form.Get("MetricName"))
+	require.Equal(t, "DBInstanceIdentifier", form.Get("Dimensions.member.1.Name"))
+	require.Equal(t, "default-app", form.Get("Dimensions.member.1.Value"))
+	require.Equal(t, "Minimum", form.Get("Statistics.member.1"))
+}
@@ -0,0 +1,84 @@
+package rds
+
+import (
+	"fmt"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/cost"
+)
+
+// estimateCost records the estimated monthly cost of the instance in the
+// status and the namespace total in the estimated cost metric. Databases
+// without prices in the pricing table have no estimate.
+func (h *Handler) estimateCost(o *v1alpha1.Database) (handled bool, err error) {
+	if h.cfg.Pricing == nil || !h.enabled(FeatureCostEstimates) {
+		return false, nil
+	}
+	estimate, version := "", ""
+	monthly, err := h.cfg.Pricing.Estimate(costInstance(o, h.region))
+	if err != nil {
+		h.logger(o).WithError(err).Debug("no cost estimate")
+		h.setCost(o, 0)
+	} else {
+		estimate = fmt.Sprintf("%.2f %s", monthly, h.cfg.Pricing.Currency)
+		version = h.cfg.Pricing.Version
+		h.setCost(o, monthly)
+	}
+
+	if estimate == o.Status.EstimatedMonthlyCost && version == o.Status.PricingVersion {
+		return false, nil
+	}
+	copy := o.DeepCopy()
+	copy.Status.EstimatedMonthlyCost = estimate
+	copy.Status.PricingVersion = version
+	return true, h.sdk.Update(copy)
+}
+
+func costInstance(o *v1alpha1.Database, region string) cost.Instance {
+	storage := o.Spec.Storage
+	// Storage autoscaling grows the instance beyond the spec.
+	if n := len(o.Status.StorageGrowth); n > 0 && o.Status.StorageGrowth[n-1].To > storage {
+		storage = o.Status.StorageGrowth[n-1].To
+	}
+	return cost.Instance{
+		Region:          region,
+		Engine:          o.Spec.Engine,
+		InstanceClass:   o.Spec.InstanceClass,
+		MultiAZ:         o.Spec.MultiAZ,
+		StorageType:     o.Spec.StorageType,
+		Storage:         storage,
+		Iops:            o.Spec.Iops,
+		BackupRetention: o.Spec.BackupRetentionPeriod,
+	}
+}
+
+// setCost records the estimate of the database and updates the total of its
+// namespace.
+func (h *Handler) setCost(o *v1alpha1.Database, monthly float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.costs == nil {
+		h.costs = map[string]map[string]float64{}
+	}
+	costs := h.costs[o.Namespace]
+	if costs == nil {
+		costs = map[string]float64{}
+		h.costs[o.Namespace] = costs
+	}
+	if monthly == 0 {
+		delete(costs, o.Name)
+	} else {
+		costs[o.Name] = monthly
+	}
+
+	var total float64
+	for _, c := range costs {
+		total += c
+	}
+	if len(costs) == 0 {
+		delete(h.costs, o.Namespace)
+		estimatedMonthlyCost.DeleteLabelValues(o.Namespace)
+		return
+	}
+	estimatedMonthlyCost.WithLabelValues(o.Namespace).Set(total)
+}
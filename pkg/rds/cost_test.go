@@ -0,0 +1,65 @@
+package rds
+
+import (
+	"testing"
+
+	"github.com/coldog/rds-operator/pkg/cost"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func priceScenario(t *testing.T, names ...string) *scenario {
+	s := createdScenario(t, names...)
+	s.h.region = "us-west-2"
+	s.h.cfg.Pricing = &cost.Table{
+		Version:  "test",
+		Currency: "USD",
+		Regions: map[string]cost.Prices{
+			"us-west-2": {
+				Instances: map[string]map[string]float64{
+					"postgres": {"db.t2.micro": 0.1},
+				},
+				Storage: map[string]float64{"gp2": 0.1},
+			},
+		},
+	}
+	return s
+}
+
+func namespaceCost(t *testing.T, namespace string) float64 {
+	m := &dto.Metric{}
+	require.NoError(t, estimatedMonthlyCost.WithLabelValues(namespace).Write(m))
+	return m.GetGauge().GetValue()
+}
+
+func TestEstimateCost(t *testing.T) {
+	s := priceScenario(t, "app", "other")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.sync("app"))
+		require.NoError(t, s.sync("other"))
+	}
+
+	// The defaults are 20GiB of gp2 on a db.t2.micro.
+	status := s.sdk.database("app").Status
+	require.Equal(t, "75.00 USD", status.EstimatedMonthlyCost)
+	require.Equal(t, "test", status.PricingVersion)
+	require.InDelta(t, 150, namespaceCost(t, "default"), 0.001)
+
+	db := s.sdk.database("app")
+	db.Spec.MultiAZ = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "150.00 USD", s.sdk.database("app").Status.EstimatedMonthlyCost)
+	require.InDelta(t, 225, namespaceCost(t, "default"), 0.001)
+
+	db = s.sdk.database("other")
+	db.Spec.InstanceClass = "db.unpriced"
+	s.apply(db)
+	require.NoError(t, s.sync("other"))
+	require.Empty(t, s.sdk.database("other").Status.EstimatedMonthlyCost)
+	require.Empty(t, s.sdk.database("other").Status.PricingVersion)
+	require.InDelta(t, 150, namespaceCost(t, "default"), 0.001)
+
+	require.NoError(t, s.remove("app"))
+	require.Empty(t, s.h.costs)
+}
@@ -0,0 +1,76 @@
+package rds
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+)
+
+// deleteInput deletes the instance of the database with a final snapshot,
+// the default deletion policy.
+func deleteInput(cr *v1alpha1.Database, now time.Time) *rds.DeleteDBInstanceInput {
+	return &rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      str(dbName(cr)),
+		FinalDBSnapshotIdentifier: str(finalSnapshotName(dbName(cr), now)),
+	}
+}
+
+// deletionPolicy returns the policy for the database, falling back to the
+// operator default and then to Snapshot.
+func (h *Handler) deletionPolicy(o *v1alpha1.Database) string {
+	policy := o.Spec.DeletionPolicy
+	if policy == "" {
+		policy = h.cfg.DeletionPolicy
+	}
+	switch policy {
+	case v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyRetain:
+		return policy
+	case "", v1alpha1.DeletionPolicySnapshot:
+	default:
+		h.logger(o).WithField("policy", policy).Warn("unknown deletion policy, taking a final snapshot")
+	}
+	return v1alpha1.DeletionPolicySnapshot
+}
+
+// deletionInput deletes the instance of a deleted database as its deletion
+// policy says, nil retains the instance.
+func (h *Handler) deletionInput(cr *v1alpha1.Database, now time.Time) *rds.DeleteDBInstanceInput {
+	switch h.deletionPolicy(cr) {
+	case v1alpha1.DeletionPolicyRetain:
+		return nil
+	case v1alpha1.DeletionPolicyDelete:
+		return &rds.DeleteDBInstanceInput{
+			DBInstanceIdentifier: str(dbName(cr)),
+			SkipFinalSnapshot:    aws.Bool(true),
+		}
+	}
+	return deleteInput(cr, now)
+}
+
+// deleteDB deletes the instance of a deleted database. Instances that
+// are already gone or being deleted are not an error.
+func (h *Handler) deleteDB(cr *v1alpha1.Database, req *rds.DeleteDBInstanceInput) error {
+	_, err := h.rds.DeleteDBInstance(req)
+	if isNotFound(err) {
+		return nil
+	}
+	// A released protection finalizer deletes the instance before the
+	// deletion event arrives.
+	if isInvalidState(err) {
+		if db, _ := h.getDB(cr); db != nil && aws.StringValue(db.DBInstanceStatus) == "deleting" {
+			return nil
+		}
+	}
+	if err != nil {
+		h.logger(cr).WithError(err).Error("deletion failed")
+	}
+	return err
+}
+
+// finalSnapshotName names the snapshot taken when an instance is deleted,
+// <instance>-final-<timestamp>.
+func finalSnapshotName(id string, now time.Time) string {
+	return id + "-final-" + now.UTC().Format("20060102150405")
+}
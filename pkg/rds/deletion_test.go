@@ -0,0 +1,70 @@
+package rds
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHandler_DeleteFinalSnapshot(t *testing.T) {
+	r, s, h := handler()
+
+	r.On("DeleteDBInstance", mock.MatchedBy(func(in *rds.DeleteDBInstanceInput) bool {
+		return aws.StringValue(in.DBInstanceIdentifier) == "default-test" &&
+			strings.HasPrefix(aws.StringValue(in.FinalDBSnapshotIdentifier), "default-test-final-") &&
+			!aws.BoolValue(in.SkipFinalSnapshot)
+	})).Return(nil)
+
+	err := h.Handle(context.Background(), sdk.Event{
+		Deleted: true,
+		Object: &v1alpha1.Database{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Database",
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	s.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
+
+func TestHandler_DeleteNotFound(t *testing.T) {
+	r, s, h := handler()
+
+	r.On("DeleteDBInstance", mock.Anything).Return(
+		awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "not found", nil),
+	)
+
+	err := h.Handle(context.Background(), sdk.Event{
+		Deleted: true,
+		Object: &v1alpha1.Database{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Database",
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	s.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
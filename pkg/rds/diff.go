@@ -0,0 +1,349 @@
+package rds
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+)
+
+// specField maps a modifiable spec field to the instance. Declared returns
+// false when the spec leaves the field unset, in which case any actual value
+// is accepted. Apply receives the instance with its pending modifications.
+type specField struct {
+	name     string
+	declared func(s v1alpha1.DatabaseSpec) (string, bool)
+	actual   func(db *rds.DBInstance) string
+	apply    func(s v1alpha1.DatabaseSpec, db *rds.DBInstance, req *rds.ModifyDBInstanceInput)
+}
+
+var specFields = []specField{
+	{
+		name:     "instanceClass",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return s.InstanceClass, s.InstanceClass != "" },
+		actual:   func(db *rds.DBInstance) string { return aws.StringValue(db.DBInstanceClass) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.DBInstanceClass = str(s.InstanceClass)
+		},
+	},
+	{
+		name:     "storage",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return strI64(s.Storage), s.Storage != 0 },
+		actual:   func(db *rds.DBInstance) string { return strI64(aws.Int64Value(db.AllocatedStorage)) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.AllocatedStorage = i64(s.Storage)
+		},
+	},
+	{
+		name:     "engineVersion",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return s.EngineVersion, s.EngineVersion != "" },
+		actual:   func(db *rds.DBInstance) string { return aws.StringValue(db.EngineVersion) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.EngineVersion = str(s.EngineVersion)
+		},
+	},
+	{
+		name: "backupRetentionPeriod",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return strI64(s.BackupRetentionPeriod), s.BackupRetentionPeriod != 0
+		},
+		actual: func(db *rds.DBInstance) string { return strI64(aws.Int64Value(db.BackupRetentionPeriod)) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.BackupRetentionPeriod = i64(s.BackupRetentionPeriod)
+		},
+	},
+	{
+		name:     "iops",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return strI64(s.Iops), s.Iops != 0 },
+		actual:   func(db *rds.DBInstance) string { return strI64(aws.Int64Value(db.Iops)) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.Iops = i64(s.Iops)
+		},
+	},
+	{
+		name:     "storageType",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return s.StorageType, s.StorageType != "" },
+		actual:   func(db *rds.DBInstance) string { return aws.StringValue(db.StorageType) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.StorageType = str(s.StorageType)
+		},
+	},
+	{
+		name:     "multiAz",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return strconv.FormatBool(s.MultiAZ), true },
+		actual:   func(db *rds.DBInstance) string { return strconv.FormatBool(aws.BoolValue(db.MultiAZ)) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.MultiAZ = bo(s.MultiAZ)
+		},
+	},
+	{
+		name: "autoMinorVersionUpgrade",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return strconv.FormatBool(s.AutoMinorVersionUpgrade), true
+		},
+		actual: func(db *rds.DBInstance) string {
+			return strconv.FormatBool(aws.BoolValue(db.AutoMinorVersionUpgrade))
+		},
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.AutoMinorVersionUpgrade = bo(s.AutoMinorVersionUpgrade)
+		},
+	},
+	{
+		name: "preferredBackupWindow",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return s.PreferredBackupWindow, s.PreferredBackupWindow != ""
+		},
+		actual: func(db *rds.DBInstance) string { return aws.StringValue(db.PreferredBackupWindow) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.PreferredBackupWindow = str(s.PreferredBackupWindow)
+		},
+	},
+	{
+		name: "preferredMaintenanceWindow",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return s.PreferredMaintenanceWindow, s.PreferredMaintenanceWindow != ""
+		},
+		actual: func(db *rds.DBInstance) string { return aws.StringValue(db.PreferredMaintenanceWindow) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.PreferredMaintenanceWindow = str(s.PreferredMaintenanceWindow)
+		},
+	},
+	{
+		name:     "subnetGroup",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) { return s.SubnetGroup, s.SubnetGroup != "" },
+		actual: func(db *rds.DBInstance) string {
+			if db.DBSubnetGroup == nil {
+				return ""
+			}
+			return aws.StringValue(db.DBSubnetGroup.DBSubnetGroupName)
+		},
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.DBSubnetGroupName = str(s.SubnetGroup)
+		},
+	},
+	{
+		name: "securityGroups",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return joinSorted(s.SecurityGroups), len(s.SecurityGroups) > 0
+		},
+		actual: func(db *rds.DBInstance) string { return joinSorted(securityGroupIDs(db)) },
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.VpcSecurityGroupIds = strs(s.SecurityGroups)
+		},
+	},
+	{
+		name: "performanceInsights",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			return strconv.FormatBool(s.Monitoring != nil && s.Monitoring.PerformanceInsights), s.Monitoring != nil
+		},
+		actual: func(db *rds.DBInstance) string {
+			return strconv.FormatBool(aws.BoolValue(db.PerformanceInsightsEnabled))
+		},
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.EnablePerformanceInsights = bo(s.Monitoring.PerformanceInsights)
+			if s.Monitoring.PerformanceInsights {
+				req.PerformanceInsightsRetentionPeriod = i64(s.Monitoring.PerformanceInsightsRetentionPeriod)
+				req.PerformanceInsightsKMSKeyId = str(s.Monitoring.PerformanceInsightsKMSKeyID)
+			}
+		},
+	},
+	{
+		// The KMS key is not compared, RDS reports it as an ARN whatever
+		// form it was given in and it cannot be changed.
+		name: "performanceInsightsRetentionPeriod",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			if s.Monitoring == nil {
+				return "", false
+			}
+			p := s.Monitoring.PerformanceInsightsRetentionPeriod
+			return strI64(p), s.Monitoring.PerformanceInsights && p != 0
+		},
+		actual: func(db *rds.DBInstance) string {
+			return strI64(aws.Int64Value(db.PerformanceInsightsRetentionPeriod))
+		},
+		apply: func(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.EnablePerformanceInsights = bo(true)
+			req.PerformanceInsightsRetentionPeriod = i64(s.Monitoring.PerformanceInsightsRetentionPeriod)
+		},
+	},
+	{
+		name: "monitoringInterval",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			if s.Monitoring == nil {
+				return "", false
+			}
+			return strI64(s.Monitoring.MonitoringInterval), true
+		},
+		actual: func(db *rds.DBInstance) string { return strI64(aws.Int64Value(db.MonitoringInterval)) },
+		apply:  applyEnhancedMonitoring,
+	},
+	{
+		name: "monitoringRoleArn",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			if s.Monitoring == nil {
+				return "", false
+			}
+			return s.Monitoring.MonitoringRoleArn, s.Monitoring.MonitoringRoleArn != ""
+		},
+		actual: func(db *rds.DBInstance) string { return aws.StringValue(db.MonitoringRoleArn) },
+		apply:  applyEnhancedMonitoring,
+	},
+	{
+		name: "enableCloudwatchLogsExports",
+		declared: func(s v1alpha1.DatabaseSpec) (string, bool) {
+			if s.Monitoring == nil {
+				return "", false
+			}
+			return joinSorted(s.Monitoring.EnableCloudwatchLogsExports), true
+		},
+		actual: func(db *rds.DBInstance) string {
+			return joinSorted(aws.StringValueSlice(db.EnabledCloudwatchLogsExports))
+		},
+		apply: func(s v1alpha1.DatabaseSpec, db *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+			req.CloudwatchLogsExportConfiguration = logExportChanges(
+				s.Monitoring.EnableCloudwatchLogsExports,
+				aws.StringValueSlice(db.EnabledCloudwatchLogsExports),
+			)
+		},
+	},
+}
+
+// applyEnhancedMonitoring sets the interval and role together, RDS rejects
+// an interval without a role.
+func applyEnhancedMonitoring(s v1alpha1.DatabaseSpec, _ *rds.DBInstance, req *rds.ModifyDBInstanceInput) {
+	req.MonitoringInterval = aws.Int64(s.Monitoring.MonitoringInterval)
+	req.MonitoringRoleArn = str(s.Monitoring.MonitoringRoleArn)
+}
+
+// logExportChanges returns the log types to enable and disable to go from
+// the enabled exports to the desired ones.
+func logExportChanges(desired, enabled []string) *rds.CloudwatchLogsExportConfiguration {
+	out := &rds.CloudwatchLogsExportConfiguration{}
+	for _, l := range desired {
+		if !containsString(enabled, l) {
+			out.EnableLogTypes = append(out.EnableLogTypes, aws.String(l))
+		}
+	}
+	for _, l := range enabled {
+		if !containsString(desired, l) {
+			out.DisableLogTypes = append(out.DisableLogTypes, aws.String(l))
+		}
+	}
+	return out
+}
+
+// diffSpec lists the fields where the instance differs from the spec.
+// Storage grown by storage autoscaling is not a difference.
+func diffSpec(spec v1alpha1.DatabaseSpec, db *rds.DBInstance) (out []v1alpha1.FieldDrift) {
+	for _, f := range specFields {
+		declared, ok := f.declared(spec)
+		if !ok || f.name == "storage" && autoscaledStorage(spec, db) {
+			continue
+		}
+		actual := f.actual(db)
+		if f.name == "engineVersion" && (sameVersion(declared, actual) || minorUpgraded(spec, actual)) {
+			continue
+		}
+		if actual != declared {
+			out = append(out, v1alpha1.FieldDrift{Field: f.name, Declared: declared, Actual: actual})
+		}
+	}
+	return out
+}
+
+// modifyInput returns the modification that brings the instance in line with
+// the spec, or nil if it already matches. Values already pending on the
+// instance are treated as applied.
+func modifyInput(cr *v1alpha1.Database, db *rds.DBInstance) *rds.ModifyDBInstanceInput {
+	return modifyFields(cr, db, diffSpec(cr.Spec, effective(db)))
+}
+
+// modifyFields returns the modification applying the drifted fields from the
+// spec, or nil if there are none.
+func modifyFields(cr *v1alpha1.Database, db *rds.DBInstance, drift []v1alpha1.FieldDrift) *rds.ModifyDBInstanceInput {
+	if len(drift) == 0 {
+		return nil
+	}
+
+	req := &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		ApplyImmediately:     aws.Bool(true),
+	}
+	pending := effective(db)
+	for _, d := range drift {
+		for _, f := range specFields {
+			if f.name == d.Field {
+				f.apply(cr.Spec, pending, req)
+			}
+		}
+	}
+	return req
+}
+
+// effective returns the instance with its pending modifications applied.
+func effective(db *rds.DBInstance) *rds.DBInstance {
+	p := db.PendingModifiedValues
+	if p == nil {
+		return db
+	}
+	out := *db
+	if p.DBInstanceClass != nil {
+		out.DBInstanceClass = p.DBInstanceClass
+	}
+	if p.AllocatedStorage != nil {
+		out.AllocatedStorage = p.AllocatedStorage
+	}
+	if p.EngineVersion != nil {
+		out.EngineVersion = p.EngineVersion
+	}
+	if p.BackupRetentionPeriod != nil {
+		out.BackupRetentionPeriod = p.BackupRetentionPeriod
+	}
+	if p.Iops != nil {
+		out.Iops = p.Iops
+	}
+	if p.StorageType != nil {
+		out.StorageType = p.StorageType
+	}
+	if p.MultiAZ != nil {
+		out.MultiAZ = p.MultiAZ
+	}
+	if p.DBSubnetGroupName != nil {
+		out.DBSubnetGroup = &rds.DBSubnetGroup{DBSubnetGroupName: p.DBSubnetGroupName}
+	}
+	if l := p.PendingCloudwatchLogsExports; l != nil {
+		var enabled []*string
+		for _, t := range out.EnabledCloudwatchLogsExports {
+			if !containsString(aws.StringValueSlice(l.LogTypesToDisable), aws.StringValue(t)) {
+				enabled = append(enabled, t)
+			}
+		}
+		out.EnabledCloudwatchLogsExports = append(enabled, l.LogTypesToEnable...)
+	}
+	return &out
+}
+
+func securityGroupIDs(db *rds.DBInstance) (ids []string) {
+	for _, sg := range db.VpcSecurityGroups {
+		ids = append(ids, aws.StringValue(sg.VpcSecurityGroupId))
+	}
+	return ids
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func joinSorted(s []string) string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,199 @@
+package rds
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const checkDisasterRecovery = "disaster-recovery"
+
+// drTimeFormat is the creation time of the source snapshot in the name of a
+// copy, it sorts copies chronologically.
+const drTimeFormat = "20060102150405"
+
+// regionClients creates RDS clients for other regions on first use.
+type regionClients struct {
+	mu      sync.Mutex
+	p       client.ConfigProvider
+	clients map[string]rdsiface.RDSAPI
+}
+
+func (c *regionClients) client(region string) rdsiface.RDSAPI {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients == nil {
+		c.clients = map[string]rdsiface.RDSAPI{}
+	}
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = rds.New(c.p, aws.NewConfig().WithRegion(region))
+	}
+	return c.clients[region]
+}
+
+// copySnapshots copies the latest snapshot of the instance to each disaster
+// recovery region and prunes copies beyond the retention. Copies are named
+// after the creation time of the snapshot they were copied from, which is
+// the recovery point reported per region. A region only has one copy in
+// progress at a time, failures are reported on the region and do not hold
+// back the others.
+func (h *Handler) copySnapshots(o *v1alpha1.Database) (handled bool, err error) {
+	if o.Spec.DisasterRecovery == nil || h.regionRDS == nil {
+		return false, nil
+	}
+	now := time.Now()
+	if !h.due(checkDisasterRecovery, o, h.cfg.DisasterRecoveryInterval, now) {
+		return false, nil
+	}
+
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	dr := declared.Spec.DisasterRecovery
+
+	source, err := h.latestSnapshot(dbName(o))
+	if err != nil {
+		return false, err
+	}
+	h.markChecked(checkDisasterRecovery, o, now)
+
+	var points []v1alpha1.RecoveryPoint
+	for _, r := range dr.Regions {
+		p := h.copyToRegion(o, source, r, int(dr.Retention))
+		if p.Error != "" && p.Error != previousError(o.Status.DisasterRecovery, r.Region) {
+			recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "SnapshotCopyFailed",
+				"Copying snapshots to "+r.Region+" failed: "+p.Error)
+		}
+		if p.Time != nil {
+			recoveryPoint.WithLabelValues(o.Namespace, o.Name, r.Region).Set(float64(p.Time.Unix()))
+		}
+		points = append(points, p)
+	}
+	if reflect.DeepEqual(points, o.Status.DisasterRecovery) {
+		return false, nil
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.DisasterRecovery = points
+	return true, h.sdk.Update(copy)
+}
+
+// latestSnapshot returns the most recent available automated or manual
+// snapshot of the instance, or nil if there is none.
+func (h *Handler) latestSnapshot(id string) (*rds.DBSnapshot, error) {
+	out, err := h.rds.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{DBInstanceIdentifier: str(id)})
+	if err != nil {
+		return nil, err
+	}
+	var latest *rds.DBSnapshot
+	for _, s := range out.DBSnapshots {
+		if aws.StringValue(s.Status) != "available" || s.SnapshotCreateTime == nil {
+			continue
+		}
+		if latest == nil || s.SnapshotCreateTime.After(*latest.SnapshotCreateTime) {
+			latest = s
+		}
+	}
+	return latest, nil
+}
+
+func (h *Handler) copyToRegion(o *v1alpha1.Database, source *rds.DBSnapshot, r v1alpha1.DisasterRecoveryRegion, retention int) v1alpha1.RecoveryPoint {
+	id := dbName(o)
+	p := v1alpha1.RecoveryPoint{Region: r.Region}
+	target := h.regionRDS(r.Region)
+	logger := h.logger(o).WithField("region", r.Region)
+
+	out, err := target.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{
+		DBInstanceIdentifier: str(id),
+		SnapshotType:         str("manual"),
+	})
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	var available []string
+	existing := map[string]bool{}
+	for _, s := range out.DBSnapshots {
+		name := aws.StringValue(s.DBSnapshotIdentifier)
+		if !strings.HasPrefix(name, id+"-dr-") {
+			continue
+		}
+		existing[name] = true
+		if aws.StringValue(s.Status) == "available" {
+			available = append(available, name)
+		} else {
+			p.Copying = name
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(available)))
+	if len(available) > 0 {
+		p.Snapshot = available[0]
+		if t, err := time.Parse(drTimeFormat, strings.TrimPrefix(p.Snapshot, id+"-dr-")); err == nil {
+			mt := metav1.NewTime(t)
+			p.Time = &mt
+		}
+	}
+
+	if name := drSnapshotName(id, source); name != "" && !existing[name] && p.Copying == "" {
+		logger.WithField("snapshot", name).Info("copying snapshot")
+		_, err := target.CopyDBSnapshot(&rds.CopyDBSnapshotInput{
+			SourceDBSnapshotIdentifier: source.DBSnapshotArn,
+			TargetDBSnapshotIdentifier: str(name),
+			// The SDK presigns the request for the source region.
+			SourceRegion: str(arnRegion(aws.StringValue(source.DBSnapshotArn))),
+			KmsKeyId:     str(r.KmsKeyID),
+			CopyTags:     aws.Bool(true),
+		})
+		if err != nil {
+			p.Error = err.Error()
+			return p
+		}
+		p.Copying = name
+	}
+
+	for i := retention; i < len(available); i++ {
+		logger.WithField("snapshot", available[i]).Info("deleting expired snapshot copy")
+		_, err := target.DeleteDBSnapshot(&rds.DeleteDBSnapshotInput{DBSnapshotIdentifier: str(available[i])})
+		if err != nil && !isSnapshotNotFound(err) {
+			p.Error = err.Error()
+			return p
+		}
+	}
+	return p
+}
+
+func previousError(points []v1alpha1.RecoveryPoint, region string) string {
+	for _, p := range points {
+		if p.Region == region {
+			return p.Error
+		}
+	}
+	return ""
+}
+
+// drSnapshotName returns e.g. default-app-dr-20181020150405 for a snapshot
+// taken at that time, or "" without a snapshot.
+func drSnapshotName(id string, source *rds.DBSnapshot) string {
+	if source == nil {
+		return ""
+	}
+	return id + "-dr-" + source.SnapshotCreateTime.UTC().Format(drTimeFormat)
+}
+
+// arnRegion returns the region of an ARN, arn:aws:rds:<region>:...
+func arnRegion(arn string) string {
+	parts := strings.SplitN(arn, ":", 5)
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[3]
+}
@@ -0,0 +1,98 @@
+package rds
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func drScenario(t *testing.T) (*scenario, *fake.RDS) {
+	s := createdScenario(t, "app")
+	east := fake.New()
+	east.Region = "us-east-1"
+	s.rds.Connect(east)
+	s.h.regionRDS = func(region string) rdsiface.RDSAPI {
+		require.Equal(t, "us-east-1", region)
+		return east
+	}
+
+	db := s.sdk.database("app")
+	db.Spec.DisasterRecovery = &v1alpha1.DisasterRecovery{
+		Regions:   []v1alpha1.DisasterRecoveryRegion{{Region: "us-east-1"}},
+		Retention: 2,
+	}
+	s.apply(db)
+	s.settle("app")
+	require.NoError(t, s.sync("app"))
+	return s, east
+}
+
+// snapshot takes an automated snapshot of the instance an hour after the
+// previous one.
+func snapshot(s *scenario, name string) time.Time {
+	s.rds.Advance(time.Hour)
+	s.rds.AddSnapshot(name, s.rds.Instance("default-app"), "automated")
+	return *s.rds.Snapshot(name).SnapshotCreateTime
+}
+
+func copies(t *testing.T, east *fake.RDS) (names []string) {
+	out, err := east.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{})
+	require.NoError(t, err)
+	for _, s := range out.DBSnapshots {
+		names = append(names, aws.StringValue(s.DBSnapshotIdentifier))
+	}
+	return names
+}
+
+func TestDisasterRecovery_CopiesAndPrunes(t *testing.T) {
+	s, east := drScenario(t)
+	require.Equal(t, []v1alpha1.RecoveryPoint{{Region: "us-east-1"}}, s.sdk.database("app").Status.DisasterRecovery)
+
+	var taken []time.Time
+	for _, name := range []string{"rds:default-app-1", "rds:default-app-2", "rds:default-app-3"} {
+		taken = append(taken, snapshot(s, name))
+		require.NoError(t, s.sync("app"))
+		point := s.sdk.database("app").Status.DisasterRecovery[0]
+		require.Equal(t, drSnapshotName("default-app", s.rds.Snapshot(name)), point.Copying)
+
+		s.rds.Advance(time.Minute)
+		require.NoError(t, s.sync("app"))
+		point = s.sdk.database("app").Status.DisasterRecovery[0]
+		require.Empty(t, point.Copying)
+		require.Empty(t, point.Error)
+		require.Equal(t, taken[len(taken)-1].Unix(), point.Time.Unix())
+	}
+	require.Equal(t, 3, east.Calls("CopyDBSnapshot"))
+
+	// The oldest copy is pruned on the next check.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, []string{
+		drSnapshotName("default-app", s.rds.Snapshot("rds:default-app-2")),
+		drSnapshotName("default-app", s.rds.Snapshot("rds:default-app-3")),
+	}, copies(t, east))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 3, east.Calls("CopyDBSnapshot"))
+}
+
+func TestDisasterRecovery_CopyFailure(t *testing.T) {
+	s, east := drScenario(t)
+	snapshot(s, "rds:default-app-1")
+
+	east.Fail("CopyDBSnapshot", errors.New("KMSKeyNotAccessibleFault"), 1)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "KMSKeyNotAccessibleFault", s.sdk.database("app").Status.DisasterRecovery[0].Error)
+	require.Len(t, events(s, "SnapshotCopyFailed"), 1)
+
+	require.NoError(t, s.sync("app"))
+	point := s.sdk.database("app").Status.DisasterRecovery[0]
+	require.Empty(t, point.Error)
+	require.NotEmpty(t, point.Copying)
+}
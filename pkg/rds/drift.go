@@ -0,0 +1,196 @@
+package rds
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deferDriftRevert is the reason recorded for drift reverts deferred by a
+// change freeze.
+const deferDriftRevert = "DriftRevert"
+
+const checkDrift = "drift"
+
+// driftPolicy returns the policy for the database, falling back to the
+// operator default and then to Ignore.
+func (h *Handler) driftPolicy(o *v1alpha1.Database) string {
+	policy := o.Spec.DriftPolicy
+	if policy == "" {
+		policy = h.cfg.DriftPolicy
+	}
+	switch policy {
+	case v1alpha1.DriftPolicyRevert, v1alpha1.DriftPolicyReport:
+		return policy
+	case "", v1alpha1.DriftPolicyIgnore:
+	default:
+		h.logger(o).WithField("policy", policy).Warn("unknown drift policy, ignoring drift")
+	}
+	return v1alpha1.DriftPolicyIgnore
+}
+
+// due reports whether the check last ran on the database at least interval
+// ago.
+func (h *Handler) due(check string, o *v1alpha1.Database, interval time.Duration, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	last, ok := h.checked[check+"/"+dbName(o)]
+	return !ok || now.Sub(last) >= interval
+}
+
+func (h *Handler) markChecked(check string, o *v1alpha1.Database, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checked == nil {
+		h.checked = map[string]time.Time{}
+	}
+	h.checked[check+"/"+dbName(o)] = now
+}
+
+func (h *Handler) forgetChecks(o *v1alpha1.Database) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key := range h.checked {
+		if strings.HasSuffix(key, "/"+dbName(o)) {
+			delete(h.checked, key)
+		}
+	}
+}
+
+// auditDrift compares the instance with the spec. Depending on the drift
+// policy differences are reverted with a modification or only reported, both
+// are surfaced as the Drifted condition. Instances in the middle of an
+// operation are audited again on a later sync.
+func (h *Handler) auditDrift(o *v1alpha1.Database) error {
+	policy := h.driftPolicy(o)
+	if policy == v1alpha1.DriftPolicyIgnore {
+		return nil
+	}
+	now := time.Now()
+	if !h.due(checkDrift, o, h.cfg.DriftInterval, now) {
+		return nil
+	}
+
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return nil
+	}
+
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	drift := diffSpec(declared.Spec, effective(db))
+
+	// Automatic minor upgrades move the instance past spec.engineVersion,
+	// the version it runs is recorded rather than reported as drift.
+	version := o.Status.EngineVersion
+	if actual := aws.StringValue(db.EngineVersion); minorUpgraded(declared.Spec, actual) {
+		version = actual
+	}
+
+	logger := h.logger(o).WithField("policy", policy)
+	cond := v1alpha1.DatabaseCondition{
+		Type:   v1alpha1.ConditionDrifted,
+		Status: corev1.ConditionFalse,
+		Reason: "InSync",
+	}
+	var deferred *v1alpha1.DeferredAction
+	if len(drift) > 0 {
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = "Reported"
+		cond.Message = driftMessage(drift)
+		logger = logger.WithField("drift", cond.Message)
+
+		revert := revertable(o, drift)
+		if policy == v1alpha1.DriftPolicyRevert && len(revert) > 0 {
+			logger.Warn("reverting drift")
+			deferred, err = h.modify(o, deferDriftRevert, modifyFields(declared, db, revert))
+			if err != nil {
+				return err
+			}
+			if deferred != nil {
+				cond.Reason = "Deferred"
+			} else {
+				cond.Reason = "Reverted"
+				recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "DriftReverted",
+					"Reverted changes made outside the operator: "+cond.Message)
+			}
+		} else if !reflect.DeepEqual(drift, o.Status.Drift) {
+			logger.Warn("detected drift")
+			recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "DriftDetected",
+				"Instance differs from the spec: "+cond.Message)
+		}
+	}
+	h.markChecked(checkDrift, o, now)
+
+	conditions, changed := setCondition(o.Status.Conditions, cond, now)
+	pending := setDeferred(o.Status.Deferred, deferDriftRevert, deferred)
+	if !changed && reflect.DeepEqual(drift, o.Status.Drift) && sameDeferred(pending, o.Status.Deferred) &&
+		version == o.Status.EngineVersion {
+		return nil
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.EngineVersion = version
+	copy.Status.Drift = drift
+	copy.Status.Conditions = conditions
+	copy.Status.Deferred = pending
+	return h.sdk.Update(copy)
+}
+
+// revertable returns the drifted fields a drift revert modifies. Engine
+// versions are only changed by the upgrade workflow and fields that need a
+// new instance by a replacement.
+func revertable(o *v1alpha1.Database, drift []v1alpha1.FieldDrift) []v1alpha1.FieldDrift {
+	var revert []v1alpha1.FieldDrift
+	for _, d := range drift {
+		if d.Field != "engineVersion" && !containsString(replacing(o), d.Field) {
+			revert = append(revert, d)
+		}
+	}
+	return revert
+}
+
+func driftMessage(drift []v1alpha1.FieldDrift) string {
+	parts := make([]string, 0, len(drift))
+	for _, d := range drift {
+		parts = append(parts, fmt.Sprintf("%s: declared %q, actual %q", d.Field, d.Declared, d.Actual))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// setCondition adds or replaces the condition of the same type, keeping the
+// transition time when the status is unchanged.
+func setCondition(conds []v1alpha1.DatabaseCondition, c v1alpha1.DatabaseCondition,
+	now time.Time) ([]v1alpha1.DatabaseCondition, bool) {
+	out := make([]v1alpha1.DatabaseCondition, 0, len(conds)+1)
+	found := false
+	for _, existing := range conds {
+		if existing.Type != c.Type {
+			out = append(out, existing)
+			continue
+		}
+		found = true
+		if existing.Status == c.Status && existing.Reason == c.Reason && existing.Message == c.Message {
+			return conds, false
+		}
+		c.LastTransitionTime = existing.LastTransitionTime
+		if existing.Status != c.Status {
+			c.LastTransitionTime = metav1.NewTime(now)
+		}
+		out = append(out, c)
+	}
+	if !found {
+		c.LastTransitionTime = metav1.NewTime(now)
+		out = append(out, c)
+	}
+	return out, true
+}
@@ -0,0 +1,116 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// consoleChange modifies the instance outside the operator.
+func consoleChange(s *scenario, id string) {
+	_, err := s.rds.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String(id),
+		DBInstanceClass:      aws.String("db.m4.large"),
+		ApplyImmediately:     aws.Bool(true),
+	})
+	require.NoError(s.t, err)
+	s.rds.Advance(10 * time.Minute)
+}
+
+// setDriftPolicy sets the policy and settles the database so the next sync
+// audits it.
+func setDriftPolicy(s *scenario, name, policy string) {
+	db := s.sdk.database(name)
+	db.Spec.DriftPolicy = policy
+	s.apply(db)
+	s.settle(name)
+}
+
+func driftedCondition(db *v1alpha1.Database) *v1alpha1.DatabaseCondition {
+	for _, c := range db.Status.Conditions {
+		if c.Type == v1alpha1.ConditionDrifted {
+			return &c
+		}
+	}
+	return nil
+}
+
+func TestDrift_Report(t *testing.T) {
+	s := createdScenario(t, "app")
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyReport)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, corev1.ConditionFalse, driftedCondition(s.sdk.database("app")).Status)
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+
+	db := s.sdk.database("app")
+	require.Equal(t, []v1alpha1.FieldDrift{
+		{Field: "instanceClass", Declared: "db.t2.micro", Actual: "db.m4.large"},
+	}, db.Status.Drift)
+	cond := driftedCondition(db)
+	require.Equal(t, corev1.ConditionTrue, cond.Status)
+	require.Equal(t, "Reported", cond.Reason)
+	require.Contains(t, cond.Message, `instanceClass: declared "db.t2.micro", actual "db.m4.large"`)
+	require.Len(t, events(s, "DriftDetected"), 1)
+
+	// Reporting does not touch the instance or repeat the event.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+	require.Len(t, events(s, "DriftDetected"), 1)
+	require.Equal(t, "db.m4.large", *s.rds.Instance("default-app").DBInstanceClass)
+}
+
+func TestDrift_Revert(t *testing.T) {
+	s := createdScenario(t, "app")
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	require.Equal(t, "Reverted", driftedCondition(s.sdk.database("app")).Reason)
+	require.Len(t, events(s, "DriftReverted"), 1)
+
+	// The instance is modifying, the audit waits for it.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	db := s.sdk.database("app")
+	require.Equal(t, "db.t2.micro", *s.rds.Instance("default-app").DBInstanceClass)
+	require.Empty(t, db.Status.Drift)
+	require.Equal(t, corev1.ConditionFalse, driftedCondition(db).Status)
+}
+
+func TestDrift_Ignore(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.h.cfg.DriftPolicy = v1alpha1.DriftPolicyRevert
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyIgnore)
+
+	consoleChange(s, "default-app")
+	describes := s.rds.Calls("DescribeDBInstances")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, describes, s.rds.Calls("DescribeDBInstances"))
+	require.Nil(t, driftedCondition(s.sdk.database("app")))
+}
+
+func TestDrift_Interval(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.h.cfg.DriftPolicy = v1alpha1.DriftPolicyReport
+	s.h.cfg.DriftInterval = time.Hour
+	setDriftPolicy(s, "app", "")
+
+	require.NoError(t, s.sync("app"))
+	require.NotNil(t, driftedCondition(s.sdk.database("app")))
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+	require.Empty(t, s.sdk.database("app").Status.Drift)
+}
@@ -1,8 +1,6 @@
 package rds
 
 import (
-	"bytes"
-	"encoding/base64"
 	"strconv"
 )
 
@@ -31,25 +29,16 @@ func bo(b bool) *bool {
 	return &b
 }
 
-func enc(src []byte) []byte {
-	if len(src) == 0 {
-		return nil
-	}
-	buf := bytes.NewBuffer(nil)
-	base64.NewEncoder(base64.RawStdEncoding, buf)
-	return buf.Bytes()
-}
-
 func strI64(i int64) string {
 	return strconv.FormatInt(i, 10)
 }
 
+// encStr and encI64 return secret data. The API server base64 encodes secret
+// data itself, the values are stored as they are.
 func encStr(s string) []byte {
-	src := []byte(s)
-	return enc(src)
+	return []byte(s)
 }
 
 func encI64(i int64) []byte {
-	src := []byte(strconv.FormatInt(i, 10))
-	return enc(src)
+	return []byte(strconv.FormatInt(i, 10))
 }
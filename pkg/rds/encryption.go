@@ -0,0 +1,328 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// deferEncryption is the reason recorded when the final step of an
+// encryption migration is deferred by a change freeze.
+const deferEncryption = "Encryption"
+
+// defaultKmsKey encrypts the snapshot copy when spec.kmsKeyId is empty.
+const defaultKmsKey = "alias/aws/rds"
+
+// encrypt migrates an unencrypted instance once spec.encrypted is set. RDS
+// cannot encrypt an instance in place, so a snapshot is copied with the KMS
+// key and restored into a new instance the secret is switched to. Once the
+// migration is confirmed with the confirm-encryption annotation the
+// unencrypted instance is deleted with a final snapshot and the new instance
+// renamed to take over its identifier. Each step is recorded in
+// status.encryption, handled is false when there is nothing to do.
+func (h *Handler) encrypt(o *v1alpha1.Database) (handled bool, err error) {
+	e := o.Status.Encryption
+	running := e != nil && e.Phase != v1alpha1.EncryptionPhaseCompleted && e.Phase != v1alpha1.EncryptionPhaseFailed
+	if !running {
+		if !o.Spec.Encrypted || o.Status.StorageEncrypted {
+			return false, nil
+		}
+		if e != nil && e.Phase == v1alpha1.EncryptionPhaseFailed && e.KmsKeyID == o.Spec.KmsKeyID {
+			return false, nil
+		}
+		return true, h.startEncryption(o)
+	}
+
+	e = e.DeepCopy()
+	switch e.Phase {
+	case v1alpha1.EncryptionPhaseSnapshotting:
+		return true, h.copyEncrypted(o, e)
+	case v1alpha1.EncryptionPhaseCopying:
+		return true, h.restoreEncrypted(o, e)
+	case v1alpha1.EncryptionPhaseRestoring:
+		return true, h.switchEncrypted(o, e)
+	case v1alpha1.EncryptionPhaseAwaitingConfirmation:
+		return true, h.retireUnencrypted(o, e)
+	case v1alpha1.EncryptionPhaseRetiring:
+		return true, h.renameEncrypted(o, e)
+	default:
+		return true, h.finishEncryption(o, e)
+	}
+}
+
+func (h *Handler) startEncryption(o *v1alpha1.Database) error {
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.BoolValue(db.StorageEncrypted) {
+		copy := o.DeepCopy()
+		copy.Status.StorageEncrypted = true
+		return h.sdk.Update(copy)
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return nil
+	}
+
+	id := aws.StringValue(db.DBInstanceIdentifier)
+	e := &v1alpha1.EncryptionStatus{
+		Phase:    v1alpha1.EncryptionPhaseSnapshotting,
+		KmsKeyID: o.Spec.KmsKeyID,
+		Snapshot: encryptionSnapshotName(id, time.Now()),
+	}
+	h.logger(o).WithField("snapshot", e.Snapshot).Info("starting encryption migration")
+
+	_, err = h.rds.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		DBSnapshotIdentifier: str(e.Snapshot),
+	})
+	if err != nil {
+		return err
+	}
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "EncryptionStarted",
+		fmt.Sprintf("Encrypting instance %s from snapshot %s, writes after the snapshot are not migrated",
+			id, e.Snapshot))
+	return h.setEncryption(o, e)
+}
+
+func (h *Handler) copyEncrypted(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	if ok, err := h.snapshotAvailable(e.Snapshot); !ok || err != nil {
+		return err
+	}
+
+	key := e.KmsKeyID
+	if key == "" {
+		key = defaultKmsKey
+	}
+	e.EncryptedSnapshot = e.Snapshot + "-encrypted"
+	_, err := h.rds.CopyDBSnapshot(&rds.CopyDBSnapshotInput{
+		SourceDBSnapshotIdentifier: str(e.Snapshot),
+		TargetDBSnapshotIdentifier: str(e.EncryptedSnapshot),
+		KmsKeyId:                   str(key),
+		CopyTags:                   aws.Bool(true),
+	})
+	if err != nil && !isSnapshotAlreadyExists(err) {
+		if isTransient(err) {
+			return err
+		}
+		return h.encryptionFailed(o, e, err.Error())
+	}
+
+	e.Phase = v1alpha1.EncryptionPhaseCopying
+	return h.setEncryption(o, e)
+}
+
+func (h *Handler) restoreEncrypted(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	if ok, err := h.snapshotAvailable(e.EncryptedSnapshot); !ok || err != nil {
+		return err
+	}
+
+	e.Instance = naming.Suffix(dbName(o), "-encrypted")
+	_, err := h.rds.RestoreDBInstanceFromDBSnapshot(h.restoreInput(o, e.Instance, e.EncryptedSnapshot))
+	if err != nil && !isAlreadyExists(err) {
+		if isTransient(err) {
+			return err
+		}
+		return h.encryptionFailed(o, e, err.Error())
+	}
+
+	e.Phase = v1alpha1.EncryptionPhaseRestoring
+	return h.setEncryption(o, e)
+}
+
+func (h *Handler) switchEncrypted(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	db, err := h.describeInstance(e.Instance)
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" || db.Endpoint == nil {
+		return nil
+	}
+	if err := h.sdk.Update(h.createSecret(o, db)); err != nil {
+		return err
+	}
+
+	e.Phase = v1alpha1.EncryptionPhaseAwaitingConfirmation
+	e.Message = fmt.Sprintf("the secret points at encrypted instance %s, annotate the database with %s=true "+
+		"to delete unencrypted instance %s", e.Instance, v1alpha1.AnnotationConfirmEncryption, dbName(o))
+	h.logger(o).WithField("instance", e.Instance).Info("encrypted instance is available")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "EncryptedInstanceReady",
+		"The "+e.Message)
+	return h.setEncryption(o, e)
+}
+
+func (h *Handler) retireUnencrypted(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	if o.Annotations[v1alpha1.AnnotationConfirmEncryption] != "true" {
+		return nil
+	}
+
+	deferred, err := h.unprotect(o, deferEncryption)
+	if err != nil {
+		return err
+	}
+	if deferred == nil {
+		h.logger(o).Info("deleting unencrypted instance")
+		_, err = h.rds.DeleteDBInstance(deleteInput(o, time.Now()))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		e.Phase = v1alpha1.EncryptionPhaseRetiring
+		e.Message = ""
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferEncryption, deferred)
+	if deferred != nil && sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	copy.Status.Encryption = e
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) renameEncrypted(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	renamed, deferred, err := h.takeOver(o, e.Instance, deferEncryption)
+	if err != nil || !renamed && deferred == nil {
+		return err
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferEncryption, deferred)
+	if renamed {
+		e.Phase = v1alpha1.EncryptionPhaseRenaming
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	copy.Status.Encryption = e
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) finishEncryption(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	db, err := h.getDB(o)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" || db.Endpoint == nil {
+		return nil
+	}
+	if err := h.sdk.Update(h.createSecret(o, db)); err != nil {
+		return err
+	}
+
+	h.logger(o).Info("encryption migration completed")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "EncryptionCompleted",
+		fmt.Sprintf("Instance %s is encrypted, the unencrypted instance was deleted with a final snapshot", dbName(o)))
+
+	e.Phase = v1alpha1.EncryptionPhaseCompleted
+	e.Instance = ""
+	copy := o.DeepCopy()
+	copy.Status.Encryption = e
+	copy.Status.StorageEncrypted = aws.BoolValue(db.StorageEncrypted)
+	// The encrypted instance was created without deletion protection or
+	// storage autoscaling.
+	copy.Status.DeletionProtection = false
+	copy.Status.MaxAllocatedStorage = 0
+	return h.sdk.Update(copy)
+}
+
+// deleteEncrypted deletes the encrypted instance of a migration that has not
+// taken over the original identifier yet.
+func (h *Handler) deleteEncrypted(o *v1alpha1.Database) {
+	e := o.Status.Encryption
+	if e == nil || e.Instance == "" || e.Phase == v1alpha1.EncryptionPhaseRenaming {
+		return
+	}
+	h.discard(o, e.Instance)
+}
+
+func (h *Handler) encryptionFailed(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus, msg string) error {
+	h.logger(o).Warn("encryption migration failed: " + msg)
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "EncryptionFailed",
+		"Encryption failed: "+msg)
+
+	e.Phase = v1alpha1.EncryptionPhaseFailed
+	e.Message = msg
+	return h.setEncryption(o, e)
+}
+
+func (h *Handler) setEncryption(o *v1alpha1.Database, e *v1alpha1.EncryptionStatus) error {
+	h.logger(o).WithField("phase", e.Phase).Debug("set encryption status")
+
+	copy := o.DeepCopy()
+	copy.Status.Encryption = e
+	return h.sdk.Update(copy)
+}
+
+// encryptionSnapshotName returns e.g.
+// default-app-pre-encryption-20181020150405.
+func encryptionSnapshotName(id string, now time.Time) string {
+	return id + "-pre-encryption-" + now.UTC().Format("20060102150405")
+}
+
+// restoreInput restores the snapshot into a new instance configured from the
+// spec. Settings the restore cannot take are applied when the instance takes
+// over the identifier.
+func (h *Handler) restoreInput(o *v1alpha1.Database, instance, snapshot string) *rds.RestoreDBInstanceFromDBSnapshotInput {
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	spec := declared.Spec
+	return &rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBInstanceIdentifier:    str(instance),
+		DBSnapshotIdentifier:    str(snapshot),
+		DBInstanceClass:         str(spec.InstanceClass),
+		DBSubnetGroupName:       str(spec.SubnetGroup),
+		AvailabilityZone:        str(spec.AvailabilityZone),
+		StorageType:             str(spec.StorageType),
+		Iops:                    i64(spec.Iops),
+		MultiAZ:                 bo(spec.MultiAZ),
+		AutoMinorVersionUpgrade: bo(spec.AutoMinorVersionUpgrade),
+		Tags:                    tagList(h.tags(o)),
+	}
+}
+
+// takeOver renames the instance to the identifier of the database once the
+// original instance is deleted, settings the instance was created without
+// are applied with the rename. Renamed is false while waiting or when the
+// rename is deferred by a change freeze.
+func (h *Handler) takeOver(o *v1alpha1.Database, instance, reason string) (renamed bool, deferred *v1alpha1.DeferredAction, err error) {
+	if _, err := h.getDB(o); !isNotFound(err) {
+		return false, nil, err
+	}
+	db, err := h.describeInstance(instance)
+	if err != nil || db == nil {
+		return false, nil, err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return false, nil, nil
+	}
+
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	req := modifyInput(declared, db)
+	if req == nil {
+		req = &rds.ModifyDBInstanceInput{DBInstanceIdentifier: db.DBInstanceIdentifier, ApplyImmediately: aws.Bool(true)}
+	}
+	req.EngineVersion = nil
+	req.NewDBInstanceIdentifier = str(dbName(o))
+
+	deferred, err = h.modify(o, reason, req)
+	return err == nil && deferred == nil, deferred, err
+}
+
+// discard deletes an instance created for the database with a final
+// snapshot, errors are only logged.
+func (h *Handler) discard(o *v1alpha1.Database, instance string) {
+	_, err := h.rds.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      str(instance),
+		FinalDBSnapshotIdentifier: str(finalSnapshotName(instance, time.Now())),
+	})
+	if err != nil && !isNotFound(err) {
+		h.logger(o).WithError(err).WithField("instance", instance).
+			Error("deleting instance failed")
+	}
+}
@@ -0,0 +1,130 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptionStatus(s *scenario) *v1alpha1.EncryptionStatus {
+	return s.sdk.database("app").Status.Encryption
+}
+
+// encryptionScenario runs an encryption migration of an unencrypted instance
+// until it waits for confirmation.
+func encryptionScenario(t *testing.T) *scenario {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.Encrypted = true
+	db.Spec.KmsKeyID = "alias/app"
+	db.Spec.BackupRetentionPeriod = 7
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseSnapshotting, encryptionStatus(s).Phase)
+	require.Len(t, events(s, "EncryptionStarted"), 1)
+
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	e := encryptionStatus(s)
+	require.Equal(t, v1alpha1.EncryptionPhaseCopying, e.Phase)
+	require.Equal(t, e.Snapshot+"-encrypted", e.EncryptedSnapshot)
+
+	s.rds.Advance(time.Minute)
+	snap := s.rds.Snapshot(e.EncryptedSnapshot)
+	require.True(t, aws.BoolValue(snap.Encrypted))
+	require.Equal(t, "alias/app", aws.StringValue(snap.KmsKeyId))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseRestoring, encryptionStatus(s).Phase)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseRestoring, encryptionStatus(s).Phase)
+
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	e = encryptionStatus(s)
+	require.Equal(t, v1alpha1.EncryptionPhaseAwaitingConfirmation, e.Phase)
+	require.Equal(t, "default-app-encrypted", e.Instance)
+	require.Contains(t, e.Message, v1alpha1.AnnotationConfirmEncryption)
+	require.Len(t, events(s, "EncryptedInstanceReady"), 1)
+
+	encrypted := s.rds.Instance("default-app-encrypted")
+	require.True(t, aws.BoolValue(encrypted.StorageEncrypted))
+	require.Equal(t, *encrypted.Endpoint.Address, string(s.sdk.secret("app-db-credentials").Data["host"]))
+	return s
+}
+
+func TestEncryption_Migration(t *testing.T) {
+	s := encryptionScenario(t)
+
+	// Nothing is retired without confirmation.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationConfirmEncryption: "true"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseRetiring, encryptionStatus(s).Phase)
+	require.Equal(t, 1, s.rds.Calls("DeleteDBInstance"))
+
+	// The rename waits for the unencrypted instance to be deleted.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseRetiring, encryptionStatus(s).Phase)
+
+	s.rds.Advance(3 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.EncryptionPhaseRenaming, encryptionStatus(s).Phase)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	e := encryptionStatus(s)
+	require.Equal(t, v1alpha1.EncryptionPhaseCompleted, e.Phase)
+	require.Empty(t, e.Instance)
+	require.True(t, s.sdk.database("app").Status.StorageEncrypted)
+	require.Len(t, events(s, "EncryptionCompleted"), 1)
+
+	require.Nil(t, s.rds.Instance("default-app-encrypted"))
+	instance := s.rds.Instance("default-app")
+	require.True(t, aws.BoolValue(instance.StorageEncrypted))
+	require.Equal(t, "alias/app", aws.StringValue(instance.KmsKeyId))
+	// Applied with the rename, the restore does not set it.
+	require.Equal(t, int64(7), aws.Int64Value(instance.BackupRetentionPeriod))
+	require.Equal(t, *instance.Endpoint.Address, string(s.sdk.secret("app-db-credentials").Data["host"]))
+
+	calls := s.rds.Calls("DescribeDBInstances")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, calls, s.rds.Calls("DescribeDBInstances"))
+}
+
+func TestEncryption_DeleteDuringMigration(t *testing.T) {
+	s := encryptionScenario(t)
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, 2, s.rds.Calls("DeleteDBInstance"))
+	s.rds.Advance(3 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+	require.Nil(t, s.rds.Instance("default-app-encrypted"))
+}
+
+func TestEncryption_AlreadyEncrypted(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.Encrypted = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+
+	db = s.sdk.database("app")
+	require.True(t, db.Status.StorageEncrypted)
+	require.Nil(t, db.Status.Encryption)
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+}
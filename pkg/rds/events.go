@@ -0,0 +1,62 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const eventSource = "rds-operator"
+
+// databaseRef references a database in events, it does not need to exist.
+func databaseRef(namespace, name string) corev1.ObjectReference {
+	return objectRef("Database", namespace, name)
+}
+
+// objectRef references an object of the operator's API group in events.
+func objectRef(kind, namespace, name string) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		Kind:       kind,
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
+
+func newEvent(ref corev1.ObjectReference, eventType, reason, message string, now time.Time) *corev1.Event {
+	ts := metav1.NewTime(now)
+	return &corev1.Event{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ref.Namespace,
+			Name:      fmt.Sprintf("%s.%x", ref.Name, now.UnixNano()),
+		},
+		InvolvedObject: ref,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: eventSource},
+		FirstTimestamp: ts,
+		LastTimestamp:  ts,
+		Count:          1,
+	}
+}
+
+// recordEvent creates an event, failures are only logged since events are
+// informational.
+func recordEvent(s SDK, ref corev1.ObjectReference, eventType, reason, message string) {
+	err := s.Create(newEvent(ref, eventType, reason, message, time.Now()))
+	if err != nil {
+		log.WithError(err).
+			WithField("object", ref.Namespace+"/"+ref.Name).
+			WithField("reason", reason).
+			Warn("failed to record event")
+	}
+}
@@ -0,0 +1,202 @@
+package fake
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// StatusUpgrading is reported while an engine version upgrade is applied.
+const StatusUpgrading = "upgrading"
+
+type engineKey struct{ engine, version string }
+
+// defaultEngineVersions seeds the catalog with a small Postgres upgrade path.
+var defaultEngineVersions = []struct {
+	engine, version, family string
+	targets                 []string
+}{
+	{"postgres", "9.6.9", "postgres9.6", []string{"10.4"}},
+	{"postgres", "10.4", "postgres10", []string{"10.5", "11.1"}},
+	{"postgres", "10.5", "postgres10", []string{"11.1"}},
+	{"postgres", "11.1", "postgres11", nil},
+}
+
+// AddEngineVersion adds an engine version to the catalog, upgrade targets
+// must be added before the versions that can upgrade to them.
+func (f *RDS) AddEngineVersion(engine, version, family string, targets ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addEngineVersion(engine, version, family, targets...)
+}
+
+func (f *RDS) addEngineVersion(engine, version, family string, targets ...string) {
+	v := &rds.DBEngineVersion{
+		Engine:                 str(engine),
+		EngineVersion:          str(version),
+		DBParameterGroupFamily: str(family),
+	}
+	for _, target := range targets {
+		t, ok := f.engineVersions[engineKey{engine, target}]
+		major := ok && *t.DBParameterGroupFamily != family
+		v.ValidUpgradeTarget = append(v.ValidUpgradeTarget, &rds.UpgradeTarget{
+			Engine:                str(engine),
+			EngineVersion:         str(target),
+			IsMajorVersionUpgrade: bo(major),
+			AutoUpgrade:           bo(false),
+		})
+	}
+	f.engineVersions[engineKey{engine, version}] = v
+}
+
+// FailUpgrade makes the next engine upgrade of the instance fail once it has
+// been started, leaving the instance on its current version like a failed
+// RDS pre-upgrade check.
+func (f *RDS) FailUpgrade(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i, ok := f.instances[id]; ok {
+		i.failUpgrade = true
+	}
+}
+
+// DescribeDBEngineVersions filters the catalog by engine, version and
+// parameter group family.
+func (f *RDS) DescribeDBEngineVersions(in *rds.DescribeDBEngineVersionsInput) (*rds.DescribeDBEngineVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeDBEngineVersions"); err != nil {
+		return &rds.DescribeDBEngineVersionsOutput{}, err
+	}
+
+	keys := make([]engineKey, 0, len(f.engineVersions))
+	for k := range f.engineVersions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].engine != keys[j].engine {
+			return keys[i].engine < keys[j].engine
+		}
+		return keys[i].version < keys[j].version
+	})
+
+	out := &rds.DescribeDBEngineVersionsOutput{}
+	for _, k := range keys {
+		v := f.engineVersions[k]
+		if in.Engine != nil && *in.Engine != k.engine {
+			continue
+		}
+		if in.EngineVersion != nil && *in.EngineVersion != k.version {
+			continue
+		}
+		if in.DBParameterGroupFamily != nil && *in.DBParameterGroupFamily != *v.DBParameterGroupFamily {
+			continue
+		}
+		out.DBEngineVersions = append(out.DBEngineVersions, awsutil.CopyOf(v).(*rds.DBEngineVersion))
+	}
+	return out, nil
+}
+
+// checkUpgrade validates an engine version change like RDS does. Versions
+// missing from the catalog are not validated.
+func (f *RDS) checkUpgrade(db *rds.DBInstance, in *rds.ModifyDBInstanceInput) error {
+	if in.EngineVersion == nil || db.EngineVersion == nil || *in.EngineVersion == *db.EngineVersion {
+		return nil
+	}
+	current, ok := f.engineVersions[engineKey{*db.Engine, *db.EngineVersion}]
+	if !ok {
+		return nil
+	}
+
+	var target *rds.UpgradeTarget
+	for _, t := range current.ValidUpgradeTarget {
+		if *t.EngineVersion == *in.EngineVersion {
+			target = t
+		}
+	}
+	if target == nil {
+		return awserr.New("InvalidParameterCombination", "Cannot upgrade "+*db.Engine+" from "+
+			*db.EngineVersion+" to "+*in.EngineVersion, nil)
+	}
+	if !*target.IsMajorVersionUpgrade {
+		return nil
+	}
+	if in.AllowMajorVersionUpgrade == nil || !*in.AllowMajorVersionUpgrade {
+		return awserr.New("InvalidParameterCombination",
+			"The AllowMajorVersionUpgrade flag must be present when upgrading to a new major version.", nil)
+	}
+
+	family := *f.engineVersions[engineKey{*db.Engine, *in.EngineVersion}].DBParameterGroupFamily
+	groups := db.DBParameterGroups
+	if in.DBParameterGroupName != nil {
+		groups = []*rds.DBParameterGroupStatus{{DBParameterGroupName: in.DBParameterGroupName}}
+	}
+	for _, g := range groups {
+		pg, ok := f.parameterGroups[*g.DBParameterGroupName]
+		if ok && *pg.DBParameterGroupFamily != family {
+			return awserr.New("InvalidParameterCombination", "The parameter group "+*g.DBParameterGroupName+
+				" can't be used for this instance. Use a parameter group with DBParameterGroupFamily "+family+".", nil)
+		}
+	}
+	return nil
+}
+
+// RestoreDBInstanceFromDBSnapshot creates an instance from an available
+// snapshot, it becomes available after CreateDuration.
+func (f *RDS) RestoreDBInstanceFromDBSnapshot(in *rds.RestoreDBInstanceFromDBSnapshotInput) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RestoreDBInstanceFromDBSnapshot"); err != nil {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, err
+	}
+
+	snapID := *in.DBSnapshotIdentifier
+	s, ok := f.snapshots[snapID]
+	if !ok {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, notFound(rds.ErrCodeDBSnapshotNotFoundFault,
+			"DBSnapshot", snapID)
+	}
+	if *s.snap.Status != StatusAvailable {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, invalidState(rds.ErrCodeInvalidDBSnapshotStateFault,
+			"DBSnapshot", snapID, *s.snap.Status)
+	}
+	id := *in.DBInstanceIdentifier
+	if err := checkIdentifier(id); err != nil {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, err
+	}
+	if _, ok := f.instances[id]; ok {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, awserr.New(rds.ErrCodeDBInstanceAlreadyExistsFault,
+			"DB instance already exists", nil)
+	}
+	if f.InstanceQuota > 0 && len(f.instances) >= f.InstanceQuota {
+		return &rds.RestoreDBInstanceFromDBSnapshotOutput{}, QuotaExceeded()
+	}
+
+	snap := s.snap
+	db := &rds.DBInstance{
+		DBInstanceIdentifier: in.DBInstanceIdentifier,
+		DBInstanceArn:        str(f.arn("db", id)),
+		DBInstanceStatus:     str(StatusCreating),
+		DBInstanceClass:      in.DBInstanceClass,
+		Engine:               snap.Engine,
+		EngineVersion:        snap.EngineVersion,
+		MasterUsername:       snap.MasterUsername,
+		AllocatedStorage:     snap.AllocatedStorage,
+		StorageEncrypted:     snap.Encrypted,
+		KmsKeyId:             snap.KmsKeyId,
+		StorageType:          snap.StorageType,
+		Iops:                 snap.Iops,
+		MultiAZ:              in.MultiAZ,
+	}
+	if in.StorageType != nil {
+		db.StorageType = in.StorageType
+		db.Iops = in.Iops
+	}
+	db.DBSubnetGroup = f.subnetGroup(in.DBSubnetGroupName)
+
+	f.instances[id] = &instance{db: db, readyAt: f.Clock.Now().Add(f.CreateDuration)}
+	f.setTags(*db.DBInstanceArn, in.Tags)
+	return &rds.RestoreDBInstanceFromDBSnapshotOutput{DBInstance: copyInstance(db)}, nil
+}
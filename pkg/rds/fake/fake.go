@@ -0,0 +1,351 @@
+// Package fake provides a stateful in-memory RDS backend for tests.
+//
+// Unlike per-call mocks the fake keeps track of instances, snapshots and
+// parameter groups, and moves them through the RDS status lifecycle as its
+// clock advances, so multi-step reconcile flows can be exercised end to end.
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Statuses reported by the fake, matching the RDS DBInstanceStatus values.
+const (
+	StatusCreating  = "creating"
+	StatusAvailable = "available"
+	StatusModifying = "modifying"
+	StatusDeleting  = "deleting"
+	StatusRenaming  = "renaming"
+	StatusStopping  = "stopping"
+	StatusStopped   = "stopped"
+	StatusStarting  = "starting"
+)
+
+// AutoStart is how long RDS keeps an instance stopped before starting it.
+const AutoStart = 7 * 24 * time.Hour
+
+// RDS is an in-memory implementation of rdsiface.RDSAPI. Calls not
+// implemented by the fake panic through the embedded nil interface.
+type RDS struct {
+	rdsiface.RDSAPI
+
+	// Clock drives status transitions, use Advance to move it forward.
+	Clock *clock.FakeClock
+
+	// Durations of the simulated transitions.
+	CreateDuration   time.Duration
+	ModifyDuration   time.Duration
+	DeleteDuration   time.Duration
+	SnapshotDuration time.Duration
+
+	// InstanceQuota limits the number of instances, 0 means unlimited.
+	InstanceQuota int
+
+	Region    string
+	AccountID string
+
+	mu              sync.Mutex
+	instances       map[string]*instance
+	snapshots       map[string]*snapshot
+	parameterGroups map[string]*rds.DBParameterGroup
+	subnetGroups    map[string]*rds.DBSubnetGroup
+	engineVersions  map[engineKey]*rds.DBEngineVersion
+	tags            map[string]map[string]string
+	faults          map[string][]*fault
+	calls           map[string]int
+
+	// peers are the fakes of other regions, see Connect.
+	peers map[string]*RDS
+}
+
+type instance struct {
+	db      *rds.DBInstance
+	readyAt time.Time
+	pending *rds.PendingModifiedValues
+
+	password      string
+	finalSnapshot string
+	failUpgrade   bool
+	rename        string
+
+	maintenance []*rds.PendingMaintenanceAction
+}
+
+type snapshot struct {
+	snap    *rds.DBSnapshot
+	readyAt time.Time
+}
+
+type fault struct {
+	err   error
+	times int
+}
+
+// New returns an empty fake with a clock starting at the current time.
+func New() *RDS {
+	f := &RDS{
+		Clock:            clock.NewFakeClock(time.Now()),
+		CreateDuration:   5 * time.Minute,
+		ModifyDuration:   2 * time.Minute,
+		DeleteDuration:   3 * time.Minute,
+		SnapshotDuration: time.Minute,
+		Region:           "us-west-2",
+		AccountID:        "123456789012",
+		instances:        map[string]*instance{},
+		snapshots:        map[string]*snapshot{},
+		parameterGroups:  map[string]*rds.DBParameterGroup{},
+		subnetGroups:     map[string]*rds.DBSubnetGroup{},
+		engineVersions:   map[engineKey]*rds.DBEngineVersion{},
+		tags:             map[string]map[string]string{},
+		faults:           map[string][]*fault{},
+		calls:            map[string]int{},
+	}
+	for i := len(defaultEngineVersions) - 1; i >= 0; i-- {
+		v := defaultEngineVersions[i]
+		f.addEngineVersion(v.engine, v.version, v.family, v.targets...)
+	}
+	return f
+}
+
+// Connect links the fakes of other regions both ways, the peers share the
+// clock of f and advance with it.
+func (f *RDS) Connect(peers ...*RDS) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range peers {
+		p.Clock = f.Clock
+		if f.peers == nil {
+			f.peers = map[string]*RDS{}
+		}
+		if p.peers == nil {
+			p.peers = map[string]*RDS{}
+		}
+		f.peers[p.Region] = p
+		p.peers[f.Region] = f
+	}
+}
+
+// Advance moves the clock forward, completing any transitions that are due
+// here and in the connected regions.
+func (f *RDS) Advance(d time.Duration) {
+	f.Clock.Step(d)
+
+	for _, r := range append([]*RDS{f}, f.connected()...) {
+		r.mu.Lock()
+		r.tick()
+		r.mu.Unlock()
+	}
+}
+
+func (f *RDS) connected() (out []*RDS) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.peers {
+		out = append(out, p)
+	}
+	return out
+}
+
+// Fail makes the next n calls to op fail with err. A negative n fails every
+// call until Reset is called. Op is the API method name, e.g.
+// "CreateDBInstance".
+func (f *RDS) Fail(op string, err error, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[op] = append(f.faults[op], &fault{err: err, times: n})
+}
+
+// Reset clears all injected faults.
+func (f *RDS) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = map[string][]*fault{}
+}
+
+// Calls returns the number of calls made to op, including failed ones.
+func (f *RDS) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// Instance returns a copy of the instance or nil if it does not exist.
+func (f *RDS) Instance(id string) *rds.DBInstance {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tick()
+	if i, ok := f.instances[id]; ok {
+		return copyInstance(i.db)
+	}
+	return nil
+}
+
+// MasterUserPassword returns the password the instance was created with.
+func (f *RDS) MasterUserPassword(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i, ok := f.instances[id]; ok {
+		return i.password
+	}
+	return ""
+}
+
+// Snapshot returns a copy of the snapshot or nil if it does not exist.
+func (f *RDS) Snapshot(id string) *rds.DBSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tick()
+	if s, ok := f.snapshots[id]; ok {
+		return awsutil.CopyOf(s.snap).(*rds.DBSnapshot)
+	}
+	return nil
+}
+
+// Throttling returns the error RDS responds with when rate limited.
+func Throttling() error {
+	return awserr.New("Throttling", "Rate exceeded", nil)
+}
+
+// QuotaExceeded returns the error RDS responds with when the instance quota
+// is reached.
+func QuotaExceeded() error {
+	return awserr.New(rds.ErrCodeInstanceQuotaExceededFault,
+		"The request would result in the user exceeding the allowed number of DB instances.", nil)
+}
+
+// call records the call and returns an injected fault if there is one. It
+// also completes due transitions, callers must hold the lock.
+func (f *RDS) call(op string) error {
+	f.calls[op]++
+	f.tick()
+
+	faults := f.faults[op]
+	if len(faults) == 0 {
+		return nil
+	}
+	next := faults[0]
+	if next.times > 0 {
+		next.times--
+		if next.times == 0 {
+			f.faults[op] = faults[1:]
+		}
+	}
+	return next.err
+}
+
+// tick completes transitions that are due at the current clock time.
+func (f *RDS) tick() {
+	now := f.Clock.Now()
+
+	for id, s := range f.snapshots {
+		if *s.snap.Status == StatusCreating && !now.Before(s.readyAt) {
+			s.snap.Status = str(StatusAvailable)
+			f.snapshots[id] = s
+		}
+	}
+
+	for id, i := range f.instances {
+		if now.Before(i.readyAt) {
+			continue
+		}
+		switch *i.db.DBInstanceStatus {
+		case StatusCreating:
+			i.db.DBInstanceStatus = str(StatusAvailable)
+			i.db.InstanceCreateTime = &now
+			i.db.Endpoint = &rds.Endpoint{
+				Address: str(fmt.Sprintf("%s.abcdefghijkl.%s.rds.amazonaws.com", id, f.Region)),
+				Port:    i64(defaultPort(*i.db.Engine)),
+			}
+		case StatusUpgrading:
+			if i.failUpgrade {
+				i.failUpgrade = false
+				i.pending.EngineVersion = nil
+			}
+			fallthrough
+		case StatusModifying:
+			f.applyPending(i.db, i.pending)
+			i.pending = nil
+			i.db.PendingModifiedValues = nil
+			i.db.DBInstanceStatus = str(StatusAvailable)
+		case StatusStopping:
+			i.db.DBInstanceStatus = str(StatusStopped)
+			i.readyAt = now.Add(AutoStart)
+		case StatusStopped:
+			i.db.DBInstanceStatus = str(StatusStarting)
+			i.readyAt = now.Add(f.ModifyDuration)
+		case StatusStarting, StatusRebooting:
+			i.db.DBInstanceStatus = str(StatusAvailable)
+		case StatusRenaming:
+			f.applyPending(i.db, i.pending)
+			i.pending = nil
+			i.db.PendingModifiedValues = nil
+			f.renameInstance(id, i)
+		case StatusDeleting:
+			if i.finalSnapshot != "" {
+				f.snapshots[i.finalSnapshot] = f.newSnapshot(i.finalSnapshot, i.db, "manual")
+			}
+			delete(f.instances, id)
+			delete(f.tags, *i.db.DBInstanceArn)
+		}
+	}
+}
+
+// renameInstance moves the instance, its tags and its endpoint to the new
+// identifier.
+func (f *RDS) renameInstance(id string, i *instance) {
+	oldArn := *i.db.DBInstanceArn
+	i.db.DBInstanceIdentifier = str(i.rename)
+	i.db.DBInstanceArn = str(f.arn("db", i.rename))
+	i.db.DBInstanceStatus = str(StatusAvailable)
+	if i.db.Endpoint != nil {
+		i.db.Endpoint.Address = str(strings.Replace(*i.db.Endpoint.Address, id+".", i.rename+".", 1))
+	}
+	f.tags[*i.db.DBInstanceArn] = f.tags[oldArn]
+	delete(f.tags, oldArn)
+	delete(f.instances, id)
+	f.instances[i.rename] = i
+	i.rename = ""
+}
+
+func (f *RDS) arn(kind, id string) string {
+	return fmt.Sprintf("arn:aws:rds:%s:%s:%s:%s", f.Region, f.AccountID, kind, id)
+}
+
+func notFound(code, kind, id string) error {
+	return awserr.New(code, fmt.Sprintf("%s %s not found.", kind, id), nil)
+}
+
+func invalidState(code, kind, id, status string) error {
+	return awserr.New(code, fmt.Sprintf("%s %s is not in available state (%s).", kind, id, status), nil)
+}
+
+func copyInstance(db *rds.DBInstance) *rds.DBInstance {
+	return awsutil.CopyOf(db).(*rds.DBInstance)
+}
+
+func defaultPort(engine string) int64 {
+	switch engine {
+	case "mysql", "mariadb", "aurora", "aurora-mysql":
+		return 3306
+	case "sqlserver-ee", "sqlserver-se", "sqlserver-ex", "sqlserver-web":
+		return 1433
+	case "oracle-ee", "oracle-se2", "oracle-se1", "oracle-se":
+		return 1521
+	}
+	return 5432
+}
+
+func str(s string) *string { return &s }
+
+func i64(i int64) *int64 { return &i }
+
+func bo(b bool) *bool { return &b }
@@ -0,0 +1,337 @@
+package fake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/require"
+)
+
+func create(t *testing.T, f *RDS, id string) {
+	_, err := f.CreateDBInstance(&rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String(id),
+		DBInstanceClass:      aws.String("db.t2.micro"),
+		Engine:               aws.String("postgres"),
+		AllocatedStorage:     aws.Int64(20),
+	})
+	require.NoError(t, err)
+}
+
+func code(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func TestRDS_Lifecycle(t *testing.T) {
+	f := New()
+	create(t, f, "db")
+	require.Equal(t, StatusCreating, *f.Instance("db").DBInstanceStatus)
+	require.Nil(t, f.Instance("db").Endpoint)
+
+	_, err := f.ModifyDBInstance(&rds.ModifyDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.Equal(t, rds.ErrCodeInvalidDBInstanceStateFault, code(err))
+
+	f.Advance(f.CreateDuration)
+	require.Equal(t, StatusAvailable, *f.Instance("db").DBInstanceStatus)
+	require.Equal(t, int64(5432), *f.Instance("db").Endpoint.Port)
+
+	_, err = f.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		AllocatedStorage:     aws.Int64(50),
+		ApplyImmediately:     aws.Bool(true),
+	})
+	require.NoError(t, err)
+	db := f.Instance("db")
+	require.Equal(t, StatusModifying, *db.DBInstanceStatus)
+	require.Equal(t, int64(50), *db.PendingModifiedValues.AllocatedStorage)
+	require.Equal(t, int64(20), *db.AllocatedStorage)
+
+	f.Advance(f.ModifyDuration)
+	db = f.Instance("db")
+	require.Equal(t, StatusAvailable, *db.DBInstanceStatus)
+	require.Equal(t, int64(50), *db.AllocatedStorage)
+	require.Nil(t, db.PendingModifiedValues)
+
+	_, err = f.DeleteDBInstance(&rds.DeleteDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.Equal(t, "InvalidParameterCombination", code(err))
+
+	_, err = f.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		SkipFinalSnapshot:    aws.Bool(true),
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusDeleting, *f.Instance("db").DBInstanceStatus)
+
+	f.Advance(f.DeleteDuration)
+	_, err = f.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String("db")})
+	require.Equal(t, rds.ErrCodeDBInstanceNotFoundFault, code(err))
+}
+
+func TestRDS_Snapshots(t *testing.T) {
+	f := New()
+	create(t, f, "db")
+
+	_, err := f.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBSnapshotIdentifier: aws.String("snap"),
+	})
+	require.Equal(t, rds.ErrCodeInvalidDBInstanceStateFault, code(err))
+
+	f.Advance(f.CreateDuration)
+	_, err = f.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBSnapshotIdentifier: aws.String("snap"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusCreating, *f.Snapshot("snap").Status)
+
+	f.Advance(time.Minute)
+	require.Equal(t, StatusAvailable, *f.Snapshot("snap").Status)
+
+	_, err = f.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      aws.String("db"),
+		FinalDBSnapshotIdentifier: aws.String("final"),
+	})
+	require.NoError(t, err)
+	f.Advance(f.DeleteDuration)
+
+	out, err := f.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{DBInstanceIdentifier: aws.String("db")})
+	require.NoError(t, err)
+	require.Len(t, out.DBSnapshots, 2)
+}
+
+func TestRDS_CopyDBSnapshotCrossRegion(t *testing.T) {
+	west, east := New(), New()
+	east.Region = "us-east-1"
+	west.Connect(east)
+
+	create(t, west, "db")
+	west.Advance(west.CreateDuration)
+	west.AddSnapshot("snap", west.Instance("db"), "manual")
+	arn := west.Snapshot("snap").DBSnapshotArn
+
+	_, err := east.CopyDBSnapshot(&rds.CopyDBSnapshotInput{
+		SourceDBSnapshotIdentifier: arn,
+		TargetDBSnapshotIdentifier: aws.String("copy"),
+	})
+	require.Equal(t, "InvalidParameterValue", code(err))
+
+	_, err = east.CopyDBSnapshot(&rds.CopyDBSnapshotInput{
+		SourceDBSnapshotIdentifier: arn,
+		TargetDBSnapshotIdentifier: aws.String("copy"),
+		SourceRegion:               aws.String("us-west-2"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusCreating, *east.Snapshot("copy").Status)
+
+	west.Advance(west.SnapshotDuration)
+	require.Equal(t, StatusAvailable, *east.Snapshot("copy").Status)
+	require.Equal(t, "db", *east.Snapshot("copy").DBInstanceIdentifier)
+}
+
+func TestRDS_ReadReplicas(t *testing.T) {
+	f := New()
+	create(t, f, "db")
+	f.Advance(f.CreateDuration)
+
+	_, err := f.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		StorageType:          aws.String("standard"),
+	})
+	require.Equal(t, "InvalidParameterCombination", code(err))
+
+	_, err = f.CreateDBInstanceReadReplica(&rds.CreateDBInstanceReadReplicaInput{
+		DBInstanceIdentifier:       aws.String("replica"),
+		SourceDBInstanceIdentifier: aws.String("db"),
+		StorageType:                aws.String("standard"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*string{aws.String("replica")}, f.Instance("db").ReadReplicaDBInstanceIdentifiers)
+
+	_, err = f.PromoteReadReplica(&rds.PromoteReadReplicaInput{DBInstanceIdentifier: aws.String("replica")})
+	require.Equal(t, rds.ErrCodeInvalidDBInstanceStateFault, code(err))
+
+	f.Advance(f.CreateDuration)
+	replica := f.Instance("replica")
+	require.Equal(t, "db", *replica.ReadReplicaSourceDBInstanceIdentifier)
+	require.Equal(t, "standard", *replica.StorageType)
+
+	_, err = f.PromoteReadReplica(&rds.PromoteReadReplicaInput{DBInstanceIdentifier: aws.String("replica")})
+	require.NoError(t, err)
+	require.Equal(t, StatusModifying, *f.Instance("replica").DBInstanceStatus)
+	require.Empty(t, f.Instance("db").ReadReplicaDBInstanceIdentifiers)
+
+	f.Advance(f.ModifyDuration)
+	replica = f.Instance("replica")
+	require.Equal(t, StatusAvailable, *replica.DBInstanceStatus)
+	require.Nil(t, replica.ReadReplicaSourceDBInstanceIdentifier)
+}
+
+func TestRDS_SubnetGroups(t *testing.T) {
+	f := New()
+	f.AddSubnetGroup("a", "vpc-1")
+	f.AddSubnetGroup("b", "vpc-2")
+	_, err := f.CreateDBInstance(&rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBInstanceClass:      aws.String("db.t2.micro"),
+		Engine:               aws.String("postgres"),
+		DBSubnetGroupName:    aws.String("a"),
+	})
+	require.NoError(t, err)
+	f.Advance(f.CreateDuration)
+	require.Equal(t, "vpc-1", *f.Instance("db").DBSubnetGroup.VpcId)
+
+	_, err = f.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBSubnetGroupName:    aws.String("b"),
+	})
+	require.Equal(t, rds.ErrCodeInvalidVPCNetworkStateFault, code(err))
+
+	_, err = f.DescribeDBSubnetGroups(&rds.DescribeDBSubnetGroupsInput{DBSubnetGroupName: aws.String("c")})
+	require.Equal(t, rds.ErrCodeDBSubnetGroupNotFoundFault, code(err))
+}
+
+func TestRDS_StopStart(t *testing.T) {
+	f := New()
+	create(t, f, "db")
+	_, err := f.StopDBInstance(&rds.StopDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.Equal(t, rds.ErrCodeInvalidDBInstanceStateFault, code(err))
+
+	f.Advance(f.CreateDuration)
+	_, err = f.StopDBInstance(&rds.StopDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.NoError(t, err)
+	f.Advance(f.ModifyDuration)
+	require.Equal(t, StatusStopped, *f.Instance("db").DBInstanceStatus)
+
+	_, err = f.StartDBInstance(&rds.StartDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.NoError(t, err)
+	require.Equal(t, StatusStarting, *f.Instance("db").DBInstanceStatus)
+	f.Advance(f.ModifyDuration)
+	require.Equal(t, StatusAvailable, *f.Instance("db").DBInstanceStatus)
+
+	// RDS starts instances that were stopped for a week.
+	_, err = f.StopDBInstance(&rds.StopDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.NoError(t, err)
+	f.Advance(f.ModifyDuration)
+	f.Advance(AutoStart)
+	f.Advance(f.ModifyDuration)
+	require.Equal(t, StatusAvailable, *f.Instance("db").DBInstanceStatus)
+}
+
+func TestRDS_RebootAndMaintenance(t *testing.T) {
+	f := New()
+	create(t, f, "db")
+	f.Advance(f.CreateDuration)
+
+	_, err := f.RebootDBInstance(&rds.RebootDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		ForceFailover:        aws.Bool(true),
+	})
+	require.Equal(t, "InvalidParameterCombination", code(err))
+	_, err = f.RebootDBInstance(&rds.RebootDBInstanceInput{DBInstanceIdentifier: aws.String("db")})
+	require.NoError(t, err)
+	require.Equal(t, StatusRebooting, *f.Instance("db").DBInstanceStatus)
+	f.Advance(f.ModifyDuration)
+	require.Equal(t, StatusAvailable, *f.Instance("db").DBInstanceStatus)
+
+	arn := f.Instance("db").DBInstanceArn
+	f.AddPendingMaintenance("db", "system-update", "OS upgrade")
+	out, err := f.DescribePendingMaintenanceActions(&rds.DescribePendingMaintenanceActionsInput{ResourceIdentifier: arn})
+	require.NoError(t, err)
+	require.Len(t, out.PendingMaintenanceActions, 1)
+	require.Equal(t, "system-update", *out.PendingMaintenanceActions[0].PendingMaintenanceActionDetails[0].Action)
+
+	_, err = f.ApplyPendingMaintenanceAction(&rds.ApplyPendingMaintenanceActionInput{
+		ResourceIdentifier: arn,
+		ApplyAction:        aws.String("system-update"),
+		OptInType:          aws.String("immediate"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusModifying, *f.Instance("db").DBInstanceStatus)
+	out, err = f.DescribePendingMaintenanceActions(&rds.DescribePendingMaintenanceActionsInput{ResourceIdentifier: arn})
+	require.NoError(t, err)
+	require.Empty(t, out.PendingMaintenanceActions)
+}
+
+func TestRDS_ParameterGroups(t *testing.T) {
+	f := New()
+	_, err := f.CreateDBParameterGroup(&rds.CreateDBParameterGroupInput{
+		DBParameterGroupName:   aws.String("pg"),
+		DBParameterGroupFamily: aws.String("postgres10"),
+		Description:            aws.String("test"),
+	})
+	require.NoError(t, err)
+
+	_, err = f.CreateDBInstance(&rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBInstanceClass:      aws.String("db.t2.micro"),
+		Engine:               aws.String("postgres"),
+		DBParameterGroupName: aws.String("pg"),
+	})
+	require.NoError(t, err)
+
+	_, err = f.DeleteDBParameterGroup(&rds.DeleteDBParameterGroupInput{DBParameterGroupName: aws.String("pg")})
+	require.Equal(t, rds.ErrCodeInvalidDBParameterGroupStateFault, code(err))
+}
+
+func TestRDS_EngineUpgrade(t *testing.T) {
+	f := New()
+	_, err := f.CreateDBInstance(&rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		DBInstanceClass:      aws.String("db.t2.micro"),
+		Engine:               aws.String("postgres"),
+		EngineVersion:        aws.String("10.4"),
+	})
+	require.NoError(t, err)
+	f.Advance(f.CreateDuration)
+
+	out, err := f.DescribeDBEngineVersions(&rds.DescribeDBEngineVersionsInput{
+		Engine:        aws.String("postgres"),
+		EngineVersion: aws.String("10.4"),
+	})
+	require.NoError(t, err)
+	require.Len(t, out.DBEngineVersions[0].ValidUpgradeTarget, 2)
+	require.True(t, *out.DBEngineVersions[0].ValidUpgradeTarget[1].IsMajorVersionUpgrade)
+
+	upgrade := &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("db"),
+		EngineVersion:        aws.String("11.1"),
+		ApplyImmediately:     aws.Bool(true),
+	}
+	_, err = f.ModifyDBInstance(upgrade)
+	require.Equal(t, "InvalidParameterCombination", code(err))
+
+	upgrade.AllowMajorVersionUpgrade = aws.Bool(true)
+	_, err = f.ModifyDBInstance(upgrade)
+	require.NoError(t, err)
+	require.Equal(t, StatusUpgrading, *f.Instance("db").DBInstanceStatus)
+
+	f.Advance(f.ModifyDuration)
+	require.Equal(t, "11.1", *f.Instance("db").EngineVersion)
+}
+
+func TestRDS_Faults(t *testing.T) {
+	f := New()
+	f.Fail("CreateDBInstance", Throttling(), 2)
+
+	for i := 0; i < 2; i++ {
+		_, err := f.CreateDBInstance(&rds.CreateDBInstanceInput{})
+		require.Equal(t, "Throttling", code(err))
+	}
+	create(t, f, "db")
+	require.Equal(t, 3, f.Calls("CreateDBInstance"))
+
+	f.Fail("DescribeDBInstances", QuotaExceeded(), -1)
+	for i := 0; i < 3; i++ {
+		_, err := f.DescribeDBInstances(&rds.DescribeDBInstancesInput{})
+		require.Equal(t, rds.ErrCodeInstanceQuotaExceededFault, code(err))
+	}
+	f.Reset()
+	_, err := f.DescribeDBInstances(&rds.DescribeDBInstancesInput{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,462 @@
+package fake
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// CreateDBInstance starts creating an instance, it becomes available after
+// CreateDuration.
+func (f *RDS) CreateDBInstance(in *rds.CreateDBInstanceInput) (*rds.CreateDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateDBInstance"); err != nil {
+		return &rds.CreateDBInstanceOutput{}, err
+	}
+
+	if in.DBInstanceIdentifier == nil || in.Engine == nil || in.DBInstanceClass == nil {
+		return &rds.CreateDBInstanceOutput{}, awserr.New("InvalidParameterValue",
+			"DBInstanceIdentifier, Engine and DBInstanceClass are required.", nil)
+	}
+	id := *in.DBInstanceIdentifier
+	if err := checkIdentifier(id); err != nil {
+		return &rds.CreateDBInstanceOutput{}, err
+	}
+	if _, ok := f.instances[id]; ok {
+		return &rds.CreateDBInstanceOutput{}, awserr.New(rds.ErrCodeDBInstanceAlreadyExistsFault,
+			"DB instance already exists", nil)
+	}
+	if f.InstanceQuota > 0 && len(f.instances) >= f.InstanceQuota {
+		return &rds.CreateDBInstanceOutput{}, QuotaExceeded()
+	}
+	if err := checkMonitoring(in.MonitoringInterval, in.MonitoringRoleArn); err != nil {
+		return &rds.CreateDBInstanceOutput{}, err
+	}
+	if in.DBParameterGroupName != nil {
+		if !f.hasParameterGroup(*in.DBParameterGroupName) {
+			return &rds.CreateDBInstanceOutput{}, notFound(rds.ErrCodeDBParameterGroupNotFoundFault,
+				"DBParameterGroup", *in.DBParameterGroupName)
+		}
+	}
+
+	db := &rds.DBInstance{
+		DBInstanceIdentifier:         in.DBInstanceIdentifier,
+		DBInstanceArn:                str(f.arn("db", id)),
+		DBInstanceStatus:             str(StatusCreating),
+		DBInstanceClass:              in.DBInstanceClass,
+		DBName:                       in.DBName,
+		Engine:                       in.Engine,
+		EngineVersion:                in.EngineVersion,
+		MasterUsername:               in.MasterUsername,
+		AllocatedStorage:             in.AllocatedStorage,
+		AutoMinorVersionUpgrade:      in.AutoMinorVersionUpgrade,
+		AvailabilityZone:             in.AvailabilityZone,
+		BackupRetentionPeriod:        in.BackupRetentionPeriod,
+		CharacterSetName:             in.CharacterSetName,
+		Iops:                         in.Iops,
+		MultiAZ:                      in.MultiAZ,
+		StorageEncrypted:             in.StorageEncrypted,
+		KmsKeyId:                     in.KmsKeyId,
+		StorageType:                  in.StorageType,
+		PreferredBackupWindow:        in.PreferredBackupWindow,
+		PreferredMaintenanceWindow:   in.PreferredMaintenanceWindow,
+		MonitoringInterval:           in.MonitoringInterval,
+		MonitoringRoleArn:            in.MonitoringRoleArn,
+		PerformanceInsightsEnabled:   in.EnablePerformanceInsights,
+		EnabledCloudwatchLogsExports: in.EnableCloudwatchLogsExports,
+		DeletionProtection:           bo(aws.BoolValue(in.DeletionProtection)),
+		MaxAllocatedStorage:          in.MaxAllocatedStorage,
+	}
+	if db.MonitoringInterval == nil {
+		db.MonitoringInterval = i64(0)
+	}
+	if aws.BoolValue(in.EnablePerformanceInsights) {
+		setPerformanceInsights(db, in.PerformanceInsightsRetentionPeriod, in.PerformanceInsightsKMSKeyId, f.arn)
+	}
+	db.DBSubnetGroup = f.subnetGroup(in.DBSubnetGroupName)
+	if in.DBParameterGroupName != nil {
+		db.DBParameterGroups = []*rds.DBParameterGroupStatus{{
+			DBParameterGroupName: in.DBParameterGroupName,
+			ParameterApplyStatus: str("in-sync"),
+		}}
+	}
+	for _, sg := range in.VpcSecurityGroupIds {
+		db.VpcSecurityGroups = append(db.VpcSecurityGroups, &rds.VpcSecurityGroupMembership{
+			VpcSecurityGroupId: sg,
+			Status:             str("active"),
+		})
+	}
+
+	f.instances[id] = &instance{
+		db:       db,
+		readyAt:  f.Clock.Now().Add(f.CreateDuration),
+		password: aws.StringValue(in.MasterUserPassword),
+	}
+	f.setTags(*db.DBInstanceArn, in.Tags)
+	return &rds.CreateDBInstanceOutput{DBInstance: copyInstance(db)}, nil
+}
+
+// DescribeDBInstances returns all instances, or the one matching
+// DBInstanceIdentifier.
+func (f *RDS) DescribeDBInstances(in *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeDBInstances"); err != nil {
+		return &rds.DescribeDBInstancesOutput{}, err
+	}
+
+	if in.DBInstanceIdentifier != nil {
+		i, ok := f.instances[*in.DBInstanceIdentifier]
+		if !ok {
+			return &rds.DescribeDBInstancesOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault,
+				"DBInstance", *in.DBInstanceIdentifier)
+		}
+		return &rds.DescribeDBInstancesOutput{
+			DBInstances: []*rds.DBInstance{copyInstance(i.db)},
+		}, nil
+	}
+
+	ids := make([]string, 0, len(f.instances))
+	for id := range f.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := &rds.DescribeDBInstancesOutput{}
+	for _, id := range ids {
+		out.DBInstances = append(out.DBInstances, copyInstance(f.instances[id].db))
+	}
+	return out, nil
+}
+
+// DescribeDBInstancesPages returns all matching instances as a single page.
+func (f *RDS) DescribeDBInstancesPages(in *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool) error {
+	out, err := f.DescribeDBInstances(in)
+	if err != nil {
+		return err
+	}
+	fn(out, true)
+	return nil
+}
+
+// ModifyDBInstance records the modifications as pending. With
+// ApplyImmediately the instance moves to modifying and applies them after
+// ModifyDuration.
+func (f *RDS) ModifyDBInstance(in *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ModifyDBInstance"); err != nil {
+		return &rds.ModifyDBInstanceOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.ModifyDBInstanceOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus != StatusAvailable {
+		return &rds.ModifyDBInstanceOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", id, *i.db.DBInstanceStatus)
+	}
+	if err := f.checkUpgrade(i.db, in); err != nil {
+		return &rds.ModifyDBInstanceOutput{}, err
+	}
+	if in.NewDBInstanceIdentifier != nil {
+		if _, ok := f.instances[*in.NewDBInstanceIdentifier]; ok {
+			return &rds.ModifyDBInstanceOutput{}, awserr.New(rds.ErrCodeDBInstanceAlreadyExistsFault,
+				"DB instance already exists", nil)
+		}
+	}
+	if in.MonitoringInterval != nil {
+		if err := checkMonitoring(in.MonitoringInterval, in.MonitoringRoleArn); err != nil {
+			return &rds.ModifyDBInstanceOutput{}, err
+		}
+	}
+	if err := f.checkReplacement(i.db, in); err != nil {
+		return &rds.ModifyDBInstanceOutput{}, err
+	}
+
+	// Settings that RDS applies without a pending modification.
+	if in.DeletionProtection != nil {
+		i.db.DeletionProtection = in.DeletionProtection
+	}
+	if in.MaxAllocatedStorage != nil {
+		i.db.MaxAllocatedStorage = in.MaxAllocatedStorage
+	}
+	if in.AutoMinorVersionUpgrade != nil {
+		i.db.AutoMinorVersionUpgrade = in.AutoMinorVersionUpgrade
+	}
+	if in.PreferredBackupWindow != nil {
+		i.db.PreferredBackupWindow = in.PreferredBackupWindow
+	}
+	if in.PreferredMaintenanceWindow != nil {
+		i.db.PreferredMaintenanceWindow = in.PreferredMaintenanceWindow
+	}
+	if in.MonitoringInterval != nil {
+		i.db.MonitoringInterval = in.MonitoringInterval
+		i.db.MonitoringRoleArn = in.MonitoringRoleArn
+	}
+	if in.EnablePerformanceInsights != nil {
+		if *in.EnablePerformanceInsights {
+			setPerformanceInsights(i.db, in.PerformanceInsightsRetentionPeriod, in.PerformanceInsightsKMSKeyId, f.arn)
+		} else {
+			i.db.PerformanceInsightsEnabled = aws.Bool(false)
+			i.db.PerformanceInsightsRetentionPeriod = nil
+			i.db.PerformanceInsightsKMSKeyId = nil
+		}
+	}
+	if in.VpcSecurityGroupIds != nil {
+		i.db.VpcSecurityGroups = nil
+		for _, sg := range in.VpcSecurityGroupIds {
+			i.db.VpcSecurityGroups = append(i.db.VpcSecurityGroups, &rds.VpcSecurityGroupMembership{
+				VpcSecurityGroupId: sg,
+				Status:             str("active"),
+			})
+		}
+	}
+	if in.DBParameterGroupName != nil {
+		if !f.hasParameterGroup(*in.DBParameterGroupName) {
+			return &rds.ModifyDBInstanceOutput{}, notFound(rds.ErrCodeDBParameterGroupNotFoundFault,
+				"DBParameterGroup", *in.DBParameterGroupName)
+		}
+		i.db.DBParameterGroups = []*rds.DBParameterGroupStatus{{
+			DBParameterGroupName: in.DBParameterGroupName,
+			ParameterApplyStatus: str("pending-reboot"),
+		}}
+	}
+
+	pending := i.pending
+	if pending == nil {
+		pending = &rds.PendingModifiedValues{}
+	}
+	if in.AllocatedStorage != nil {
+		pending.AllocatedStorage = in.AllocatedStorage
+	}
+	if in.BackupRetentionPeriod != nil {
+		pending.BackupRetentionPeriod = in.BackupRetentionPeriod
+	}
+	if in.DBInstanceClass != nil {
+		pending.DBInstanceClass = in.DBInstanceClass
+	}
+	if in.EngineVersion != nil {
+		pending.EngineVersion = in.EngineVersion
+	}
+	if in.Iops != nil {
+		pending.Iops = in.Iops
+	}
+	if in.MasterUserPassword != nil {
+		pending.MasterUserPassword = str("****")
+	}
+	if in.MultiAZ != nil {
+		pending.MultiAZ = in.MultiAZ
+	}
+	if in.StorageType != nil {
+		pending.StorageType = in.StorageType
+	}
+	if in.DBSubnetGroupName != nil {
+		pending.DBSubnetGroupName = in.DBSubnetGroupName
+	}
+	if c := in.CloudwatchLogsExportConfiguration; c != nil {
+		pending.PendingCloudwatchLogsExports = &rds.PendingCloudwatchLogsExports{
+			LogTypesToEnable:  c.EnableLogTypes,
+			LogTypesToDisable: c.DisableLogTypes,
+		}
+	}
+	// Settings like deletion protection leave nothing pending.
+	if !reflect.DeepEqual(pending, &rds.PendingModifiedValues{}) {
+		i.pending = pending
+		i.db.PendingModifiedValues = pending
+	}
+
+	if in.ApplyImmediately != nil && *in.ApplyImmediately {
+		i.db.DBInstanceStatus = str(StatusModifying)
+		if v := pending.EngineVersion; v != nil && (i.db.EngineVersion == nil || *v != *i.db.EngineVersion) {
+			i.db.DBInstanceStatus = str(StatusUpgrading)
+		}
+		if in.NewDBInstanceIdentifier != nil {
+			i.rename = *in.NewDBInstanceIdentifier
+			i.db.DBInstanceStatus = str(StatusRenaming)
+		}
+		i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	}
+	return &rds.ModifyDBInstanceOutput{DBInstance: copyInstance(i.db)}, nil
+}
+
+// DeleteDBInstance starts deleting an instance. Like RDS it requires either
+// SkipFinalSnapshot or a FinalDBSnapshotIdentifier, the final snapshot is
+// created once the deletion completes.
+func (f *RDS) DeleteDBInstance(in *rds.DeleteDBInstanceInput) (*rds.DeleteDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteDBInstance"); err != nil {
+		return &rds.DeleteDBInstanceOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.DeleteDBInstanceOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus == StatusDeleting {
+		return &rds.DeleteDBInstanceOutput{}, awserr.New(rds.ErrCodeInvalidDBInstanceStateFault,
+			"Instance "+id+" is already being deleted.", nil)
+	}
+	if aws.BoolValue(i.db.DeletionProtection) {
+		return &rds.DeleteDBInstanceOutput{}, awserr.New("InvalidParameterCombination",
+			"Cannot delete protected DB Instance, please disable deletion protection and try again.", nil)
+	}
+
+	skip := in.SkipFinalSnapshot != nil && *in.SkipFinalSnapshot
+	switch {
+	case skip && in.FinalDBSnapshotIdentifier != nil:
+		return &rds.DeleteDBInstanceOutput{}, awserr.New("InvalidParameterCombination",
+			"FinalDBSnapshotIdentifier can not be specified when deleting an instance with SkipFinalSnapshot=true.", nil)
+	case !skip && in.FinalDBSnapshotIdentifier == nil:
+		return &rds.DeleteDBInstanceOutput{}, awserr.New("InvalidParameterCombination",
+			"FinalDBSnapshotIdentifier is required unless SkipFinalSnapshot is specified.", nil)
+	case !skip:
+		if _, ok := f.snapshots[*in.FinalDBSnapshotIdentifier]; ok {
+			return &rds.DeleteDBInstanceOutput{}, awserr.New(rds.ErrCodeDBSnapshotAlreadyExistsFault,
+				"Cannot create the snapshot because a snapshot with the identifier "+
+					*in.FinalDBSnapshotIdentifier+" already exists.", nil)
+		}
+		i.finalSnapshot = *in.FinalDBSnapshotIdentifier
+	}
+
+	i.db.DBInstanceStatus = str(StatusDeleting)
+	i.readyAt = f.Clock.Now().Add(f.DeleteDuration)
+	return &rds.DeleteDBInstanceOutput{DBInstance: copyInstance(i.db)}, nil
+}
+
+func (f *RDS) applyPending(db *rds.DBInstance, p *rds.PendingModifiedValues) {
+	if p == nil {
+		return
+	}
+	if p.AllocatedStorage != nil {
+		db.AllocatedStorage = p.AllocatedStorage
+	}
+	if p.BackupRetentionPeriod != nil {
+		db.BackupRetentionPeriod = p.BackupRetentionPeriod
+	}
+	if p.DBInstanceClass != nil {
+		db.DBInstanceClass = p.DBInstanceClass
+	}
+	if p.EngineVersion != nil {
+		db.EngineVersion = p.EngineVersion
+	}
+	if p.Iops != nil {
+		db.Iops = p.Iops
+	}
+	if p.MultiAZ != nil {
+		db.MultiAZ = p.MultiAZ
+	}
+	if p.StorageType != nil {
+		db.StorageType = p.StorageType
+	}
+	if p.DBSubnetGroupName != nil {
+		db.DBSubnetGroup = f.subnetGroup(p.DBSubnetGroupName)
+	}
+	if l := p.PendingCloudwatchLogsExports; l != nil {
+		disable := map[string]bool{}
+		for _, t := range l.LogTypesToDisable {
+			disable[*t] = true
+		}
+		var enabled []*string
+		for _, t := range append(db.EnabledCloudwatchLogsExports, l.LogTypesToEnable...) {
+			if !disable[*t] {
+				enabled = append(enabled, t)
+			}
+		}
+		db.EnabledCloudwatchLogsExports = enabled
+	}
+	for _, pg := range db.DBParameterGroups {
+		pg.ParameterApplyStatus = str("in-sync")
+	}
+}
+
+// checkIdentifier rejects instance identifiers longer than RDS allows.
+func checkIdentifier(id string) error {
+	if len(id) > 63 {
+		return awserr.New("InvalidParameterValue",
+			"The parameter DBInstanceIdentifier is not a valid identifier. Identifiers must be 1 to 63 characters.", nil)
+	}
+	return nil
+}
+
+// checkMonitoring rejects an Enhanced Monitoring interval without a role like
+// RDS does.
+func checkMonitoring(interval *int64, role *string) error {
+	if aws.Int64Value(interval) > 0 && aws.StringValue(role) == "" {
+		return awserr.New("InvalidParameterCombination",
+			"A MonitoringRoleARN value is required if you specify a MonitoringInterval value other than 0.", nil)
+	}
+	return nil
+}
+
+// setPerformanceInsights enables Performance Insights, defaulting the
+// retention to 7 days and the key to the account's RDS key. Like RDS the key
+// is only set when enabling.
+func setPerformanceInsights(db *rds.DBInstance, retention *int64, key *string, arn func(kind, id string) string) {
+	if !aws.BoolValue(db.PerformanceInsightsEnabled) {
+		if key == nil {
+			key = str(strings.Replace(arn("key", "aws/rds"), ":rds:", ":kms:", 1))
+		}
+		db.PerformanceInsightsKMSKeyId = key
+	}
+	if retention == nil {
+		retention = i64(7)
+	}
+	db.PerformanceInsightsEnabled = aws.Bool(true)
+	db.PerformanceInsightsRetentionPeriod = retention
+}
+
+// StopDBInstance stops an available instance, it is stopped after
+// ModifyDuration and started again by RDS after AutoStart.
+func (f *RDS) StopDBInstance(in *rds.StopDBInstanceInput) (*rds.StopDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("StopDBInstance"); err != nil {
+		return &rds.StopDBInstanceOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.StopDBInstanceOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus != StatusAvailable {
+		return &rds.StopDBInstanceOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", id, *i.db.DBInstanceStatus)
+	}
+	i.db.DBInstanceStatus = str(StatusStopping)
+	i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	return &rds.StopDBInstanceOutput{DBInstance: copyInstance(i.db)}, nil
+}
+
+// StartDBInstance starts a stopped instance, it is available after
+// ModifyDuration.
+func (f *RDS) StartDBInstance(in *rds.StartDBInstanceInput) (*rds.StartDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("StartDBInstance"); err != nil {
+		return &rds.StartDBInstanceOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.StartDBInstanceOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus != StatusStopped {
+		return &rds.StartDBInstanceOutput{}, awserr.New(rds.ErrCodeInvalidDBInstanceStateFault,
+			"Instance "+id+" is not stopped.", nil)
+	}
+	i.db.DBInstanceStatus = str(StatusStarting)
+	i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	return &rds.StartDBInstanceOutput{DBInstance: copyInstance(i.db)}, nil
+}
@@ -0,0 +1,125 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// StatusRebooting is reported while an instance reboots or fails over.
+const StatusRebooting = "rebooting"
+
+// RebootDBInstance reboots an available instance, it is available again
+// after ModifyDuration. ForceFailover requires a Multi-AZ instance.
+func (f *RDS) RebootDBInstance(in *rds.RebootDBInstanceInput) (*rds.RebootDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RebootDBInstance"); err != nil {
+		return &rds.RebootDBInstanceOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.RebootDBInstanceOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus != StatusAvailable {
+		return &rds.RebootDBInstanceOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", id, *i.db.DBInstanceStatus)
+	}
+	if in.ForceFailover != nil && *in.ForceFailover && (i.db.MultiAZ == nil || !*i.db.MultiAZ) {
+		return &rds.RebootDBInstanceOutput{}, awserr.New("InvalidParameterCombination",
+			"Cannot failover instance "+id+" as it is not Multi-AZ.", nil)
+	}
+	i.db.DBInstanceStatus = str(StatusRebooting)
+	i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	return &rds.RebootDBInstanceOutput{DBInstance: copyInstance(i.db)}, nil
+}
+
+// AddPendingMaintenance schedules a maintenance action like "system-update"
+// on the instance.
+func (f *RDS) AddPendingMaintenance(id, action, description string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i, ok := f.instances[id]; ok {
+		i.maintenance = append(i.maintenance, &rds.PendingMaintenanceAction{
+			Action:      str(action),
+			Description: str(description),
+		})
+	}
+}
+
+// DescribePendingMaintenanceActions lists the pending maintenance actions
+// of the instance given by its ARN, or of all instances.
+func (f *RDS) DescribePendingMaintenanceActions(in *rds.DescribePendingMaintenanceActionsInput) (*rds.DescribePendingMaintenanceActionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribePendingMaintenanceActions"); err != nil {
+		return &rds.DescribePendingMaintenanceActionsOutput{}, err
+	}
+
+	out := &rds.DescribePendingMaintenanceActionsOutput{}
+	for _, i := range f.instances {
+		if len(i.maintenance) == 0 {
+			continue
+		}
+		if in.ResourceIdentifier != nil && *in.ResourceIdentifier != *i.db.DBInstanceArn {
+			continue
+		}
+		out.PendingMaintenanceActions = append(out.PendingMaintenanceActions, f.pendingMaintenance(i))
+	}
+	return out, nil
+}
+
+// ApplyPendingMaintenanceAction opts in to a pending maintenance action. An
+// immediate opt in applies it right away, the instance is modifying for
+// ModifyDuration.
+func (f *RDS) ApplyPendingMaintenanceAction(in *rds.ApplyPendingMaintenanceActionInput) (*rds.ApplyPendingMaintenanceActionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ApplyPendingMaintenanceAction"); err != nil {
+		return &rds.ApplyPendingMaintenanceActionOutput{}, err
+	}
+
+	var i *instance
+	for _, candidate := range f.instances {
+		if *candidate.db.DBInstanceArn == *in.ResourceIdentifier {
+			i = candidate
+		}
+	}
+	if i == nil {
+		return &rds.ApplyPendingMaintenanceActionOutput{}, notFound(rds.ErrCodeResourceNotFoundFault,
+			"Resource", *in.ResourceIdentifier)
+	}
+	idx := -1
+	for n, a := range i.maintenance {
+		if *a.Action == *in.ApplyAction {
+			idx = n
+		}
+	}
+	if idx < 0 {
+		return &rds.ApplyPendingMaintenanceActionOutput{}, awserr.New("InvalidParameterValue",
+			"No pending "+*in.ApplyAction+" action for "+*in.ResourceIdentifier+".", nil)
+	}
+
+	switch *in.OptInType {
+	case "immediate":
+		i.maintenance = append(i.maintenance[:idx], i.maintenance[idx+1:]...)
+		i.db.DBInstanceStatus = str(StatusModifying)
+		i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	case "next-maintenance", "undo-opt-in":
+		i.maintenance[idx].OptInStatus = in.OptInType
+	default:
+		return &rds.ApplyPendingMaintenanceActionOutput{}, awserr.New("InvalidParameterValue",
+			"Invalid opt in type "+*in.OptInType+".", nil)
+	}
+	return &rds.ApplyPendingMaintenanceActionOutput{ResourcePendingMaintenanceActions: f.pendingMaintenance(i)}, nil
+}
+
+func (f *RDS) pendingMaintenance(i *instance) *rds.ResourcePendingMaintenanceActions {
+	out := &rds.ResourcePendingMaintenanceActions{ResourceIdentifier: i.db.DBInstanceArn}
+	for _, a := range i.maintenance {
+		c := *a
+		out.PendingMaintenanceActionDetails = append(out.PendingMaintenanceActionDetails, &c)
+	}
+	return out
+}
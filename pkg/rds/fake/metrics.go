@@ -0,0 +1,35 @@
+package fake
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Metrics is an in-memory storage metrics source.
+type Metrics struct {
+	mu   sync.Mutex
+	free map[string]float64
+}
+
+// NewMetrics returns a metrics source without datapoints.
+func NewMetrics() *Metrics {
+	return &Metrics{free: map[string]float64{}}
+}
+
+// SetFreeStorage sets the free storage of the instance in bytes.
+func (m *Metrics) SetFreeStorage(id string, bytes float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.free[id] = bytes
+}
+
+// FreeStorageBytes returns the free storage set for the instance.
+func (m *Metrics) FreeStorageBytes(id string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	free, ok := m.free[id]
+	if !ok {
+		return 0, fmt.Errorf("no FreeStorageSpace datapoints for %s", id)
+	}
+	return free, nil
+}
@@ -0,0 +1,98 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// CreateDBParameterGroup stores a parameter group.
+func (f *RDS) CreateDBParameterGroup(in *rds.CreateDBParameterGroupInput) (*rds.CreateDBParameterGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateDBParameterGroup"); err != nil {
+		return &rds.CreateDBParameterGroupOutput{}, err
+	}
+
+	name := *in.DBParameterGroupName
+	if _, ok := f.parameterGroups[name]; ok {
+		return &rds.CreateDBParameterGroupOutput{}, awserr.New(rds.ErrCodeDBParameterGroupAlreadyExistsFault,
+			"Parameter group "+name+" already exists", nil)
+	}
+	pg := &rds.DBParameterGroup{
+		DBParameterGroupName:   in.DBParameterGroupName,
+		DBParameterGroupArn:    str(f.arn("pg", name)),
+		DBParameterGroupFamily: in.DBParameterGroupFamily,
+		Description:            in.Description,
+	}
+	f.parameterGroups[name] = pg
+	return &rds.CreateDBParameterGroupOutput{DBParameterGroup: pg}, nil
+}
+
+// DescribeDBParameterGroups returns all parameter groups, or the one matching
+// DBParameterGroupName.
+func (f *RDS) DescribeDBParameterGroups(in *rds.DescribeDBParameterGroupsInput) (*rds.DescribeDBParameterGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeDBParameterGroups"); err != nil {
+		return &rds.DescribeDBParameterGroupsOutput{}, err
+	}
+
+	if in.DBParameterGroupName != nil {
+		pg, ok := f.parameterGroups[*in.DBParameterGroupName]
+		if !ok {
+			return &rds.DescribeDBParameterGroupsOutput{}, notFound(rds.ErrCodeDBParameterGroupNotFoundFault,
+				"DBParameterGroup", *in.DBParameterGroupName)
+		}
+		return &rds.DescribeDBParameterGroupsOutput{DBParameterGroups: []*rds.DBParameterGroup{pg}}, nil
+	}
+
+	names := make([]string, 0, len(f.parameterGroups))
+	for name := range f.parameterGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := &rds.DescribeDBParameterGroupsOutput{}
+	for _, name := range names {
+		out.DBParameterGroups = append(out.DBParameterGroups, f.parameterGroups[name])
+	}
+	return out, nil
+}
+
+// DeleteDBParameterGroup removes a parameter group that is not in use.
+func (f *RDS) DeleteDBParameterGroup(in *rds.DeleteDBParameterGroupInput) (*rds.DeleteDBParameterGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteDBParameterGroup"); err != nil {
+		return &rds.DeleteDBParameterGroupOutput{}, err
+	}
+
+	name := *in.DBParameterGroupName
+	if _, ok := f.parameterGroups[name]; !ok {
+		return &rds.DeleteDBParameterGroupOutput{}, notFound(rds.ErrCodeDBParameterGroupNotFoundFault,
+			"DBParameterGroup", name)
+	}
+	for id, i := range f.instances {
+		for _, pg := range i.db.DBParameterGroups {
+			if *pg.DBParameterGroupName == name {
+				return &rds.DeleteDBParameterGroupOutput{}, awserr.New(rds.ErrCodeInvalidDBParameterGroupStateFault,
+					"Parameter group "+name+" is in use by "+id, nil)
+			}
+		}
+	}
+	delete(f.parameterGroups, name)
+	return &rds.DeleteDBParameterGroupOutput{}, nil
+}
+
+// hasParameterGroup reports whether the group exists, the RDS managed
+// default groups always exist.
+func (f *RDS) hasParameterGroup(name string) bool {
+	if strings.HasPrefix(name, "default.") {
+		return true
+	}
+	_, ok := f.parameterGroups[name]
+	return ok
+}
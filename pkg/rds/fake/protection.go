@@ -0,0 +1,23 @@
+package fake
+
+import "github.com/aws/aws-sdk-go/aws"
+
+// DeletionProtection reports whether deletion protection is enabled on the
+// instance.
+func (f *RDS) DeletionProtection(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, ok := f.instances[id]
+	return ok && aws.BoolValue(i.db.DeletionProtection)
+}
+
+// MaxAllocatedStorage returns the storage autoscaling limit of the instance,
+// 0 if it was never set.
+func (f *RDS) MaxAllocatedStorage(id string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i, ok := f.instances[id]; ok {
+		return aws.Int64Value(i.db.MaxAllocatedStorage)
+	}
+	return 0
+}
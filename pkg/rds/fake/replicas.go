@@ -0,0 +1,107 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// CreateDBInstanceReadReplica starts creating a read replica of an available
+// instance in the same region, it becomes available after CreateDuration.
+func (f *RDS) CreateDBInstanceReadReplica(in *rds.CreateDBInstanceReadReplicaInput) (*rds.CreateDBInstanceReadReplicaOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateDBInstanceReadReplica"); err != nil {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, err
+	}
+
+	sourceID := *in.SourceDBInstanceIdentifier
+	source, ok := f.instances[sourceID]
+	if !ok {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault,
+			"DBInstance", sourceID)
+	}
+	if *source.db.DBInstanceStatus != StatusAvailable {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", sourceID, *source.db.DBInstanceStatus)
+	}
+	id := *in.DBInstanceIdentifier
+	if err := checkIdentifier(id); err != nil {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, err
+	}
+	if _, ok := f.instances[id]; ok {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, awserr.New(rds.ErrCodeDBInstanceAlreadyExistsFault,
+			"DB instance already exists", nil)
+	}
+	if f.InstanceQuota > 0 && len(f.instances) >= f.InstanceQuota {
+		return &rds.CreateDBInstanceReadReplicaOutput{}, QuotaExceeded()
+	}
+
+	db := copyInstance(source.db)
+	db.DBInstanceIdentifier = in.DBInstanceIdentifier
+	db.DBInstanceArn = str(f.arn("db", id))
+	db.DBInstanceStatus = str(StatusCreating)
+	db.Endpoint = nil
+	db.InstanceCreateTime = nil
+	db.PendingModifiedValues = nil
+	db.ReadReplicaDBInstanceIdentifiers = nil
+	db.ReadReplicaSourceDBInstanceIdentifier = str(sourceID)
+	db.BackupRetentionPeriod = i64(0)
+	db.MultiAZ = bo(false)
+	if in.DBInstanceClass != nil {
+		db.DBInstanceClass = in.DBInstanceClass
+	}
+	if in.StorageType != nil {
+		db.StorageType = in.StorageType
+		db.Iops = in.Iops
+	}
+	if in.AvailabilityZone != nil {
+		db.AvailabilityZone = in.AvailabilityZone
+	}
+	source.db.ReadReplicaDBInstanceIdentifiers = append(source.db.ReadReplicaDBInstanceIdentifiers, str(id))
+
+	f.instances[id] = &instance{db: db, readyAt: f.Clock.Now().Add(f.CreateDuration)}
+	f.setTags(*db.DBInstanceArn, in.Tags)
+	return &rds.CreateDBInstanceReadReplicaOutput{DBInstance: copyInstance(db)}, nil
+}
+
+// PromoteReadReplica detaches a read replica from its source, it is modifying
+// for ModifyDuration.
+func (f *RDS) PromoteReadReplica(in *rds.PromoteReadReplicaInput) (*rds.PromoteReadReplicaOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("PromoteReadReplica"); err != nil {
+		return &rds.PromoteReadReplicaOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.PromoteReadReplicaOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if i.db.ReadReplicaSourceDBInstanceIdentifier == nil {
+		return &rds.PromoteReadReplicaOutput{}, awserr.New(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DB instance "+id+" is not a read replica.", nil)
+	}
+	if *i.db.DBInstanceStatus != StatusAvailable {
+		return &rds.PromoteReadReplicaOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", id, *i.db.DBInstanceStatus)
+	}
+
+	if source, ok := f.instances[*i.db.ReadReplicaSourceDBInstanceIdentifier]; ok {
+		var replicas []*string
+		for _, r := range source.db.ReadReplicaDBInstanceIdentifiers {
+			if *r != id {
+				replicas = append(replicas, r)
+			}
+		}
+		source.db.ReadReplicaDBInstanceIdentifiers = replicas
+	}
+	i.db.ReadReplicaSourceDBInstanceIdentifier = nil
+	i.db.BackupRetentionPeriod = in.BackupRetentionPeriod
+	if i.db.BackupRetentionPeriod == nil {
+		i.db.BackupRetentionPeriod = i64(1)
+	}
+	i.db.DBInstanceStatus = str(StatusModifying)
+	i.readyAt = f.Clock.Now().Add(f.ModifyDuration)
+	return &rds.PromoteReadReplicaOutput{DBInstance: copyInstance(i.db)}, nil
+}
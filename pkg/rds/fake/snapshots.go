@@ -0,0 +1,205 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// CreateDBSnapshot starts a manual snapshot, it becomes available after
+// SnapshotDuration.
+func (f *RDS) CreateDBSnapshot(in *rds.CreateDBSnapshotInput) (*rds.CreateDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateDBSnapshot"); err != nil {
+		return &rds.CreateDBSnapshotOutput{}, err
+	}
+
+	id := *in.DBInstanceIdentifier
+	i, ok := f.instances[id]
+	if !ok {
+		return &rds.CreateDBSnapshotOutput{}, notFound(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance", id)
+	}
+	if *i.db.DBInstanceStatus != StatusAvailable {
+		return &rds.CreateDBSnapshotOutput{}, invalidState(rds.ErrCodeInvalidDBInstanceStateFault,
+			"DBInstance", id, *i.db.DBInstanceStatus)
+	}
+	snapID := *in.DBSnapshotIdentifier
+	if _, ok := f.snapshots[snapID]; ok {
+		return &rds.CreateDBSnapshotOutput{}, awserr.New(rds.ErrCodeDBSnapshotAlreadyExistsFault,
+			"Cannot create the snapshot because a snapshot with the identifier "+snapID+" already exists.", nil)
+	}
+
+	s := f.newSnapshot(snapID, i.db, "manual")
+	s.snap.Status = str(StatusCreating)
+	s.readyAt = f.Clock.Now().Add(f.SnapshotDuration)
+	f.snapshots[snapID] = s
+	return &rds.CreateDBSnapshotOutput{DBSnapshot: awsutil.CopyOf(s.snap).(*rds.DBSnapshot)}, nil
+}
+
+// CopyDBSnapshot starts copying a snapshot, it becomes available after
+// SnapshotDuration. A KmsKeyId encrypts the copy. Snapshots of other regions
+// are copied by ARN from the fakes linked with Connect.
+func (f *RDS) CopyDBSnapshot(in *rds.CopyDBSnapshotInput) (*rds.CopyDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CopyDBSnapshot"); err != nil {
+		return &rds.CopyDBSnapshotOutput{}, err
+	}
+
+	source, err := f.copySource(in)
+	if err != nil {
+		return &rds.CopyDBSnapshotOutput{}, err
+	}
+	targetID := *in.TargetDBSnapshotIdentifier
+	if _, ok := f.snapshots[targetID]; ok {
+		return &rds.CopyDBSnapshotOutput{}, awserr.New(rds.ErrCodeDBSnapshotAlreadyExistsFault,
+			"Cannot copy the snapshot because a snapshot with the identifier "+targetID+" already exists.", nil)
+	}
+
+	snap := source
+	now := f.Clock.Now()
+	snap.DBSnapshotIdentifier = str(targetID)
+	snap.DBSnapshotArn = str(f.arn("snapshot", targetID))
+	snap.SnapshotType = str("manual")
+	snap.SnapshotCreateTime = &now
+	snap.SourceDBSnapshotIdentifier = in.SourceDBSnapshotIdentifier
+	snap.SourceRegion = in.SourceRegion
+	snap.Status = str(StatusCreating)
+	if in.KmsKeyId != nil {
+		snap.Encrypted = bo(true)
+		snap.KmsKeyId = in.KmsKeyId
+	}
+
+	f.snapshots[targetID] = &snapshot{snap: snap, readyAt: now.Add(f.SnapshotDuration)}
+	return &rds.CopyDBSnapshotOutput{DBSnapshot: awsutil.CopyOf(snap).(*rds.DBSnapshot)}, nil
+}
+
+// copySource returns a copy of the snapshot to copy, checking the request
+// like RDS: cross-region copies need the presigned URL the SDK builds from
+// SourceRegion and a KMS key of this region for encrypted snapshots.
+func (f *RDS) copySource(in *rds.CopyDBSnapshotInput) (*rds.DBSnapshot, error) {
+	sourceID := *in.SourceDBSnapshotIdentifier
+	owner := f
+	if strings.HasPrefix(sourceID, "arn:") {
+		region := strings.Split(sourceID, ":")[3]
+		if region != f.Region {
+			if owner = f.peers[region]; owner == nil {
+				return nil, notFound(rds.ErrCodeDBSnapshotNotFoundFault, "DBSnapshot", sourceID)
+			}
+			if in.SourceRegion == nil && in.PreSignedUrl == nil {
+				return nil, awserr.New("InvalidParameterValue",
+					"PreSignedUrl is required when copying a snapshot from another region.", nil)
+			}
+		}
+		sourceID = sourceID[strings.Index(sourceID, ":snapshot:")+len(":snapshot:"):]
+	}
+	if owner != f {
+		owner.mu.Lock()
+		defer owner.mu.Unlock()
+	}
+
+	s, ok := owner.snapshots[sourceID]
+	if !ok {
+		return nil, notFound(rds.ErrCodeDBSnapshotNotFoundFault, "DBSnapshot", sourceID)
+	}
+	if *s.snap.Status != StatusAvailable {
+		return nil, invalidState(rds.ErrCodeInvalidDBSnapshotStateFault, "DBSnapshot", sourceID, *s.snap.Status)
+	}
+	if owner != f && s.snap.Encrypted != nil && *s.snap.Encrypted && in.KmsKeyId == nil {
+		return nil, awserr.New(rds.ErrCodeKMSKeyNotAccessibleFault,
+			"KmsKeyId is required when copying an encrypted snapshot to another region.", nil)
+	}
+	return awsutil.CopyOf(s.snap).(*rds.DBSnapshot), nil
+}
+
+// DescribeDBSnapshots filters snapshots by snapshot identifier, instance
+// identifier and snapshot type.
+func (f *RDS) DescribeDBSnapshots(in *rds.DescribeDBSnapshotsInput) (*rds.DescribeDBSnapshotsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeDBSnapshots"); err != nil {
+		return &rds.DescribeDBSnapshotsOutput{}, err
+	}
+
+	if in.DBSnapshotIdentifier != nil {
+		if _, ok := f.snapshots[*in.DBSnapshotIdentifier]; !ok {
+			return &rds.DescribeDBSnapshotsOutput{}, notFound(rds.ErrCodeDBSnapshotNotFoundFault,
+				"DBSnapshot", *in.DBSnapshotIdentifier)
+		}
+	}
+
+	ids := make([]string, 0, len(f.snapshots))
+	for id := range f.snapshots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := &rds.DescribeDBSnapshotsOutput{}
+	for _, id := range ids {
+		s := f.snapshots[id].snap
+		if in.DBSnapshotIdentifier != nil && *in.DBSnapshotIdentifier != id {
+			continue
+		}
+		if in.DBInstanceIdentifier != nil && *in.DBInstanceIdentifier != *s.DBInstanceIdentifier {
+			continue
+		}
+		if in.SnapshotType != nil && *in.SnapshotType != *s.SnapshotType {
+			continue
+		}
+		out.DBSnapshots = append(out.DBSnapshots, awsutil.CopyOf(s).(*rds.DBSnapshot))
+	}
+	return out, nil
+}
+
+// DeleteDBSnapshot removes a snapshot immediately.
+func (f *RDS) DeleteDBSnapshot(in *rds.DeleteDBSnapshotInput) (*rds.DeleteDBSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteDBSnapshot"); err != nil {
+		return &rds.DeleteDBSnapshotOutput{}, err
+	}
+
+	id := *in.DBSnapshotIdentifier
+	s, ok := f.snapshots[id]
+	if !ok {
+		return &rds.DeleteDBSnapshotOutput{}, notFound(rds.ErrCodeDBSnapshotNotFoundFault, "DBSnapshot", id)
+	}
+	delete(f.snapshots, id)
+	return &rds.DeleteDBSnapshotOutput{DBSnapshot: s.snap}, nil
+}
+
+// AddSnapshot stores an available snapshot of an instance, for tests that
+// need automated snapshots to exist.
+func (f *RDS) AddSnapshot(id string, db *rds.DBInstance, snapshotType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshots[id] = f.newSnapshot(id, db, snapshotType)
+}
+
+func (f *RDS) newSnapshot(id string, db *rds.DBInstance, snapshotType string) *snapshot {
+	now := f.Clock.Now()
+	return &snapshot{
+		readyAt: now,
+		snap: &rds.DBSnapshot{
+			DBSnapshotIdentifier: str(id),
+			DBSnapshotArn:        str(f.arn("snapshot", id)),
+			DBInstanceIdentifier: db.DBInstanceIdentifier,
+			SnapshotType:         str(snapshotType),
+			Status:               str(StatusAvailable),
+			SnapshotCreateTime:   &now,
+			AllocatedStorage:     db.AllocatedStorage,
+			Engine:               db.Engine,
+			EngineVersion:        db.EngineVersion,
+			MasterUsername:       db.MasterUsername,
+			Encrypted:            db.StorageEncrypted,
+			KmsKeyId:             db.KmsKeyId,
+			StorageType:          db.StorageType,
+			Iops:                 db.Iops,
+			InstanceCreateTime:   db.InstanceCreateTime,
+		},
+	}
+}
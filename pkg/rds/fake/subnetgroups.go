@@ -0,0 +1,73 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// AddSubnetGroup stores a subnet group of a VPC. Instances may also use
+// subnet groups that were not added, those report no VPC.
+func (f *RDS) AddSubnetGroup(name, vpcID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subnetGroups[name] = &rds.DBSubnetGroup{
+		DBSubnetGroupName: str(name),
+		DBSubnetGroupArn:  str(f.arn("subgrp", name)),
+		SubnetGroupStatus: str("Complete"),
+		VpcId:             str(vpcID),
+	}
+}
+
+// DescribeDBSubnetGroups returns the subnet group matching
+// DBSubnetGroupName, or all added subnet groups.
+func (f *RDS) DescribeDBSubnetGroups(in *rds.DescribeDBSubnetGroupsInput) (*rds.DescribeDBSubnetGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeDBSubnetGroups"); err != nil {
+		return &rds.DescribeDBSubnetGroupsOutput{}, err
+	}
+
+	out := &rds.DescribeDBSubnetGroupsOutput{}
+	if in.DBSubnetGroupName != nil {
+		g, ok := f.subnetGroups[*in.DBSubnetGroupName]
+		if !ok {
+			return out, notFound(rds.ErrCodeDBSubnetGroupNotFoundFault, "DBSubnetGroup", *in.DBSubnetGroupName)
+		}
+		out.DBSubnetGroups = []*rds.DBSubnetGroup{g}
+		return out, nil
+	}
+	for _, g := range f.subnetGroups {
+		out.DBSubnetGroups = append(out.DBSubnetGroups, g)
+	}
+	return out, nil
+}
+
+// subnetGroup returns the subnet group reported on an instance.
+func (f *RDS) subnetGroup(name *string) *rds.DBSubnetGroup {
+	if name == nil {
+		return nil
+	}
+	g := &rds.DBSubnetGroup{DBSubnetGroupName: name}
+	if added, ok := f.subnetGroups[*name]; ok {
+		g.VpcId = added.VpcId
+	}
+	return g
+}
+
+// checkReplacement rejects modifications RDS cannot make in place, moving to
+// a subnet group of another VPC and converting storage to magnetic.
+func (f *RDS) checkReplacement(db *rds.DBInstance, in *rds.ModifyDBInstanceInput) error {
+	if in.DBSubnetGroupName != nil && db.DBSubnetGroup != nil {
+		to := f.subnetGroup(in.DBSubnetGroupName)
+		if db.DBSubnetGroup.VpcId != nil && to.VpcId != nil && *db.DBSubnetGroup.VpcId != *to.VpcId {
+			return awserr.New(rds.ErrCodeInvalidVPCNetworkStateFault,
+				"The DB instance cannot be moved to a subnet group in a different VPC.", nil)
+		}
+	}
+	if in.StorageType != nil && *in.StorageType == "standard" && aws.StringValue(db.StorageType) != "standard" {
+		return awserr.New("InvalidParameterCombination",
+			"Storage type standard is not supported for modification.", nil)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+// GetResourcesPages lists the tagged instances like the resource groups
+// tagging API, in a single page.
+func (f *RDS) GetResourcesPages(in *resourcegroupstaggingapi.GetResourcesInput, fn func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool) error {
+	f.mu.Lock()
+	if err := f.call("GetResources"); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	arns := make([]string, 0, len(f.tags))
+	for arn, tags := range f.tags {
+		if len(tags) > 0 && strings.Contains(arn, ":db:") {
+			arns = append(arns, arn)
+		}
+	}
+	sort.Strings(arns)
+
+	out := &resourcegroupstaggingapi.GetResourcesOutput{}
+	for _, arn := range arns {
+		m := &resourcegroupstaggingapi.ResourceTagMapping{ResourceARN: str(arn)}
+		for _, t := range f.tagList(arn) {
+			m.Tags = append(m.Tags, &resourcegroupstaggingapi.Tag{Key: t.Key, Value: t.Value})
+		}
+		out.ResourceTagMappingList = append(out.ResourceTagMappingList, m)
+	}
+	f.mu.Unlock()
+
+	fn(out, true)
+	return nil
+}
@@ -0,0 +1,92 @@
+package fake
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// AddTagsToResource adds or overwrites tags on an instance.
+func (f *RDS) AddTagsToResource(in *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("AddTagsToResource"); err != nil {
+		return &rds.AddTagsToResourceOutput{}, err
+	}
+	if err := f.checkResource(*in.ResourceName); err != nil {
+		return &rds.AddTagsToResourceOutput{}, err
+	}
+	f.setTags(*in.ResourceName, in.Tags)
+	return &rds.AddTagsToResourceOutput{}, nil
+}
+
+// RemoveTagsFromResource removes tags from an instance.
+func (f *RDS) RemoveTagsFromResource(in *rds.RemoveTagsFromResourceInput) (*rds.RemoveTagsFromResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RemoveTagsFromResource"); err != nil {
+		return &rds.RemoveTagsFromResourceOutput{}, err
+	}
+	if err := f.checkResource(*in.ResourceName); err != nil {
+		return &rds.RemoveTagsFromResourceOutput{}, err
+	}
+	for _, k := range in.TagKeys {
+		delete(f.tags[*in.ResourceName], *k)
+	}
+	return &rds.RemoveTagsFromResourceOutput{}, nil
+}
+
+// ListTagsForResource returns the tags of an instance sorted by key.
+func (f *RDS) ListTagsForResource(in *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ListTagsForResource"); err != nil {
+		return &rds.ListTagsForResourceOutput{}, err
+	}
+	if err := f.checkResource(*in.ResourceName); err != nil {
+		return &rds.ListTagsForResourceOutput{}, err
+	}
+	return &rds.ListTagsForResourceOutput{TagList: f.tagList(*in.ResourceName)}, nil
+}
+
+// Tags returns a copy of the tags on the instance.
+func (f *RDS) Tags(id string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]string{}
+	for k, v := range f.tags[f.arn("db", id)] {
+		out[k] = v
+	}
+	return out
+}
+
+func (f *RDS) checkResource(arn string) error {
+	for _, i := range f.instances {
+		if *i.db.DBInstanceArn == arn {
+			return nil
+		}
+	}
+	return awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance "+arn+" not found.", nil)
+}
+
+func (f *RDS) setTags(arn string, tags []*rds.Tag) {
+	if f.tags[arn] == nil {
+		f.tags[arn] = map[string]string{}
+	}
+	for _, t := range tags {
+		f.tags[arn][*t.Key] = *t.Value
+	}
+}
+
+func (f *RDS) tagList(arn string) (out []*rds.Tag) {
+	keys := make([]string, 0, len(f.tags[arn]))
+	for k := range f.tags[arn] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, &rds.Tag{Key: str(k), Value: str(f.tags[arn][k])})
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package rds
+
+// Features switched with the feature gates, all are enabled by default.
+const (
+	// FeatureActions runs the actions requested with the action annotation.
+	FeatureActions = "Actions"
+	// FeatureClaims binds DatabaseClaims to DatabaseInstances.
+	FeatureClaims = "Claims"
+	// FeatureCostEstimates estimates the monthly cost of the databases.
+	FeatureCostEstimates = "CostEstimates"
+	// FeaturePolicies enforces the DatabasePolicies on creation.
+	FeaturePolicies = "Policies"
+	// FeatureSchedules stops and starts instances on their schedule.
+	FeatureSchedules = "Schedules"
+)
+
+// Features lists the known features.
+var Features = []string{
+	FeatureActions,
+	FeatureClaims,
+	FeatureCostEstimates,
+	FeaturePolicies,
+	FeatureSchedules,
+}
+
+// Enabled reports whether the feature gates leave the feature enabled.
+func (c Config) Enabled(feature string) bool {
+	enabled, ok := c.FeatureGates[feature]
+	return !ok || enabled
+}
+
+// enabled reports whether the feature gates leave the feature enabled.
+func (h *Handler) enabled(feature string) bool {
+	return h.cfg.Enabled(feature)
+}
@@ -0,0 +1,38 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureGates(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+	s.h.cfg.FeatureGates = map[string]bool{FeatureActions: false, FeatureClaims: true}
+	require.True(t, s.h.enabled(FeatureClaims))
+	require.True(t, s.h.enabled(FeatureSchedules))
+
+	// Disabled actions stay requested.
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationAction: v1alpha1.ActionReboot}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("RebootDBInstance"))
+	require.Contains(t, s.sdk.database("app").Annotations, v1alpha1.AnnotationAction)
+
+	s.h.cfg.FeatureGates = nil
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("RebootDBInstance"))
+}
+
+func TestFeatureGates_Claims(t *testing.T) {
+	s := newClaimScenario(t)
+	s.h.cfg.FeatureGates = map[string]bool{FeatureClaims: false}
+	require.NoError(t, s.sdk.Create(testClaim("app", v1alpha1.DatabaseClaimSpec{})))
+	s.handle("DatabaseClaim/default/app")
+	require.Empty(t, claim(s, "app").Status.Phase)
+}
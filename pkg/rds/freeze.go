@@ -0,0 +1,166 @@
+package rds
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Freeze is a change freeze read from the freeze ConfigMap, every key of the
+// ConfigMap holds one freeze:
+//
+//	quarter-end: |
+//	  start: 2018-12-24T00:00:00Z
+//	  end: 2019-01-07T00:00:00Z
+//	  selector:
+//	    matchLabels:
+//	      team: finance
+//
+// A freeze without namespaces or selector applies to every database.
+type Freeze struct {
+	Name       string                `json:"-"`
+	Start      time.Time             `json:"start"`
+	End        time.Time             `json:"end"`
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Selector   *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Applies reports whether the freeze covers the database at the given time.
+func (f *Freeze) Applies(o *v1alpha1.Database, now time.Time) (bool, error) {
+	if now.Before(f.Start) || !now.Before(f.End) {
+		return false, nil
+	}
+	if len(f.Namespaces) > 0 {
+		found := false
+		for _, ns := range f.Namespaces {
+			found = found || ns == o.Namespace
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if f.Selector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(f.Selector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(o.Labels)), nil
+}
+
+// freezes reads the freeze ConfigMap, a missing ConfigMap means no freezes.
+// Invalid entries are logged and skipped so a typo does not block changes
+// to every database.
+func (h *Handler) freezes() ([]*Freeze, error) {
+	if h.cfg.FreezeConfigMap == "" {
+		return nil, nil
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: h.cfg.FreezeNamespace,
+			Name:      h.cfg.FreezeConfigMap,
+		},
+	}
+	if err := h.sdk.Get(cm); k8errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var out []*Freeze
+	for _, name := range sortedKeys(cm.Data) {
+		f := &Freeze{Name: name}
+		if err := yaml.Unmarshal([]byte(cm.Data[name]), f); err != nil {
+			log.WithError(err).WithField("freeze", name).Warn("skipping invalid freeze")
+			continue
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// activeFreeze returns the freeze covering the database that ends last, or
+// nil if there is none.
+func (h *Handler) activeFreeze(o *v1alpha1.Database, now time.Time) (*Freeze, error) {
+	freezes, err := h.freezes()
+	if err != nil {
+		return nil, err
+	}
+	var active *Freeze
+	for _, f := range freezes {
+		ok, err := f.Applies(o, now)
+		if err != nil {
+			log.WithError(err).WithField("freeze", f.Name).Warn("skipping freeze with invalid selector")
+			continue
+		}
+		if ok && (active == nil || f.End.After(active.End)) {
+			active = f
+		}
+	}
+	return active, nil
+}
+
+// modify applies a modification unless a change freeze covers the database
+// and it is not annotated as urgent. A deferred modification is returned for
+// the caller to record with setDeferred.
+func (h *Handler) modify(o *v1alpha1.Database, reason string, req *rds.ModifyDBInstanceInput) (*v1alpha1.DeferredAction, error) {
+	if o.Annotations[v1alpha1.AnnotationIgnoreFreeze] != "true" {
+		freeze, err := h.activeFreeze(o, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if freeze != nil {
+			action, err := plannedAction("ModifyDBInstance", req)
+			if err != nil {
+				return nil, err
+			}
+			h.logger(o).
+				WithField("freeze", freeze.Name).
+				WithField("reason", reason).
+				Info("deferring modification during change freeze")
+			return &v1alpha1.DeferredAction{
+				Reason: reason,
+				Input:  action.Input,
+				Freeze: freeze.Name,
+				Until:  metav1.NewTime(freeze.End),
+			}, nil
+		}
+	}
+
+	_, err := h.rds.ModifyDBInstance(req)
+	return nil, err
+}
+
+// setDeferred replaces the deferred action for the reason, a nil action
+// removes it.
+func setDeferred(list []v1alpha1.DeferredAction, reason string, d *v1alpha1.DeferredAction) []v1alpha1.DeferredAction {
+	var out []v1alpha1.DeferredAction
+	for _, existing := range list {
+		if existing.Reason != reason {
+			out = append(out, existing)
+		}
+	}
+	if d != nil {
+		out = append(out, *d)
+		sort.Slice(out, func(i, j int) bool { return out[i].Reason < out[j].Reason })
+	}
+	return out
+}
+
+func sameDeferred(a, b []v1alpha1.DeferredAction) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,127 @@
+package rds
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setFreeze stores the freeze calendar with a single freeze ending at end.
+func setFreeze(s *scenario, end time.Time, selector string) {
+	s.h.cfg.FreezeNamespace = "kube-system"
+	s.h.cfg.FreezeConfigMap = "rds-freezes"
+
+	freeze := fmt.Sprintf("start: %s\nend: %s\n", time.Now().Add(-time.Hour).Format(time.RFC3339),
+		end.Format(time.RFC3339))
+	if selector != "" {
+		freeze += "selector:\n  matchLabels:\n    " + selector + "\n"
+	}
+	require.NoError(s.t, s.sdk.Update(&corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "rds-freezes"},
+		Data:       map[string]string{"quarter-end": freeze},
+	}))
+}
+
+func TestFreeze_DefersDriftRevert(t *testing.T) {
+	s := createdScenario(t, "app")
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+	setFreeze(s, time.Now().Add(time.Hour), "")
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+
+	db := s.sdk.database("app")
+	require.Equal(t, "Deferred", driftedCondition(db).Reason)
+	require.Len(t, db.Status.Deferred, 1)
+	require.Equal(t, "DriftRevert", db.Status.Deferred[0].Reason)
+	require.Equal(t, "quarter-end", db.Status.Deferred[0].Freeze)
+	require.Contains(t, db.Status.Deferred[0].Input, `"DBInstanceClass":"db.t2.micro"`)
+
+	// Once the freeze is over the revert is applied.
+	setFreeze(s, time.Now().Add(-time.Minute), "")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	db = s.sdk.database("app")
+	require.Equal(t, "Reverted", driftedCondition(db).Reason)
+	require.Empty(t, db.Status.Deferred)
+}
+
+func TestFreeze_Selector(t *testing.T) {
+	s := createdScenario(t, "app")
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+	setFreeze(s, time.Now().Add(time.Hour), "team: finance")
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	require.Empty(t, s.sdk.database("app").Status.Deferred)
+}
+
+func TestFreeze_IgnoreFreezeAnnotation(t *testing.T) {
+	s := createdScenario(t, "app")
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationIgnoreFreeze: "true"}
+	s.apply(db)
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+	setFreeze(s, time.Now().Add(time.Hour), "")
+
+	consoleChange(s, "default-app")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestFreeze_DefersUpgrade(t *testing.T) {
+	s := upgradeScenario(t, "11.1")
+	setFreeze(s, time.Now().Add(time.Hour), "")
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+
+	db := s.sdk.database("app")
+	require.Equal(t, v1alpha1.UpgradePhaseSnapshotting, db.Status.Upgrade.Phase)
+	require.Len(t, db.Status.Deferred, 1)
+	require.Equal(t, "EngineUpgrade", db.Status.Deferred[0].Reason)
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+
+	setFreeze(s, time.Now().Add(-time.Minute), "")
+	require.NoError(t, s.sync("app"))
+	db = s.sdk.database("app")
+	require.Equal(t, v1alpha1.UpgradePhaseUpgrading, db.Status.Upgrade.Phase)
+	require.Empty(t, db.Status.Deferred)
+}
+
+func TestHandler_InvalidWindows(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.PreferredBackupWindow = "03:00-04:00"
+	db.Spec.PreferredMaintenanceWindow = "sun:03:30-sun:05:00"
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	db = s.sdk.database("app")
+	require.Equal(t, v1alpha1.StateFailure, db.Status.State)
+	require.Contains(t, db.Status.Error, "overlaps")
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+}
+
+func TestHandler_Windows(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.PreferredBackupWindow = "03:00-04:00"
+	db.Spec.PreferredMaintenanceWindow = "sun:05:00-sun:06:00"
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	instance := s.rds.Instance("default-app")
+	require.Equal(t, "03:00-04:00", *instance.PreferredBackupWindow)
+	require.Equal(t, "sun:05:00-sun:06:00", *instance.PreferredMaintenanceWindow)
+}
@@ -2,125 +2,482 @@ package rds
 
 import (
 	"context"
+	"errors"
 	"os"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
 	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/cost"
+	"github.com/coldog/rds-operator/pkg/logging"
+	"github.com/coldog/rds-operator/pkg/naming"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
-	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // SDK Represents the operator SDK.
 type SDK interface {
+	Get(object sdk.Object) error
 	Create(object sdk.Object) error
 	Update(object sdk.Object) error
+	List(namespace string, into sdk.Object) error
+	Delete(object sdk.Object) error
 }
 
 type sdkWrap struct{}
 
+func (sdkWrap) Get(object sdk.Object) error    { return sdk.Get(object) }
 func (sdkWrap) Create(object sdk.Object) error { return sdk.Create(object) }
 func (sdkWrap) Update(object sdk.Object) error { return sdk.Update(object) }
+func (sdkWrap) List(namespace string, into sdk.Object) error {
+	return sdk.List(namespace, into)
+}
+func (sdkWrap) Delete(object sdk.Object) error { return sdk.Delete(object) }
+
+// Config configures the handler.
+type Config struct {
+	// DryRun plans the AWS calls for every database without executing them.
+	DryRun bool
+	// ClusterID identifies this cluster in the ownership tags.
+	ClusterID string
+	// DefaultTags are applied to every instance, the tags of a database
+	// override them.
+	DefaultTags map[string]string
+	// TagLabels and TagAnnotations list the label and annotation keys copied
+	// to RDS tags.
+	TagLabels      []string
+	TagAnnotations []string
+	// DeletionPolicy applies to databases without spec.deletionPolicy, empty
+	// takes a final snapshot.
+	DeletionPolicy string
+	// DriftPolicy applies to databases without spec.driftPolicy, empty
+	// ignores drift.
+	DriftPolicy string
+	// DriftInterval is the minimum time between drift audits of a database.
+	DriftInterval time.Duration
+	// StorageInterval is the minimum time between free storage checks of a
+	// database with operator storage autoscaling.
+	StorageInterval time.Duration
+	// DisasterRecoveryInterval is the minimum time between snapshot copies
+	// to the disaster recovery regions of a database.
+	DisasterRecoveryInterval time.Duration
+	// ScheduleInterval is the minimum time between checks of the stop and
+	// start schedule of a database.
+	ScheduleInterval time.Duration
+	// FreezeNamespace and FreezeConfigMap locate the change freeze calendar,
+	// an empty name disables freezes.
+	FreezeNamespace string
+	FreezeConfigMap string
+	// InstanceNamespace holds the Databases managing the RDS instances of
+	// DatabaseInstances.
+	InstanceNamespace string
+	// Naming renders the identifiers of new instances, nil uses
+	// naming.DefaultTemplate.
+	Naming *naming.Template
+	// Pricing prices the instances for the cost estimates, nil disables
+	// them.
+	Pricing *cost.Table
+	// Cache configures the shared instance cache, a zero interval disables
+	// it.
+	Cache CacheConfig
+	// AWSRate and AWSBurst limit the AWS API requests per second, a zero
+	// rate is unlimited.
+	AWSRate  float64
+	AWSBurst int
+	// AWSRegion is the region of the instances, empty uses $AWS_REGION.
+	AWSRegion string
+	// AWSEndpoints override the endpoint URL of AWS services in that region
+	// by endpoint ID, for example rds or monitoring.
+	AWSEndpoints map[string]string
+	// FeatureGates switch features by name, features not listed are
+	// enabled.
+	FeatureGates map[string]bool
+}
 
 // NewHandler returns a new handler instantiating and AWS client.
-func NewHandler() (sdk.Handler, error) {
+func NewHandler(cfg Config) (*Handler, error) {
+	region := cfg.AWSRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
 	awsSession, err := session.NewSession(&aws.Config{
-		Region: str(os.Getenv("AWS_REGION")),
+		Region:                        str(region),
+		EndpointResolver:              endpointResolver(region, cfg.AWSEndpoints),
 		CredentialsChainVerboseErrors: aws.Bool(true),
 	})
 	if err != nil {
 		return nil, err
 	}
+	limitRequests(awsSession, cfg.AWSRate, cfg.AWSBurst)
+	logRequests(awsSession)
+
+	h := &Handler{
+		rds:     rds.New(awsSession),
+		sdk:     sdkWrap{},
+		cfg:     cfg,
+		metrics: NewCloudWatchMetrics(awsSession),
+		region:  aws.StringValue(awsSession.Config.Region),
+
+		regionRDS: (&regionClients{p: awsSession}).client,
+	}
+	if cfg.Cache.Interval > 0 {
+		h.cache = newInstanceCache(h.rds, resourcegroupstaggingapi.New(awsSession), cfg.Cache)
+		h.rds = h.cache
+	}
+	return h, nil
+}
 
-	return &Handler{rds: rds.New(awsSession), sdk: sdkWrap{}}, nil
+// endpointResolver resolves the endpoints of the region to the overrides,
+// other endpoints and regions use the defaults.
+func endpointResolver(region string, overrides map[string]string) endpoints.Resolver {
+	if len(overrides) == 0 {
+		return endpoints.DefaultResolver()
+	}
+	return endpoints.ResolverFunc(func(service, r string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if url, ok := overrides[service]; ok && r == region {
+			return endpoints.ResolvedEndpoint{URL: url, SigningRegion: r}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, r, opts...)
+	})
+}
+
+// limitRequests counts the requests of every client of the session and
+// makes each attempt wait for the rate limit.
+func limitRequests(s *session.Session, rps float64, burst int) {
+	limit := rate.Inf
+	if rps > 0 {
+		limit = rate.Limit(rps)
+	}
+	limiter := rate.NewLimiter(limit, burst)
+	s.Handlers.Sign.PushFront(func(r *request.Request) {
+		awsRequests.WithLabelValues(r.Operation.Name).Inc()
+		start := time.Now()
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = err
+			return
+		}
+		awsRateLimitWait.Add(time.Since(start).Seconds())
+	})
+}
+
+// RunCache refreshes the instance cache until ctx is done, it returns
+// immediately when the cache is disabled.
+func (h *Handler) RunCache(ctx context.Context) {
+	if h.cache != nil {
+		h.cache.Run(ctx)
+	}
 }
 
 // Handler will create RDS databases.
 type Handler struct {
 	rds rdsiface.RDSAPI
 	sdk SDK
+	cfg Config
+
+	metrics StorageMetrics
+	// regionRDS returns the client for a disaster recovery region.
+	regionRDS func(region string) rdsiface.RDSAPI
+	// region is the region of the instances.
+	region string
+	// cache is the shared instance cache wrapping the client, if enabled.
+	cache *instanceCache
+
+	mu      sync.Mutex
+	checked map[string]time.Time
+	// reconciles are the reconcile IDs of the objects being synced.
+	reconciles map[string]string
+	// costs are the estimated monthly costs by namespace and name.
+	costs map[string]map[string]float64
+}
+
+// errNotReady is returned while the instance is still being provisioned.
+var errNotReady = errors.New("db instance is not available yet")
+
+// dbName returns the RDS instance identifier of the database. Databases
+// created before identifiers were recorded in the status use namespace-name.
+func dbName(o *v1alpha1.Database) string {
+	if o.Status.InstanceIdentifier != "" {
+		return o.Status.InstanceIdentifier
+	}
+	return o.Namespace + "-" + o.Name
 }
 
-func dbName(o *v1alpha1.Database) string { return o.Namespace + "-" + o.Name }
+// identifier chooses the identifier of a database without one in the
+// status. Databases that may already have an instance keep namespace-name.
+func (h *Handler) identifier(o *v1alpha1.Database) string {
+	switch o.Status.State {
+	case v1alpha1.StateCreated, v1alpha1.StateFailure, v1alpha1.StatePlanned:
+		return dbName(o)
+	case v1alpha1.StatePending:
+		// Pending databases without an error are being created.
+		if o.Status.Error == "" {
+			return dbName(o)
+		}
+	}
+	t := h.cfg.Naming
+	if t == nil {
+		t, _ = naming.Parse(naming.DefaultTemplate)
+	}
+	return t.Identifier(h.cfg.ClusterID, o.Namespace, o.Name)
+}
 
 func secretName(o *v1alpha1.Database) string { return o.Name + "-db-credentials" }
 
-// Handle will handle a specific event.
+// Handle will handle a specific event. The logs of the sync carry the
+// reconcile ID of ctx, or a new one.
 func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
+	defer h.startReconcile(ctx, event.Object)()
+	return h.handle(event)
+}
+
+func (h *Handler) handle(event sdk.Event) error {
 	switch o := event.Object.(type) {
 	case *v1alpha1.Database:
+		// Databases take their class when created, later changes to the
+		// class do not affect them.
+		if !event.Deleted && o.DeletionTimestamp == nil &&
+			o.Status.State != v1alpha1.StateCreated && o.Status.State != v1alpha1.StateFailure {
+			if handled, err := h.applyClass(o); handled || err != nil {
+				return err
+			}
+		}
+		if h.planOnly(o) {
+			return h.plan(o, event.Deleted)
+		}
+
 		if event.Deleted {
 			return h.delete(o)
 		}
+		if o.DeletionTimestamp != nil {
+			return h.finalize(o)
+		}
+		if protected(o) != hasFinalizer(o) {
+			return h.syncFinalizer(o)
+		}
 
-		if o.Status.State == v1alpha1.StateCreated ||
-			o.Status.State == v1alpha1.StateFailure {
+		if err := v1alpha1.Validate(o); err != nil {
+			return h.invalid(o, err)
+		}
+
+		if o.Status.State == v1alpha1.StateCreated {
+			// Errors and plans left from plan mode are cleared first.
+			if o.Status.Error != "" || o.Status.Plan != nil {
+				return h.setStatus(o, v1alpha1.StateCreated, nil)
+			}
+			// Each step updates the status, so later steps run on the
+			// following syncs.
+			if _, ok := o.Annotations[v1alpha1.AnnotationAction]; ok && h.enabled(FeatureActions) {
+				if handled, err := h.runAction(o); handled || err != nil {
+					return err
+				}
+			}
+			if !reflect.DeepEqual(h.tags(o), o.Status.Tags) {
+				return h.syncTags(o)
+			}
+			if handled, err := h.estimateCost(o); handled || err != nil {
+				return err
+			}
+			if handled, err := h.hibernate(o); handled || err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(o.Spec.Monitoring, o.Status.Monitoring) {
+				return h.syncMonitoring(o)
+			}
+			if o.Spec.DeletionProtection != o.Status.DeletionProtection {
+				return h.syncDeletionProtection(o)
+			}
+			if nativeMaxStorage(o) != o.Status.MaxAllocatedStorage {
+				return h.syncNativeStorage(o)
+			}
+			if handled, err := h.encrypt(o); handled || err != nil {
+				return err
+			}
+			if handled, err := h.replace(o); handled || err != nil {
+				return err
+			}
+			if handled, err := h.upgradeEngine(o); handled || err != nil {
+				return err
+			}
+			if handled, err := h.growStorage(o); handled || err != nil {
+				return err
+			}
+			if handled, err := h.copySnapshots(o); handled || err != nil {
+				return err
+			}
+			return h.auditDrift(o)
+		}
+		if o.Status.State == v1alpha1.StateFailure {
 			return nil
 		}
 
-		if err := h.setStatus(o, v1alpha1.StatePending, nil); err != nil {
-			return err
+		// Pending databases without an error are being created.
+		if o.Status.State != v1alpha1.StatePending || o.Status.Error != "" {
+			if err := h.checkPolicies(o); isPolicyError(err) {
+				return h.hold(o, "PolicyViolation", err)
+			} else if err != nil {
+				return err
+			}
 		}
 
+		if o.Status.InstanceIdentifier == "" {
+			o.Status.InstanceIdentifier = h.identifier(o)
+		}
+		// The defaulted spec is saved before the instance is created, a
+		// generated password must survive the syncs waiting for the
+		// endpoint.
 		v1alpha1.Defaults(o)
+		if err := h.setStatus(o, v1alpha1.StatePending, nil); err != nil {
+			return err
+		}
 
-		if err := h.create(o); err != nil {
+		if err := h.create(o); err == errNotReady {
+			return nil
+		} else if isTransient(err) {
+			return err
+		} else if err != nil {
 			return h.setStatus(o, v1alpha1.StateFailure, err)
 		}
 
 		return h.setStatus(o, v1alpha1.StateCreated, nil)
+	case *v1alpha1.DatabaseClaim:
+		if event.Deleted || !h.enabled(FeatureClaims) {
+			return nil
+		}
+		return h.syncClaim(o)
+	case *v1alpha1.DatabaseInstance:
+		if !h.enabled(FeatureClaims) {
+			return nil
+		}
+		if event.Deleted {
+			return h.deleteInstance(o)
+		}
+		return h.syncInstance(o)
 	}
 	return nil
 }
 
 func (h *Handler) setStatus(o *v1alpha1.Database, status string, err error) error {
-	log.WithField("db", dbName(o)).WithField("state", status).Debug("set status")
+	h.logger(o).WithField("state", status).Debug("set status")
 
 	copy := o.DeepCopy()
 	copy.Status.State = status
+	copy.Status.Plan = nil
+	copy.Status.Error = ""
 	if err != nil {
 		copy.Status.Error = err.Error()
 	}
 	return h.sdk.Update(copy)
 }
 
+// invalid records a validation error. Databases that are not created yet
+// fail, created databases keep their state and are left alone until the spec
+// is fixed.
+func (h *Handler) invalid(o *v1alpha1.Database, err error) error {
+	h.logger(o).WithError(err).Warn("invalid database spec")
+	if o.Status.Error == err.Error() {
+		return nil
+	}
+	state := v1alpha1.StateFailure
+	if o.Status.State == v1alpha1.StateCreated {
+		state = v1alpha1.StateCreated
+	}
+	return h.setStatus(o, state, err)
+}
+
 func (h *Handler) delete(cr *v1alpha1.Database) error {
-	log.WithField("db", dbName(cr)).Debug("deleteing db")
+	h.logger(cr).Debug("deleteing db")
+	h.forgetChecks(cr)
+	h.setCost(cr, 0)
+	for _, p := range cr.Status.DisasterRecovery {
+		recoveryPoint.DeleteLabelValues(cr.Namespace, cr.Name, p.Region)
+	}
+	if cr.Spec.DeletionProtection {
+		h.logger(cr).Warn("keeping instance with deletion protection")
+		if err := h.retain(cr, retainedByProtection); err != nil {
+			return err
+		}
+		recordEvent(h.sdk, databaseRef(cr.Namespace, cr.Name), corev1.EventTypeWarning, "InstanceKept",
+			"Instance "+dbName(cr)+" has deletion protection enabled and was not deleted")
+		return nil
+	}
+	req := h.deletionInput(cr, time.Now())
+	if req == nil {
+		h.logger(cr).Info("retaining instance")
+		if err := h.retain(cr, retainedByPolicy); err != nil {
+			return err
+		}
+		recordEvent(h.sdk, databaseRef(cr.Namespace, cr.Name), corev1.EventTypeNormal, "InstanceRetained",
+			"Instance "+dbName(cr)+" was retained by the deletion policy")
+		return nil
+	}
+	h.deleteEncrypted(cr)
+	h.deleteReplacement(cr)
+	return h.deleteDB(cr, req)
+}
 
-	_, err := h.rds.DeleteDBInstance(&rds.DeleteDBInstanceInput{
-		DBInstanceIdentifier: str(dbName(cr)),
-	})
+// retain tags the instance of a deleted database as retained so the orphan
+// sweeper does not delete it.
+func (h *Handler) retain(cr *v1alpha1.Database, reason string) error {
+	db, err := h.getDB(cr)
+	if isNotFound(err) || err == nil && db == nil {
+		return nil
+	}
 	if err != nil {
-		log.WithError(err).WithField("db", dbName(cr)).Error("deletion failed")
+		return err
 	}
+	_, err = h.rds.AddTagsToResource(&rds.AddTagsToResourceInput{
+		ResourceName: db.DBInstanceArn,
+		Tags:         []*rds.Tag{{Key: str(TagRetained), Value: str(reason)}},
+	})
 	return err
 }
 
 func (h *Handler) create(o *v1alpha1.Database) error {
-	err := h.getDB(o)
+	db, err := h.getDB(o)
+	if isTransient(err) {
+		return err
+	}
 	if err == nil {
-		log.WithField("db", dbName(o)).Info("db already exists")
-		return nil
+		h.logger(o).Info("db already exists")
+	} else {
+		db, err = h.createDB(o)
+		if err != nil {
+			h.logger(o).WithError(err).Error("db creation failed")
+			return err
+		}
 	}
 
-	db, err := h.createDB(o)
-	if err != nil {
-		log.WithField("db", dbName(o)).WithError(err).Error("db creation failed")
-		return err
+	// An existing instance without details has nothing to write yet.
+	if db == nil {
+		return nil
+	}
+	// The endpoint is only assigned once the instance finishes creating.
+	if db.Endpoint == nil {
+		h.logger(o).
+			WithField("status", aws.StringValue(db.DBInstanceStatus)).
+			Debug("waiting for db endpoint")
+		return errNotReady
 	}
 
 	err = h.sdk.Create(h.createSecret(o, db))
 	if err != nil {
-		if errors.IsAlreadyExists(err) {
+		if k8errors.IsAlreadyExists(err) {
 			return nil
 		}
-		log.WithField("db", dbName(o)).WithError(err).Error("secret creation failed")
+		h.logger(o).WithError(err).Error("secret creation failed")
 		return err
 	}
 
@@ -128,7 +485,7 @@ func (h *Handler) create(o *v1alpha1.Database) error {
 }
 
 func (h *Handler) createSecret(cr *v1alpha1.Database, db *rds.DBInstance) *corev1.Secret {
-	log.WithField("db", dbName(cr)).Debug("creating secret")
+	h.logger(cr).Debug("creating secret")
 
 	return &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
@@ -163,43 +520,100 @@ func (h *Handler) createSecret(cr *v1alpha1.Database, db *rds.DBInstance) *corev
 	}
 }
 
-func (h *Handler) getDB(cr *v1alpha1.Database) error {
-	log.WithField("db", dbName(cr)).Debug("fetching db")
+func (h *Handler) getDB(cr *v1alpha1.Database) (*rds.DBInstance, error) {
+	h.logger(cr).Debug("fetching db")
+	return h.describeInstance(dbName(cr))
+}
 
-	_, err := h.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{
-		DBInstanceIdentifier: str(dbName(cr)),
+func (h *Handler) describeInstance(id string) (*rds.DBInstance, error) {
+	out, err := h.rds.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: str(id),
 	})
-	return err
+	if err != nil || len(out.DBInstances) == 0 {
+		return nil, err
+	}
+	return out.DBInstances[0], nil
 }
 
 func (h *Handler) createDB(cr *v1alpha1.Database) (*rds.DBInstance, error) {
-	spec := cr.Spec
-	req := &rds.CreateDBInstanceInput{
-		DBInstanceIdentifier:    str(dbName(cr)),
-		MasterUsername:          str(spec.Username),
-		MasterUserPassword:      str(spec.Password),
-		DBName:                  str(spec.Database),
-		Engine:                  str(spec.Engine),
-		AllocatedStorage:        i64(spec.Storage),
-		AutoMinorVersionUpgrade: bo(spec.AutoMinorVersionUpgrade),
-		AvailabilityZone:        str(spec.AvailabilityZone),
-		BackupRetentionPeriod:   i64(spec.BackupRetentionPeriod),
-		CharacterSetName:        str(spec.CharacterSetName),
-		DBInstanceClass:         str(spec.InstanceClass),
-		DBSubnetGroupName:       str(spec.SubnetGroup),
-		EngineVersion:           str(spec.EngineVersion),
-		Iops:                    i64(spec.Iops),
-		StorageType:             str(spec.StorageType),
-		MultiAZ:                 bo(spec.MultiAZ),
-		StorageEncrypted:        bo(spec.Encrypted),
-		VpcSecurityGroupIds:     strs(spec.SecurityGroups),
-	}
-
-	log.WithField("db", dbName(cr)).
-		WithField("instance", req).
-		WithField("resource", cr).
-		Debug("creating db")
+	req := createInput(cr, h.tags(cr))
+
+	h.logger(cr).WithField("input", logging.Redact(req)).Debug("creating db")
 
 	out, err := h.rds.CreateDBInstance(req)
 	return out.DBInstance, err
 }
+
+func createInput(cr *v1alpha1.Database, tags map[string]string) *rds.CreateDBInstanceInput {
+	spec := cr.Spec
+	in := &rds.CreateDBInstanceInput{
+		DBInstanceIdentifier:       str(dbName(cr)),
+		MasterUsername:             str(spec.Username),
+		MasterUserPassword:         str(spec.Password),
+		DBName:                     str(spec.Database),
+		Engine:                     str(spec.Engine),
+		AllocatedStorage:           i64(spec.Storage),
+		AutoMinorVersionUpgrade:    bo(spec.AutoMinorVersionUpgrade),
+		AvailabilityZone:           str(spec.AvailabilityZone),
+		BackupRetentionPeriod:      i64(spec.BackupRetentionPeriod),
+		CharacterSetName:           str(spec.CharacterSetName),
+		DBInstanceClass:            str(spec.InstanceClass),
+		DBSubnetGroupName:          str(spec.SubnetGroup),
+		EngineVersion:              str(spec.EngineVersion),
+		Iops:                       i64(spec.Iops),
+		StorageType:                str(spec.StorageType),
+		MultiAZ:                    bo(spec.MultiAZ),
+		StorageEncrypted:           bo(spec.Encrypted),
+		KmsKeyId:                   str(spec.KmsKeyID),
+		VpcSecurityGroupIds:        strs(spec.SecurityGroups),
+		PreferredBackupWindow:      str(spec.PreferredBackupWindow),
+		PreferredMaintenanceWindow: str(spec.PreferredMaintenanceWindow),
+		MaxAllocatedStorage:        i64(nativeMaxStorage(cr)),
+		Tags:                       tagList(tags),
+	}
+	if spec.DeletionProtection {
+		in.DeletionProtection = bo(true)
+	}
+	if m := spec.Monitoring; m != nil {
+		if m.PerformanceInsights {
+			in.EnablePerformanceInsights = bo(true)
+			in.PerformanceInsightsRetentionPeriod = i64(m.PerformanceInsightsRetentionPeriod)
+			in.PerformanceInsightsKMSKeyId = str(m.PerformanceInsightsKMSKeyID)
+		}
+		in.MonitoringInterval = i64(m.MonitoringInterval)
+		in.MonitoringRoleArn = str(m.MonitoringRoleArn)
+		in.EnableCloudwatchLogsExports = aws.StringSlice(m.EnableCloudwatchLogsExports)
+	}
+	return in
+}
+
+// isTransient reports whether the error is a throttling or retryable AWS
+// error, these leave the database pending so the event is retried.
+func isTransient(err error) bool {
+	return request.IsErrorThrottle(err) || request.IsErrorRetryable(err)
+}
+
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == rds.ErrCodeDBInstanceNotFoundFault
+}
+
+func isInvalidState(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == rds.ErrCodeInvalidDBInstanceStateFault
+}
+
+func isAlreadyExists(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == rds.ErrCodeDBInstanceAlreadyExistsFault
+}
+
+func isSnapshotAlreadyExists(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == rds.ErrCodeDBSnapshotAlreadyExistsFault
+}
+
+func isSnapshotNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == rds.ErrCodeDBSnapshotNotFoundFault
+}
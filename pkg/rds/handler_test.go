@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
@@ -13,6 +14,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	k8errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -45,6 +47,10 @@ type mockSDK struct {
 	obj sdk.Object
 }
 
+func (m *mockSDK) Get(object sdk.Object) error {
+	return m.Called(object).Error(0)
+}
+
 func (m *mockSDK) Create(object sdk.Object) error {
 	m.obj = object
 	return m.Called(object).Error(0)
@@ -55,6 +61,14 @@ func (m *mockSDK) Update(object sdk.Object) error {
 	return m.Called(object).Error(0)
 }
 
+func (m *mockSDK) List(namespace string, into sdk.Object) error {
+	return nil
+}
+
+func (m *mockSDK) Delete(object sdk.Object) error {
+	return m.Called(object).Error(0)
+}
+
 func handler() (*mockRDS, *mockSDK, *Handler) {
 	sdk := &mockSDK{}
 	rds := &mockRDS{}
@@ -100,19 +114,20 @@ func TestHandler_Run(t *testing.T) {
 func TestHandler_AlreadySet(t *testing.T) {
 	r, s, h := handler()
 
-	h.Handle(context.Background(), sdk.Event{
-		Object: &v1alpha1.Database{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Database",
-				APIVersion: v1alpha1.SchemeGroupVersion.String(),
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: "default",
-				Name:      "test",
-			},
-			Status: v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated},
+	db := &v1alpha1.Database{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Database",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
 		},
-	})
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test",
+		},
+		Status: v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated},
+	}
+	db.Status.Tags = h.tags(db)
+
+	h.Handle(context.Background(), sdk.Event{Object: db})
 
 	s.AssertNotCalled(t, "Create")
 	s.AssertNotCalled(t, "Update")
@@ -312,3 +327,85 @@ func TestHandler_Delete(t *testing.T) {
 	s.AssertExpectations(t)
 	r.AssertExpectations(t)
 }
+
+func TestHandler_WaitsForEndpoint(t *testing.T) {
+	r, s, h := handler()
+
+	s.On("Update", mock.Anything).Return(nil)
+	r.On("DescribeDBInstances", mock.Anything).Return(
+		&rds.DescribeDBInstancesOutput{},
+		awserr.New(rds.ErrCodeDBInstanceNotFoundFault, "not found", nil),
+	)
+	r.On("CreateDBInstance", mock.Anything).Return(&rds.CreateDBInstanceOutput{
+		DBInstance: &rds.DBInstance{DBInstanceStatus: aws.String("creating")},
+	}, nil)
+
+	err := h.Handle(context.Background(), sdk.Event{
+		Object: &v1alpha1.Database{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Database",
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The database stays pending without a secret until the endpoint is
+	// assigned.
+	require.Equal(t, v1alpha1.StatePending, s.obj.(*v1alpha1.Database).Status.State)
+	s.AssertNotCalled(t, "Create", mock.Anything)
+
+	s.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
+
+func TestHandler_ExistingInstance(t *testing.T) {
+	r, s, h := handler()
+
+	s.On("Update", mock.Anything).Return(nil)
+	s.On("Create", mock.Anything).Return(nil)
+	r.On("DescribeDBInstances", mock.Anything).Return(&rds.DescribeDBInstancesOutput{
+		DBInstances: []*rds.DBInstance{{
+			DBInstanceIdentifier: aws.String("default-test"),
+			DBInstanceStatus:     aws.String("available"),
+			Endpoint: &rds.Endpoint{
+				Address: aws.String("existing"),
+				Port:    aws.Int64(5432),
+			},
+		}},
+	}, nil)
+
+	err := h.Handle(context.Background(), sdk.Event{
+		Object: &v1alpha1.Database{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Database",
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The secret points at the existing instance.
+	var secret *corev1.Secret
+	for _, call := range s.Calls {
+		if o, ok := call.Arguments.Get(0).(*corev1.Secret); ok && call.Method == "Create" {
+			secret = o
+		}
+	}
+	require.NotNil(t, secret)
+	require.Equal(t, "existing", string(secret.Data["host"]))
+	require.Equal(t, "5432", string(secret.Data["port"]))
+	require.Equal(t, v1alpha1.StateCreated, s.obj.(*v1alpha1.Database).Status.State)
+	r.AssertNotCalled(t, "CreateDBInstance", mock.Anything)
+
+	s.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
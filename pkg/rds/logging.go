@@ -0,0 +1,96 @@
+package rds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/logging"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// reconcileKey identifies an object by type, namespace and name.
+func reconcileKey(o sdk.Object) (string, error) {
+	m, err := meta.Accessor(o)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%T/%s/%s", o, m.GetNamespace(), m.GetName()), nil
+}
+
+// startReconcile records the reconcile ID of the context, or a new one, for
+// the object until the returned func is called. An object is only synced by
+// one worker at a time.
+func (h *Handler) startReconcile(ctx context.Context, o sdk.Object) func() {
+	key, err := reconcileKey(o)
+	if err != nil {
+		return func() {}
+	}
+	id := logging.ReconcileID(ctx)
+	if id == "" {
+		id = logging.NewReconcileID()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.reconciles == nil {
+		h.reconciles = map[string]string{}
+	}
+	h.reconciles[key] = id
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.reconciles, key)
+	}
+}
+
+// logger returns the logger of the object with the ID of its reconcile in
+// progress.
+func (h *Handler) logger(o sdk.Object) *log.Entry {
+	fields := log.Fields{}
+	switch o := o.(type) {
+	case *v1alpha1.Database:
+		fields[logging.FieldNamespace] = o.Namespace
+		fields[logging.FieldDatabase] = o.Name
+		fields[logging.FieldIdentifier] = dbName(o)
+	case *v1alpha1.DatabaseClaim:
+		fields[logging.FieldNamespace] = o.Namespace
+		fields["claim"] = o.Name
+	case *v1alpha1.DatabaseInstance:
+		fields["instance"] = o.Name
+	}
+	if key, err := reconcileKey(o); err == nil {
+		h.mu.Lock()
+		id, ok := h.reconciles[key]
+		h.mu.Unlock()
+		if ok {
+			fields[logging.FieldReconcileID] = id
+		}
+	}
+	return log.WithFields(fields)
+}
+
+// logRequests logs the AWS requests of every client of the session at debug
+// level, with the input redacted by the log formatter, and adds the
+// operation to failed requests.
+func logRequests(s *session.Session) {
+	s.Handlers.Complete.PushBack(func(r *request.Request) {
+		logger := log.WithFields(log.Fields{
+			logging.FieldOperation:    r.Operation.Name,
+			logging.FieldAWSRequestID: r.RequestID,
+			"duration":                time.Since(r.Time),
+			"retries":                 r.RetryCount,
+			"input":                   r.Params,
+		})
+		if r.Error != nil {
+			r.Error = logging.WithOperation(r.Operation.Name, r.Error)
+			logger.WithError(r.Error).Debug("aws request failed")
+			return
+		}
+		logger.Debug("aws request")
+	})
+}
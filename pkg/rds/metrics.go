@@ -0,0 +1,47 @@
+package rds
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	orphanedInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rds_operator_orphaned_instances",
+		Help: "RDS instances owned by the operator without a matching Database, by namespace.",
+	}, []string{"namespace"})
+
+	orphanedInstancesDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rds_operator_orphaned_instances_deleted_total",
+		Help: "Orphaned RDS instances deleted by the sweeper.",
+	})
+
+	recoveryPoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rds_operator_recovery_point_timestamp_seconds",
+		Help: "Creation time of the latest snapshot copied to a disaster recovery region.",
+	}, []string{"namespace", "name", "region"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rds_operator_instance_cache_lookups_total",
+		Help: "Instance and tag lookups by whether the instance cache answered them.",
+	}, []string{"result"})
+
+	awsRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rds_operator_aws_requests_total",
+		Help: "AWS API requests sent, including retries, by operation.",
+	}, []string{"operation"})
+
+	awsRateLimitWait = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rds_operator_aws_rate_limit_wait_seconds_total",
+		Help: "Time AWS API requests waited for the client-side rate limit.",
+	})
+
+	estimatedMonthlyCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rds_operator_estimated_monthly_cost",
+		Help: "Estimated monthly cost of the created databases in the currency of the pricing table, by namespace.",
+	}, []string{"namespace"})
+)
+
+func init() {
+	prometheus.MustRegister(orphanedInstances, orphanedInstancesDeleted, recoveryPoint, estimatedMonthlyCost,
+		cacheLookups, awsRequests, awsRateLimitWait)
+}
@@ -0,0 +1,72 @@
+package rds
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+)
+
+// deferMonitoring is the reason recorded for monitoring changes deferred by a
+// change freeze.
+const deferMonitoring = "Monitoring"
+
+var monitoringFields = map[string]bool{
+	"performanceInsights":                true,
+	"performanceInsightsRetentionPeriod": true,
+	"monitoringInterval":                 true,
+	"monitoringRoleArn":                  true,
+	"enableCloudwatchLogsExports":        true,
+}
+
+// syncMonitoring applies spec.monitoring to the instance whenever it differs
+// from the configuration last applied, regardless of the drift policy. The
+// applied configuration is recorded in the status so the instance is only
+// described when the spec changes. Removing spec.monitoring turns off
+// everything the last configuration enabled.
+func (h *Handler) syncMonitoring(o *v1alpha1.Database) error {
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return err
+	}
+	// Modifications are rejected while the instance is busy, the next sync
+	// retries.
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return nil
+	}
+
+	var deferred *v1alpha1.DeferredAction
+	if req := monitoringInput(o, db); req != nil {
+		h.logger(o).Info("applying monitoring configuration")
+		deferred, err = h.modify(o, deferMonitoring, req)
+		if err != nil {
+			return err
+		}
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferMonitoring, deferred)
+	if deferred == nil {
+		copy.Status.Monitoring = o.Spec.Monitoring.DeepCopy()
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	return h.sdk.Update(copy)
+}
+
+// monitoringInput returns the modification applying spec.monitoring, or nil
+// if the instance already matches it.
+func monitoringInput(o *v1alpha1.Database, db *rds.DBInstance) *rds.ModifyDBInstanceInput {
+	declared := o.DeepCopy()
+	if declared.Spec.Monitoring == nil {
+		declared.Spec.Monitoring = &v1alpha1.Monitoring{}
+	}
+	v1alpha1.Defaults(declared)
+
+	var changes []v1alpha1.FieldDrift
+	for _, d := range diffSpec(declared.Spec, effective(db)) {
+		if monitoringFields[d.Field] {
+			changes = append(changes, d)
+		}
+	}
+	return modifyFields(declared, db, changes)
+}
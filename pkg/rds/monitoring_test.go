@@ -0,0 +1,139 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitoring_Create(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.Monitoring = &v1alpha1.Monitoring{
+		PerformanceInsights:         true,
+		MonitoringInterval:          60,
+		MonitoringRoleArn:           "arn:aws:iam::123456789012:role/rds-monitoring",
+		EnableCloudwatchLogsExports: []string{"postgresql"},
+	}
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+
+	instance := s.rds.Instance("default-app")
+	require.True(t, aws.BoolValue(instance.PerformanceInsightsEnabled))
+	require.Equal(t, int64(7), aws.Int64Value(instance.PerformanceInsightsRetentionPeriod))
+	require.Equal(t, int64(60), aws.Int64Value(instance.MonitoringInterval))
+	require.Equal(t, []string{"postgresql"}, aws.StringValueSlice(instance.EnabledCloudwatchLogsExports))
+
+	// Created with the configuration, nothing is left to modify.
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+	db = s.sdk.database("app")
+	require.Equal(t, db.Spec.Monitoring, db.Status.Monitoring)
+}
+
+func TestMonitoring_Update(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.Monitoring = &v1alpha1.Monitoring{
+		PerformanceInsights:         true,
+		EnableCloudwatchLogsExports: []string{"postgresql", "upgrade"},
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+	s.rds.Advance(5 * time.Minute)
+
+	instance := s.rds.Instance("default-app")
+	require.True(t, aws.BoolValue(instance.PerformanceInsightsEnabled))
+	require.Equal(t, []string{"postgresql", "upgrade"}, aws.StringValueSlice(instance.EnabledCloudwatchLogsExports))
+	require.Equal(t, db.Spec.Monitoring, s.sdk.database("app").Status.Monitoring)
+
+	// Applied changes are not made again.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+
+	db = s.sdk.database("app")
+	db.Spec.Monitoring = &v1alpha1.Monitoring{
+		MonitoringInterval:          30,
+		MonitoringRoleArn:           "arn:aws:iam::123456789012:role/rds-monitoring",
+		EnableCloudwatchLogsExports: []string{"upgrade"},
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	s.rds.Advance(5 * time.Minute)
+
+	instance = s.rds.Instance("default-app")
+	require.False(t, aws.BoolValue(instance.PerformanceInsightsEnabled))
+	require.Equal(t, int64(30), aws.Int64Value(instance.MonitoringInterval))
+	require.Equal(t, []string{"upgrade"}, aws.StringValueSlice(instance.EnabledCloudwatchLogsExports))
+}
+
+func TestMonitoring_Removed(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.Monitoring = &v1alpha1.Monitoring{
+		PerformanceInsights:         true,
+		MonitoringInterval:          60,
+		MonitoringRoleArn:           "arn:aws:iam::123456789012:role/rds-monitoring",
+		EnableCloudwatchLogsExports: []string{"postgresql"},
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.Equal(t, int64(60), aws.Int64Value(s.rds.Instance("default-app").MonitoringInterval))
+
+	db = s.sdk.database("app")
+	db.Spec.Monitoring = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	s.rds.Advance(5 * time.Minute)
+
+	instance := s.rds.Instance("default-app")
+	require.False(t, aws.BoolValue(instance.PerformanceInsightsEnabled))
+	require.Equal(t, int64(0), aws.Int64Value(instance.MonitoringInterval))
+	require.Empty(t, instance.EnabledCloudwatchLogsExports)
+	require.Nil(t, s.sdk.database("app").Status.Monitoring)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestMonitoring_Drift(t *testing.T) {
+	s := createdScenario(t, "app")
+	db := s.sdk.database("app")
+	db.Spec.Monitoring = &v1alpha1.Monitoring{EnableCloudwatchLogsExports: []string{"postgresql"}}
+	s.apply(db)
+	s.settle("app")
+	s.rds.Advance(5 * time.Minute)
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyReport)
+
+	_, err := s.rds.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("default-app"),
+		CloudwatchLogsExportConfiguration: &rds.CloudwatchLogsExportConfiguration{
+			DisableLogTypes: aws.StringSlice([]string{"postgresql"}),
+		},
+		ApplyImmediately: aws.Bool(true),
+	})
+	require.NoError(t, err)
+	s.rds.Advance(10 * time.Minute)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, []v1alpha1.FieldDrift{
+		{Field: "enableCloudwatchLogsExports", Declared: "postgresql", Actual: ""},
+	}, s.sdk.database("app").Status.Drift)
+}
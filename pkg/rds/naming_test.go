@@ -0,0 +1,65 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/naming"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func setTemplate(t *testing.T, s *scenario, template string) {
+	tmpl, err := naming.Parse(template)
+	require.NoError(t, err)
+	s.h.cfg.Naming = tmpl
+}
+
+func TestInstanceIdentifier_Template(t *testing.T) {
+	s := newScenario(t)
+	s.h.cfg.ClusterID = "prod"
+	setTemplate(t, s, "{cluster}-{namespace}-{name}")
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "prod-default-app", s.sdk.database("app").Status.InstanceIdentifier)
+	require.NotNil(t, s.rds.Instance("prod-default-app"))
+
+	// Changing the template does not rename the instance.
+	setTemplate(t, s, naming.DefaultTemplate)
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	s.settle("app")
+	require.Equal(t, "prod-default-app", s.sdk.database("app").Status.InstanceIdentifier)
+	require.Nil(t, s.rds.Instance("default-app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("prod-default-app").DBInstanceStatus)
+}
+
+func TestInstanceIdentifier_Sanitized(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app.v2"))
+	require.NoError(t, s.sync("app.v2"))
+
+	id := s.sdk.database("app.v2").Status.InstanceIdentifier
+	require.NoError(t, naming.Validate(id))
+	require.NotNil(t, s.rds.Instance(id))
+}
+
+func TestInstanceIdentifier_Legacy(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	// Databases created before the identifier was recorded.
+	db := s.sdk.database("app")
+	db.Status.InstanceIdentifier = ""
+	s.apply(db)
+
+	s.h.cfg.ClusterID = "prod"
+	setTemplate(t, s, "{cluster}-{namespace}-{name}")
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("default-app").DBInstanceStatus)
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+}
@@ -0,0 +1,219 @@
+package rds
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/logging"
+)
+
+// planOnly reports whether AWS calls for the database should be planned
+// instead of executed.
+func (h *Handler) planOnly(o *v1alpha1.Database) bool {
+	return h.cfg.DryRun || o.Annotations[v1alpha1.AnnotationPlanOnly] == "true"
+}
+
+// plan computes the calls a reconcile would make and writes them to the
+// status. Deletions can only be logged since the object is already gone.
+//
+// The plan covers the calls made from the spec alone: creation, drift
+// reverts, tags, monitoring, deletion protection, the native storage limit
+// and the first steps of an engine upgrade. Storage growth depends on the
+// free storage at the time, encryption, replacement, snapshot copies,
+// schedules and actions are workflows where each call depends on the result
+// of the previous one, none of them start in plan mode and they are not
+// planned.
+func (h *Handler) plan(o *v1alpha1.Database, deleted bool) error {
+	if deleted {
+		req := h.deletionInput(o, time.Now())
+		if req == nil {
+			h.logger(o).Info("planned db retention")
+			return nil
+		}
+		action, err := plannedAction("DeleteDBInstance", req)
+		if err != nil {
+			return err
+		}
+		h.logger(o).WithField("plan", action.Input).Info("planned db deletion")
+		return nil
+	}
+
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	if declared.Status.InstanceIdentifier == "" {
+		declared.Status.InstanceIdentifier = h.identifier(declared)
+	}
+
+	db, err := h.getDB(declared)
+	if isTransient(err) {
+		return err
+	}
+
+	var actions []v1alpha1.PlannedAction
+	switch {
+	case err != nil:
+		action, err := plannedAction("CreateDBInstance", createInput(declared, h.tags(declared)))
+		if err != nil {
+			return err
+		}
+		actions = append(actions, action)
+	case db != nil:
+		// Changes to an existing instance are only made by a drift revert.
+		if h.driftPolicy(declared) == v1alpha1.DriftPolicyRevert {
+			revert := revertable(declared, diffSpec(declared.Spec, effective(db)))
+			if req := modifyFields(declared, db, revert); req != nil {
+				action, err := plannedAction("ModifyDBInstance", req)
+				if err != nil {
+					return err
+				}
+				actions = append(actions, action)
+			}
+		}
+		changes, err := h.planChanges(o, db)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, changes...)
+		tagActions, err := h.planTags(declared, db)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, tagActions...)
+	}
+
+	// Created databases keep their state so they are synced as created once
+	// plan mode is turned off.
+	created := o.Status.State == v1alpha1.StateCreated
+	if (created || o.Status.State == v1alpha1.StatePlanned) && reflect.DeepEqual(o.Status.Plan, actions) {
+		return nil
+	}
+
+	h.logger(o).WithField("actions", len(actions)).Debug("set plan")
+
+	copy := o.DeepCopy()
+	if !created {
+		copy.Status.State = v1alpha1.StatePlanned
+		copy.Status.Error = ""
+	}
+	copy.Status.Plan = actions
+	return h.sdk.Update(copy)
+}
+
+// planChanges plans the modifications the sync steps following a spec change
+// would make to an existing instance.
+func (h *Handler) planChanges(o *v1alpha1.Database, db *rds.DBInstance) ([]v1alpha1.PlannedAction, error) {
+	var actions []v1alpha1.PlannedAction
+	add := func(req *rds.ModifyDBInstanceInput) error {
+		action, err := plannedAction("ModifyDBInstance", req)
+		if err == nil {
+			actions = append(actions, action)
+		}
+		return err
+	}
+
+	if !reflect.DeepEqual(o.Spec.Monitoring, o.Status.Monitoring) {
+		if req := monitoringInput(o, db); req != nil {
+			if err := add(req); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if o.Spec.DeletionProtection != o.Status.DeletionProtection {
+		req := &rds.ModifyDBInstanceInput{
+			DBInstanceIdentifier: db.DBInstanceIdentifier,
+			DeletionProtection:   bo(o.Spec.DeletionProtection),
+		}
+		if err := add(req); err != nil {
+			return nil, err
+		}
+	}
+	if nativeMaxStorage(o) != o.Status.MaxAllocatedStorage {
+		if err := add(nativeStorageInput(o, db)); err != nil {
+			return nil, err
+		}
+	}
+
+	upgrade, err := h.planUpgrade(o, db)
+	if err != nil {
+		return nil, err
+	}
+	return append(actions, upgrade...), nil
+}
+
+// planUpgrade plans the snapshot and modification of an engine upgrade. A
+// target that fails validation fails the upgrade without calling AWS, so
+// nothing is planned for it.
+func (h *Handler) planUpgrade(o *v1alpha1.Database, db *rds.DBInstance) ([]v1alpha1.PlannedAction, error) {
+	target, current := o.Spec.EngineVersion, aws.StringValue(db.EngineVersion)
+	if target == "" || sameVersion(target, current) || minorUpgraded(o.Spec, current) {
+		return nil, nil
+	}
+	plan, err := h.validateUpgrade(db, target)
+	if isTransient(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, nil
+	}
+
+	snapshot, err := plannedAction("CreateDBSnapshot", &rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		// The snapshot is named when the upgrade starts.
+		DBSnapshotIdentifier: str(upgradeSnapshotPrefix(aws.StringValue(db.DBInstanceIdentifier), plan.version) +
+			"yyyymmddhhmmss"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	modify, err := plannedAction("ModifyDBInstance", upgradeInput(db, plan))
+	if err != nil {
+		return nil, err
+	}
+	return []v1alpha1.PlannedAction{snapshot, modify}, nil
+}
+
+// planTags plans the tag changes syncTags would make.
+func (h *Handler) planTags(o *v1alpha1.Database, db *rds.DBInstance) ([]v1alpha1.PlannedAction, error) {
+	out, err := h.rds.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: db.DBInstanceArn})
+	if err != nil {
+		return nil, err
+	}
+	add, remove := tagChanges(h.tags(o), o.Status.Tags, out.TagList)
+
+	var actions []v1alpha1.PlannedAction
+	if len(add) > 0 {
+		action, err := plannedAction("AddTagsToResource", &rds.AddTagsToResourceInput{
+			ResourceName: db.DBInstanceArn,
+			Tags:         add,
+		})
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	if len(remove) > 0 {
+		action, err := plannedAction("RemoveTagsFromResource", &rds.RemoveTagsFromResourceInput{
+			ResourceName: db.DBInstanceArn,
+			TagKeys:      remove,
+		})
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// plannedAction renders the request with secrets redacted and unset
+// fields dropped, AWS inputs have no omitempty tags so every nil pointer
+// would otherwise be rendered as null.
+func plannedAction(action string, req interface{}) (v1alpha1.PlannedAction, error) {
+	raw, err := json.Marshal(logging.Redact(req))
+	if err != nil {
+		return v1alpha1.PlannedAction{}, err
+	}
+	return v1alpha1.PlannedAction{Action: action, Input: string(raw)}, nil
+}
@@ -0,0 +1,153 @@
+package rds
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// checkPolicies returns the violations of the policies selecting the
+// database's namespace, nil if there are none. The quotas count the other
+// databases and claimed instances of the namespace, see quota.
+func (h *Handler) checkPolicies(o *v1alpha1.Database) error {
+	if !h.enabled(FeaturePolicies) {
+		return nil
+	}
+	list := &v1alpha1.DatabasePolicyList{TypeMeta: typeMeta("DatabasePolicyList")}
+	if err := h.sdk.List("", list); err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	ns := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: o.Namespace},
+	}
+	if err := h.sdk.Get(ns); err != nil && !k8errors.IsNotFound(err) {
+		return err
+	}
+
+	var others *v1alpha1.DatabaseList
+	var instances *v1alpha1.DatabaseInstanceList
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	spec := declared.Spec
+
+	var violations []string
+	for _, p := range list.Items {
+		if err := v1alpha1.ValidatePolicy(&p); err != nil {
+			violations = append(violations, fmt.Sprintf("invalid databasePolicy %s: %v", p.Name, err))
+			continue
+		}
+		// A nil selector would select nothing.
+		if sel := p.Spec.NamespaceSelector; sel != nil {
+			selector, _ := metav1.LabelSelectorAsSelector(sel)
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		violate := func(format string, args ...interface{}) {
+			violations = append(violations, fmt.Sprintf(format, args...)+" by databasePolicy "+p.Name)
+		}
+
+		if len(p.Spec.Engines) > 0 && !containsString(p.Spec.Engines, spec.Engine) {
+			violate("engine %s is not allowed", spec.Engine)
+		}
+		if len(p.Spec.InstanceClasses) > 0 && !matchAny(p.Spec.InstanceClasses, spec.InstanceClass) {
+			violate("instanceClass %s is not allowed", spec.InstanceClass)
+		}
+		if p.Spec.RequireEncryption && !spec.Encrypted {
+			violate("encryption is required")
+		}
+		if p.Spec.RequireMultiAZ && !spec.MultiAZ {
+			violate("multiAz is required")
+		}
+
+		if p.Spec.MaxInstances == 0 && p.Spec.MaxStorage == 0 {
+			continue
+		}
+		if others == nil {
+			others = &v1alpha1.DatabaseList{TypeMeta: typeMeta("DatabaseList")}
+			if err := h.sdk.List(o.Namespace, others); err != nil {
+				return err
+			}
+			instances = &v1alpha1.DatabaseInstanceList{TypeMeta: typeMeta("DatabaseInstanceList")}
+			if err := h.sdk.List("", instances); err != nil {
+				return err
+			}
+		}
+		count, storage := quota(o, others, instances)
+		count++
+		storage += spec.Storage
+		if max := p.Spec.MaxInstances; max > 0 && count > max {
+			violate("the namespace would have %d databases, %d are allowed", count, max)
+		}
+		if max := p.Spec.MaxStorage; max > 0 && storage > max {
+			violate("the namespace would have %d GiB of storage, %d GiB are allowed", storage, max)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return policyError{strings.Join(violations, "; ")}
+}
+
+// quota counts the instances and storage of the database's namespace
+// without the database itself. Instances bound to the namespace's claims
+// count in the namespace, not in the namespace of the Databases managing
+// them. Failed databases and databases held before creation have no
+// instance.
+func quota(o *v1alpha1.Database, others *v1alpha1.DatabaseList, instances *v1alpha1.DatabaseInstanceList) (count, storage int64) {
+	bound := map[string]bool{}
+	for _, i := range instances.Items {
+		ref := i.Spec.ClaimRef
+		if ref == nil {
+			continue
+		}
+		bound[i.Name] = true
+		// Claims are checked as a database named after the claim.
+		if ref.Namespace != o.Namespace || ref.Name == o.Name {
+			continue
+		}
+		d := &v1alpha1.Database{Spec: i.Spec.Database}
+		v1alpha1.Defaults(d)
+		count++
+		storage += d.Spec.Storage
+	}
+	for _, d := range others.Items {
+		if d.Name == o.Name || d.Status.State == v1alpha1.StateFailure ||
+			d.Status.State == v1alpha1.StatePending && d.Status.Error != "" || bound[d.Labels[labelInstance]] {
+			continue
+		}
+		v1alpha1.Defaults(&d)
+		count++
+		storage += d.Spec.Storage
+	}
+	return count, storage
+}
+
+type policyError struct{ msg string }
+
+func (e policyError) Error() string { return e.msg }
+
+func isPolicyError(err error) bool {
+	_, ok := err.(policyError)
+	return ok
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package rds
+
+import (
+	"testing"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPolicy(name string, spec v1alpha1.DatabasePolicySpec) *v1alpha1.DatabasePolicy {
+	return &v1alpha1.DatabasePolicy{
+		TypeMeta:   typeMeta("DatabasePolicy"),
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       spec,
+	}
+}
+
+func TestPolicy_Rules(t *testing.T) {
+	s := newScenario(t)
+	require.NoError(t, s.sdk.Create(testPolicy("restricted", v1alpha1.DatabasePolicySpec{
+		InstanceClasses:   []string{"db.t2.*"},
+		Engines:           []string{"postgres"},
+		RequireEncryption: true,
+	})))
+
+	db := testDatabase("app")
+	db.Spec.InstanceClass = "db.r5.24xlarge"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	db = s.sdk.database("app")
+	require.Equal(t, v1alpha1.StatePending, db.Status.State)
+	require.Equal(t, "instanceClass db.r5.24xlarge is not allowed by databasePolicy restricted; "+
+		"encryption is required by databasePolicy restricted", db.Status.Error)
+	require.Len(t, events(s, "PolicyViolation"), 1)
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+
+	db.Spec.InstanceClass = "db.t2.small"
+	db.Spec.Encrypted = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+	require.Empty(t, s.sdk.database("app").Status.Error)
+}
+
+func TestPolicy_Quota(t *testing.T) {
+	s := createdScenario(t, "one", "two")
+	require.NoError(t, s.sdk.Create(testPolicy("quota", v1alpha1.DatabasePolicySpec{
+		MaxInstances: 3,
+		MaxStorage:   60,
+	})))
+
+	db := testDatabase("three")
+	db.Spec.Storage = 100
+	s.apply(db)
+	require.NoError(t, s.sync("three"))
+	require.Equal(t, "the namespace would have 140 GiB of storage, 60 GiB are allowed by databasePolicy quota",
+		s.sdk.database("three").Status.Error)
+
+	s.apply(testDatabase("three"))
+	require.NoError(t, s.sync("three"))
+	require.Equal(t, 3, s.rds.Calls("CreateDBInstance"))
+
+	s.apply(testDatabase("four"))
+	require.NoError(t, s.sync("four"))
+	require.Contains(t, s.sdk.database("four").Status.Error, "would have 4 databases, 3 are allowed")
+}
+
+func TestPolicy_NamespaceSelector(t *testing.T) {
+	s := newScenario(t)
+	require.NoError(t, s.sdk.Create(testPolicy("payments", v1alpha1.DatabasePolicySpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+		RequireMultiAZ:    true,
+	})))
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+
+	require.NoError(t, s.sdk.Create(&corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "payments"}},
+	}))
+	s.apply(testDatabase("other"))
+	require.NoError(t, s.sync("other"))
+	require.Equal(t, "multiAz is required by databasePolicy payments", s.sdk.database("other").Status.Error)
+}
+
+func TestPolicy_Claims(t *testing.T) {
+	s := newClaimScenario(t)
+	class := testClass("large-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.r5.4xlarge"})
+	require.NoError(t, s.sdk.Create(class))
+	require.NoError(t, s.sdk.Create(testPolicy("small", v1alpha1.DatabasePolicySpec{
+		InstanceClasses: []string{"db.t2.*"},
+	})))
+
+	require.NoError(t, s.sdk.Create(testClaim("app", v1alpha1.DatabaseClaimSpec{ClassName: "large-postgres"})))
+	s.handle("DatabaseClaim/default/app")
+	s.handle("DatabaseClaim/default/app")
+	c := claim(s, "app")
+	require.Equal(t, v1alpha1.ClaimPhasePending, c.Status.Phase)
+	require.Equal(t, "instanceClass db.r5.4xlarge is not allowed by databasePolicy small", c.Status.Message)
+	require.Len(t, events(s, "PolicyViolation"), 1)
+	require.Nil(t, instance(s, "default-app"))
+}
+
+func TestPolicy_QuotaCountsClaims(t *testing.T) {
+	s := newClaimScenario(t)
+	class := testClass("small-postgres", v1alpha1.DatabaseSpec{InstanceClass: "db.t2.small"})
+	require.NoError(t, s.sdk.Create(class))
+	require.NoError(t, s.sdk.Create(testPolicy("quota", v1alpha1.DatabasePolicySpec{MaxInstances: 1})))
+
+	require.NoError(t, s.sdk.Create(testClaim("one", v1alpha1.DatabaseClaimSpec{ClassName: "small-postgres"})))
+	s.handle("DatabaseClaim/default/one")
+	require.Equal(t, v1alpha1.ClaimPhaseBound, claim(s, "one").Status.Phase)
+
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "the namespace would have 2 databases, 1 are allowed by databasePolicy quota",
+		s.sdk.database("app").Status.Error)
+}
+
+func TestPolicy_QuotaSkipsHeld(t *testing.T) {
+	s := newScenario(t)
+	require.NoError(t, s.sdk.Create(testPolicy("quota", v1alpha1.DatabasePolicySpec{
+		MaxInstances: 1,
+		Engines:      []string{"postgres"},
+	})))
+
+	// A database held by a policy has no instance.
+	held := testDatabase("held")
+	held.Spec.Engine = "mysql"
+	s.apply(held)
+	require.NoError(t, s.sync("held"))
+	require.Equal(t, "engine mysql is not allowed by databasePolicy quota", s.sdk.database("held").Status.Error)
+
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	require.Empty(t, s.sdk.database("app").Status.Error)
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+}
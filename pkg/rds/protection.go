@@ -0,0 +1,112 @@
+package rds
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// deferDeletionProtection is the reason recorded for deletion protection
+// changes deferred by a change freeze.
+const deferDeletionProtection = "DeletionProtection"
+
+// syncDeletionProtection applies spec.deletionProtection whenever it differs
+// from the value last applied, regardless of the drift policy.
+func (h *Handler) syncDeletionProtection(o *v1alpha1.Database) error {
+	deferred, err := h.setDeletionProtection(o, deferDeletionProtection, o.Spec.DeletionProtection)
+	if err != nil {
+		return err
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferDeletionProtection, deferred)
+	if deferred == nil {
+		copy.Status.DeletionProtection = o.Spec.DeletionProtection
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) setDeletionProtection(o *v1alpha1.Database, reason string, enabled bool) (*v1alpha1.DeferredAction, error) {
+	h.logger(o).WithField("enabled", enabled).Info("setting deletion protection")
+	return h.modify(o, reason, &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: str(dbName(o)),
+		DeletionProtection:   bo(enabled),
+	})
+}
+
+// unprotect turns off deletion protection on the instance before the
+// operator retires it in favour of a new instance. During a change freeze
+// the modification is deferred under the reason of the caller, which holds
+// the deletion back until it is applied.
+func (h *Handler) unprotect(o *v1alpha1.Database, reason string) (*v1alpha1.DeferredAction, error) {
+	if !o.Status.DeletionProtection {
+		return nil, nil
+	}
+	deferred, err := h.setDeletionProtection(o, reason, false)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return deferred, err
+}
+
+func protected(o *v1alpha1.Database) bool {
+	return o.Annotations[v1alpha1.AnnotationProtected] == "true"
+}
+
+func hasFinalizer(o *v1alpha1.Database) bool {
+	return containsString(o.Finalizers, v1alpha1.FinalizerProtection)
+}
+
+// syncFinalizer adds the protection finalizer to protected databases and
+// removes it once the annotation is removed.
+func (h *Handler) syncFinalizer(o *v1alpha1.Database) error {
+	copy := o.DeepCopy()
+	copy.Finalizers = nil
+	for _, f := range o.Finalizers {
+		if f != v1alpha1.FinalizerProtection {
+			copy.Finalizers = append(copy.Finalizers, f)
+		}
+	}
+	if protected(o) {
+		copy.Finalizers = append(copy.Finalizers, v1alpha1.FinalizerProtection)
+	}
+	h.logger(o).WithField("protected", protected(o)).Debug("syncing finalizer")
+	return h.sdk.Update(copy)
+}
+
+// finalize handles a database marked for deletion. While the database is
+// annotated as protected the deletion is held with the DeletionBlocked
+// condition, once the annotation is removed the instance is deleted and the
+// finalizer released.
+func (h *Handler) finalize(o *v1alpha1.Database) error {
+	if !hasFinalizer(o) {
+		return nil
+	}
+	if protected(o) {
+		cond := v1alpha1.DatabaseCondition{
+			Type:    v1alpha1.ConditionDeletionBlocked,
+			Status:  corev1.ConditionTrue,
+			Reason:  "Protected",
+			Message: "remove the " + v1alpha1.AnnotationProtected + " annotation to delete the database",
+		}
+		conditions, changed := setCondition(o.Status.Conditions, cond, time.Now())
+		if !changed {
+			return nil
+		}
+		h.logger(o).Warn("deletion of protected database blocked")
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "DeletionBlocked",
+			"Deletion is blocked, "+cond.Message)
+
+		copy := o.DeepCopy()
+		copy.Status.Conditions = conditions
+		return h.sdk.Update(copy)
+	}
+
+	if err := h.delete(o); err != nil {
+		return err
+	}
+	return h.syncFinalizer(o)
+}
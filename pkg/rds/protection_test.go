@@ -0,0 +1,117 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeletionProtection_Spec(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.DeletionProtection = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.True(t, s.rds.DeletionProtection("default-app"))
+
+	s.rds.Advance(10 * time.Minute)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+	require.True(t, s.sdk.database("app").Status.DeletionProtection)
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Len(t, events(s, "InstanceKept"), 1)
+	require.NotNil(t, s.rds.Instance("default-app"))
+
+	db = s.sdk.database("app")
+	db.Spec.DeletionProtection = false
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.False(t, s.rds.DeletionProtection("default-app"))
+	require.False(t, s.sdk.database("app").Status.DeletionProtection)
+
+	require.NoError(t, s.remove("app"))
+	s.rds.Advance(3 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+}
+
+func TestDeletionProtection_Freeze(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+	setFreeze(s, time.Now().Add(time.Hour), "")
+
+	db := s.sdk.database("app")
+	db.Spec.DeletionProtection = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	require.False(t, s.rds.DeletionProtection("default-app"))
+
+	db = s.sdk.database("app")
+	require.False(t, db.Status.DeletionProtection)
+	require.Len(t, db.Status.Deferred, 1)
+	require.Equal(t, "DeletionProtection", db.Status.Deferred[0].Reason)
+	require.Contains(t, db.Status.Deferred[0].Input, `"DeletionProtection":true`)
+
+	setFreeze(s, time.Now().Add(-time.Minute), "")
+	require.NoError(t, s.sync("app"))
+	require.True(t, s.rds.DeletionProtection("default-app"))
+	db = s.sdk.database("app")
+	require.True(t, db.Status.DeletionProtection)
+	require.Empty(t, db.Status.Deferred)
+}
+
+func TestDeletionProtection_Finalizer(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationProtected: "true"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, []string{v1alpha1.FinalizerProtection}, s.sdk.database("app").Finalizers)
+
+	// kubectl delete only marks a database with finalizers for deletion.
+	db = s.sdk.database("app")
+	now := metav1.Now()
+	db.DeletionTimestamp = &now
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Len(t, events(s, "DeletionBlocked"), 1)
+
+	db = s.sdk.database("app")
+	require.Equal(t, v1alpha1.ConditionDeletionBlocked, db.Status.Conditions[0].Type)
+	db.Annotations = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("DeleteDBInstance"))
+	require.Empty(t, s.sdk.database("app").Finalizers)
+
+	// The deletion event follows once the finalizer is released.
+	require.NoError(t, s.remove("app"))
+	s.rds.Advance(3 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+}
+
+func TestDeletionProtection_Unannotated(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationProtected: "true"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+
+	db = s.sdk.database("app")
+	db.Annotations = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Empty(t, s.sdk.database("app").Finalizers)
+}
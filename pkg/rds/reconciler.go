@@ -0,0 +1,224 @@
+package rds
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/logging"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	log "github.com/sirupsen/logrus"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ReconcilerConfig configures the reconciler.
+type ReconcilerConfig struct {
+	// Workers is the number of objects synced concurrently.
+	Workers int
+	// ProvisioningInterval requeues objects being created or changed,
+	// StableInterval all others.
+	ProvisioningInterval time.Duration
+	StableInterval       time.Duration
+	// RetryBaseDelay and RetryMaxDelay bound the exponential requeue of an
+	// object after failed syncs.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// Reconciler queues the watch events by object and syncs them with the
+// handler from a pool of workers. An object is never synced by two workers
+// at once, events arriving while it is queued are merged. Objects are
+// requeued after each sync, failed syncs back off exponentially.
+type Reconciler struct {
+	h     *Handler
+	cfg   ReconcilerConfig
+	queue workqueue.RateLimitingInterface
+
+	// syncing is held by the workers while they sync and by Reconfigure
+	// while it replaces the config.
+	syncing sync.RWMutex
+
+	mu sync.Mutex
+	// events are the latest event of each queued object.
+	events map[string]sdk.Event
+}
+
+// NewReconciler returns a reconciler syncing objects with the handler.
+func NewReconciler(handler *Handler, cfg ReconcilerConfig) *Reconciler {
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(cfg.RetryBaseDelay, cfg.RetryMaxDelay)
+	return &Reconciler{
+		h:      handler,
+		cfg:    cfg,
+		queue:  workqueue.NewNamedRateLimitingQueue(limiter, "rds-operator"),
+		events: map[string]sdk.Event{},
+	}
+}
+
+// Handle queues the event, it implements sdk.Handler.
+func (r *Reconciler) Handle(ctx context.Context, event sdk.Event) error {
+	key, err := eventKey(event)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.events[key] = event
+	r.mu.Unlock()
+	r.queue.Add(key)
+	return nil
+}
+
+// Reconfigure waits for the syncs in progress, then replaces the handler
+// config and the requeue intervals. The workers and retry delays are kept.
+func (r *Reconciler) Reconfigure(cfg Config, rc ReconcilerConfig) {
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+	r.h.cfg = cfg
+	r.cfg.ProvisioningInterval = rc.ProvisioningInterval
+	r.cfg.StableInterval = rc.StableInterval
+}
+
+// Run syncs queued objects until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	log.WithField("workers", r.cfg.Workers).Info("starting reconciler")
+	var wg sync.WaitGroup
+	for n := 0; n < r.cfg.Workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.processNext(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	r.queue.ShutDown()
+	wg.Wait()
+}
+
+// processNext syncs the next queued object, it returns false once the queue
+// is shut down.
+func (r *Reconciler) processNext(ctx context.Context) bool {
+	item, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(item)
+	key := item.(string)
+
+	r.mu.Lock()
+	event, ok := r.events[key]
+	r.mu.Unlock()
+	if !ok {
+		r.queue.Forget(key)
+		return true
+	}
+
+	if !event.Deleted {
+		latest, err := r.latest(event.Object)
+		if k8errors.IsNotFound(err) {
+			// The object is gone, the deletion event syncs it.
+			r.queue.Forget(key)
+			return true
+		}
+		if err != nil {
+			log.WithError(err).WithField("key", key).Warn("failed reading object, retrying")
+			r.queue.AddRateLimited(key)
+			return true
+		}
+		event.Object = latest
+	}
+
+	id := logging.NewReconcileID()
+	r.syncing.RLock()
+	defer r.syncing.RUnlock()
+	if err := r.sync(logging.WithReconcileID(ctx, id), event); err != nil {
+		log.WithError(err).WithField("key", key).
+			WithField(logging.FieldReconcileID, id).
+			WithField("retries", r.queue.NumRequeues(key)).
+			Warn("sync failed, retrying")
+		r.queue.AddRateLimited(key)
+		return true
+	}
+	r.queue.Forget(key)
+
+	if event.Deleted {
+		r.mu.Lock()
+		// A newer event may have replaced the deletion.
+		if latest := r.events[key]; latest.Deleted && latest.Object == event.Object {
+			delete(r.events, key)
+		}
+		r.mu.Unlock()
+		return true
+	}
+	r.queue.AddAfter(key, r.requeueAfter(event.Object))
+	return true
+}
+
+// latest reads the current version of the object. Queued events may be
+// older than the changes made by the last sync of the object, and the watch
+// does not expose its cache, so the object is read again before each sync.
+func (r *Reconciler) latest(o sdk.Object) (sdk.Object, error) {
+	latest := o.DeepCopyObject().(sdk.Object)
+	if err := r.h.sdk.Get(latest); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// sync handles the event, a panic fails the sync so the object is retried
+// instead of stopping the worker.
+func (r *Reconciler) sync(ctx context.Context, event sdk.Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.WithField(logging.FieldReconcileID, logging.ReconcileID(ctx)).
+				WithField("panic", p).
+				WithField("stack", string(debug.Stack())).
+				Error("sync panicked")
+			err = fmt.Errorf("sync panicked: %v", p)
+		}
+	}()
+	return r.h.Handle(ctx, event)
+}
+
+// requeueAfter is short while an object is being created or changed and
+// long once it is stable.
+func (r *Reconciler) requeueAfter(o sdk.Object) time.Duration {
+	provisioning := false
+	switch o := o.(type) {
+	case *v1alpha1.Database:
+		s := o.Status
+		_, action := o.Annotations[v1alpha1.AnnotationAction]
+		provisioning = s.State == "" ||
+			(s.State == v1alpha1.StatePending && s.Error == "") ||
+			(s.State == v1alpha1.StateCreated && (action ||
+				(s.Upgrade != nil && inProgress(s.Upgrade.Phase)) ||
+				(s.Encryption != nil && inProgress(s.Encryption.Phase)) ||
+				(s.Replacement != nil && inProgress(s.Replacement.Phase))))
+	case *v1alpha1.DatabaseClaim:
+		provisioning = o.Status.Phase == "" || o.Status.Phase == v1alpha1.ClaimPhasePending
+	case *v1alpha1.DatabaseInstance:
+		provisioning = o.Status.Phase == "" || o.Status.Phase == v1alpha1.InstancePhaseRecycling
+	}
+	if provisioning {
+		return r.cfg.ProvisioningInterval
+	}
+	return r.cfg.StableInterval
+}
+
+// inProgress reports whether an upgrade, encryption or replacement phase
+// waits on AWS rather than on a person or a bake period.
+func inProgress(phase string) bool {
+	switch phase {
+	case v1alpha1.UpgradePhaseSnapshotting, v1alpha1.UpgradePhaseUpgrading,
+		v1alpha1.EncryptionPhaseCopying, v1alpha1.EncryptionPhaseRestoring,
+		v1alpha1.EncryptionPhaseRetiring, v1alpha1.EncryptionPhaseRenaming,
+		v1alpha1.ReplacementPhaseProvisioning, v1alpha1.ReplacementPhasePromoting:
+		return true
+	}
+	return false
+}
+
+func eventKey(event sdk.Event) (string, error) { return reconcileKey(event.Object) }
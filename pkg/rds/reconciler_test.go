@@ -0,0 +1,168 @@
+package rds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/require"
+)
+
+func reconciler(s *scenario) *Reconciler {
+	return NewReconciler(s.h, ReconcilerConfig{
+		ProvisioningInterval: time.Millisecond,
+		StableInterval:       time.Hour,
+		RetryBaseDelay:       time.Millisecond,
+		RetryMaxDelay:        time.Millisecond,
+	})
+}
+
+// watch queues the latest version of the database like the watch does.
+func watch(t *testing.T, r *Reconciler, s *scenario, name string) {
+	require.NoError(t, r.Handle(context.Background(), sdk.Event{Object: s.sdk.database(name)}))
+}
+
+func TestReconciler_MergesEvents(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	r := reconciler(s)
+
+	watch(t, r, s, "app")
+	watch(t, r, s, "app")
+	require.Equal(t, 1, r.queue.Len())
+
+	require.True(t, r.processNext(context.Background()))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+}
+
+func TestReconciler_RetriesWithBackoff(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	r := reconciler(s)
+	s.rds.Fail("CreateDBInstance", fake.Throttling(), 1)
+
+	watch(t, r, s, "app")
+	require.True(t, r.processNext(context.Background()))
+	key, err := eventKey(sdk.Event{Object: s.sdk.database("app")})
+	require.NoError(t, err)
+	require.Equal(t, 1, r.queue.NumRequeues(key))
+
+	// The retry runs once the backoff expires.
+	watch(t, r, s, "app")
+	require.True(t, r.processNext(context.Background()))
+	require.Equal(t, 0, r.queue.NumRequeues(key))
+	require.NotNil(t, s.rds.Instance("default-app"))
+}
+
+func TestReconciler_RecoversPanics(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	r := reconciler(s)
+	client := s.h.rds
+	s.h.rds = nil
+
+	watch(t, r, s, "app")
+	require.True(t, r.processNext(context.Background()))
+	key, err := eventKey(sdk.Event{Object: s.sdk.database("app")})
+	require.NoError(t, err)
+	require.Equal(t, 1, r.queue.NumRequeues(key))
+
+	s.h.rds = client
+	require.True(t, r.processNext(context.Background()))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+}
+
+func TestReconciler_ReadsLatest(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	r := reconciler(s)
+	watch(t, r, s, "app")
+
+	// The database changed after the event was queued.
+	db := s.sdk.database("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationPlanOnly: "true"}
+	s.apply(db)
+	require.True(t, r.processNext(context.Background()))
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+	require.Equal(t, v1alpha1.StatePlanned, s.sdk.database("app").Status.State)
+
+	// Deleted objects are left to the deletion event.
+	s.sdk.delete(s.sdk.database("app"))
+	require.NoError(t, r.Handle(context.Background(), sdk.Event{Object: db}))
+	require.True(t, r.processNext(context.Background()))
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+}
+
+func TestReconciler_Requeues(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	r := reconciler(s)
+
+	watch(t, r, s, "app")
+	require.True(t, r.processNext(context.Background()))
+	s.rds.Advance(10 * time.Minute)
+
+	// Provisioning databases come back without a new event.
+	require.True(t, r.processNext(context.Background()))
+	require.NotNil(t, s.sdk.secret("app-db-credentials"))
+}
+
+func TestReconciler_ForgetsDeleted(t *testing.T) {
+	s := createdScenario(t, "app")
+	r := reconciler(s)
+
+	require.NoError(t, r.Handle(context.Background(), sdk.Event{Object: s.sdk.database("app"), Deleted: true}))
+	require.True(t, r.processNext(context.Background()))
+	require.Empty(t, r.events)
+	require.Equal(t, 0, r.queue.Len())
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("default-app").DBInstanceStatus)
+}
+
+func TestReconciler_RequeueAfter(t *testing.T) {
+	r := reconciler(newScenario(t))
+	boundInstance := testInstance("app", 20, v1alpha1.ReclaimRetain)
+	boundInstance.Status.Phase = v1alpha1.InstancePhaseBound
+	db := func(status v1alpha1.DatabaseStatus, annotations map[string]string) *v1alpha1.Database {
+		o := testDatabase("app")
+		o.Status = status
+		o.Annotations = annotations
+		return o
+	}
+	for _, test := range []struct {
+		name     string
+		object   sdk.Object
+		expected time.Duration
+	}{
+		{"New", db(v1alpha1.DatabaseStatus{}, nil), time.Millisecond},
+		{"Creating", db(v1alpha1.DatabaseStatus{State: v1alpha1.StatePending}, nil), time.Millisecond},
+		{"Held", db(v1alpha1.DatabaseStatus{State: v1alpha1.StatePending, Error: "class missing"}, nil), time.Hour},
+		{"Created", db(v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated}, nil), time.Hour},
+		{"Action", db(v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated},
+			map[string]string{v1alpha1.AnnotationAction: v1alpha1.ActionReboot}), time.Millisecond},
+		{"Upgrading", db(v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated,
+			Upgrade: &v1alpha1.UpgradeStatus{Phase: v1alpha1.UpgradePhaseUpgrading}}, nil), time.Millisecond},
+		{"AwaitingConfirmation", db(v1alpha1.DatabaseStatus{State: v1alpha1.StateCreated,
+			Encryption: &v1alpha1.EncryptionStatus{Phase: v1alpha1.EncryptionPhaseAwaitingConfirmation}}, nil), time.Hour},
+		{"PendingClaim", testClaim("app", v1alpha1.DatabaseClaimSpec{}), time.Millisecond},
+		{"BoundInstance", boundInstance, time.Hour},
+	} {
+		require.Equal(t, test.expected, r.requeueAfter(test.object), test.name)
+	}
+}
+
+func TestReconciler_Reconfigure(t *testing.T) {
+	s := newScenario(t)
+	r := reconciler(s)
+
+	cfg := s.h.cfg
+	cfg.DeletionPolicy = v1alpha1.DeletionPolicyRetain
+	r.Reconfigure(cfg, ReconcilerConfig{Workers: 8, ProvisioningInterval: time.Second, StableInterval: time.Minute})
+	require.Equal(t, v1alpha1.DeletionPolicyRetain, s.h.cfg.DeletionPolicy)
+	require.Equal(t, time.Second, r.requeueAfter(testInstance("app", 20, v1alpha1.ReclaimRetain)))
+	// Workers are only started once.
+	require.Equal(t, 0, r.cfg.Workers)
+}
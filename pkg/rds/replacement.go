@@ -0,0 +1,396 @@
+package rds
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deferReplacement is the reason recorded when the final step of a
+// replacement is deferred by a change freeze.
+const deferReplacement = "Replacement"
+
+const checkReplacement = "replacement"
+
+// replace makes spec changes RDS cannot apply in place by replacing the
+// instance. With the BlueGreen strategy a new instance is restored from a
+// snapshot, or promoted from a read replica when only the storage type
+// changes, and the secret is switched to it once available. The old instance
+// is kept for the bake period and then deleted with a final snapshot, after
+// which the new instance takes over its identifier. With the None strategy
+// the required replacement is only reported. Each step is recorded in
+// status.replacement, handled is false when there is nothing to do.
+func (h *Handler) replace(o *v1alpha1.Database) (handled bool, err error) {
+	r := o.Status.Replacement
+	if r != nil {
+		r = r.DeepCopy()
+		switch r.Phase {
+		case v1alpha1.ReplacementPhaseSnapshotting:
+			return true, h.provisionReplacement(o, r)
+		case v1alpha1.ReplacementPhaseProvisioning:
+			return true, h.promoteReplacement(o, r)
+		case v1alpha1.ReplacementPhasePromoting:
+			return true, h.switchReplacement(o, r)
+		case v1alpha1.ReplacementPhaseBaking:
+			return true, h.retireReplaced(o, r)
+		case v1alpha1.ReplacementPhaseRetiring:
+			return true, h.renameReplacement(o, r)
+		case v1alpha1.ReplacementPhaseRenaming:
+			return true, h.finishReplacement(o, r)
+		}
+	}
+
+	// Spec changes are only made in place with the Revert drift policy,
+	// without a strategy replacements are looked for on the same terms.
+	if o.Spec.Replacement == nil && h.driftPolicy(o) == v1alpha1.DriftPolicyIgnore {
+		return false, nil
+	}
+	now := time.Now()
+	if !h.due(checkReplacement, o, h.cfg.DriftInterval, now) {
+		return false, nil
+	}
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return false, err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return false, nil
+	}
+
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	changes, err := h.replacementChanges(declared.Spec, db)
+	if err != nil {
+		return false, err
+	}
+	h.markChecked(checkReplacement, o, now)
+	blueGreen := declared.Spec.Replacement != nil &&
+		declared.Spec.Replacement.Strategy == v1alpha1.ReplacementStrategyBlueGreen
+
+	if len(changes) == 0 {
+		if r == nil || r.Phase != v1alpha1.ReplacementPhaseRequired && r.Phase != v1alpha1.ReplacementPhaseFailed {
+			return false, nil
+		}
+		// The spec was reverted.
+		copy := o.DeepCopy()
+		copy.Status.Replacement = nil
+		return true, h.sdk.Update(copy)
+	}
+	if r != nil && r.Phase != v1alpha1.ReplacementPhaseCompleted && reflect.DeepEqual(r.Changes, changes) &&
+		(r.Phase == v1alpha1.ReplacementPhaseFailed || !blueGreen) {
+		return false, nil
+	}
+
+	r = &v1alpha1.ReplacementStatus{Changes: changes}
+	if containsString(changes, "characterSetName") {
+		return true, h.replacementFailed(o, r, "characterSetName cannot be changed by restoring a snapshot or "+
+			"promoting a replica, migrate the data to a new database")
+	}
+	if !blueGreen {
+		r.Phase = v1alpha1.ReplacementPhaseRequired
+		r.Message = fmt.Sprintf("%s cannot be changed in place, set spec.replacement.strategy to %s to replace the instance",
+			strings.Join(changes, ", "), v1alpha1.ReplacementStrategyBlueGreen)
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "ReplacementRequired",
+			"The "+r.Message)
+		return true, h.setReplacement(o, r)
+	}
+	// The replacement keeps its bake period if spec.replacement changes or
+	// is removed while it runs.
+	r.BakePeriod = declared.Spec.Replacement.BakePeriod
+	return true, h.startReplacement(o, db, r)
+}
+
+// replacementChanges lists the spec fields that differ from the instance and
+// can only be changed by replacing it.
+func (h *Handler) replacementChanges(spec v1alpha1.DatabaseSpec, db *rds.DBInstance) ([]string, error) {
+	var changes []string
+	if spec.CharacterSetName != "" && spec.CharacterSetName != aws.StringValue(db.CharacterSetName) {
+		changes = append(changes, "characterSetName")
+	}
+	if g := db.DBSubnetGroup; spec.SubnetGroup != "" && g != nil && spec.SubnetGroup != aws.StringValue(g.DBSubnetGroupName) {
+		out, err := h.rds.DescribeDBSubnetGroups(&rds.DescribeDBSubnetGroupsInput{
+			DBSubnetGroupName: str(spec.SubnetGroup),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(out.DBSubnetGroups) > 0 {
+			vpc := aws.StringValue(out.DBSubnetGroups[0].VpcId)
+			if vpc != "" && aws.StringValue(g.VpcId) != "" && vpc != aws.StringValue(g.VpcId) {
+				changes = append(changes, "subnetGroup")
+			}
+		}
+	}
+	// Storage can be converted to SSD in place but not back to magnetic.
+	if spec.StorageType == "standard" && aws.StringValue(effective(db).StorageType) != "standard" {
+		changes = append(changes, "storageType")
+	}
+	return changes, nil
+}
+
+func (h *Handler) startReplacement(o *v1alpha1.Database, db *rds.DBInstance, r *v1alpha1.ReplacementStatus) error {
+	id := aws.StringValue(db.DBInstanceIdentifier)
+	logger := h.logger(o).WithField("changes", strings.Join(r.Changes, ","))
+
+	// A replica keeps replicating until it is promoted, it can only differ
+	// from its source in the storage type.
+	if reflect.DeepEqual(r.Changes, []string{"storageType"}) {
+		declared := o.DeepCopy()
+		v1alpha1.Defaults(declared)
+		r.Method = v1alpha1.ReplacementMethodReplica
+		r.Instance = naming.Suffix(id, "-replacement")
+		logger.WithField("instance", r.Instance).Info("starting replacement from a read replica")
+
+		_, err := h.rds.CreateDBInstanceReadReplica(&rds.CreateDBInstanceReadReplicaInput{
+			DBInstanceIdentifier:       str(r.Instance),
+			SourceDBInstanceIdentifier: str(id),
+			DBInstanceClass:            str(declared.Spec.InstanceClass),
+			AvailabilityZone:           str(declared.Spec.AvailabilityZone),
+			StorageType:                str(declared.Spec.StorageType),
+			Iops:                       i64(declared.Spec.Iops),
+			Tags:                       tagList(h.tags(o)),
+		})
+		if err != nil && !isAlreadyExists(err) {
+			if isTransient(err) {
+				return err
+			}
+			return h.replacementFailed(o, r, err.Error())
+		}
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "ReplacementStarted",
+			fmt.Sprintf("Replacing instance %s with read replica %s to change %s",
+				id, r.Instance, strings.Join(r.Changes, ", ")))
+		r.Phase = v1alpha1.ReplacementPhaseProvisioning
+		return h.setReplacement(o, r)
+	}
+
+	r.Method = v1alpha1.ReplacementMethodSnapshot
+	r.Snapshot = replacementSnapshotName(id, time.Now())
+	logger.WithField("snapshot", r.Snapshot).Info("starting replacement from a snapshot")
+
+	_, err := h.rds.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: str(id),
+		DBSnapshotIdentifier: str(r.Snapshot),
+	})
+	if err != nil {
+		return err
+	}
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "ReplacementStarted",
+		fmt.Sprintf("Replacing instance %s from snapshot %s to change %s, writes after the snapshot are not migrated",
+			id, r.Snapshot, strings.Join(r.Changes, ", ")))
+	r.Phase = v1alpha1.ReplacementPhaseSnapshotting
+	return h.setReplacement(o, r)
+}
+
+func (h *Handler) provisionReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	if ok, err := h.snapshotAvailable(r.Snapshot); !ok || err != nil {
+		return err
+	}
+
+	r.Instance = naming.Suffix(dbName(o), "-replacement")
+	_, err := h.rds.RestoreDBInstanceFromDBSnapshot(h.restoreInput(o, r.Instance, r.Snapshot))
+	if err != nil && !isAlreadyExists(err) {
+		if isTransient(err) {
+			return err
+		}
+		return h.replacementFailed(o, r, err.Error())
+	}
+
+	r.Phase = v1alpha1.ReplacementPhaseProvisioning
+	return h.setReplacement(o, r)
+}
+
+// promoteReplacement promotes the read replica once it caught up, restored
+// instances move on to the switch right away.
+func (h *Handler) promoteReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	if r.Method != v1alpha1.ReplacementMethodReplica {
+		r.Phase = v1alpha1.ReplacementPhasePromoting
+		return h.switchReplacement(o, r)
+	}
+	db, err := h.describeInstance(r.Instance)
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return nil
+	}
+
+	h.logger(o).WithField("instance", r.Instance).Info("promoting read replica")
+	_, err = h.rds.PromoteReadReplica(&rds.PromoteReadReplicaInput{
+		DBInstanceIdentifier:  str(r.Instance),
+		BackupRetentionPeriod: i64(o.Spec.BackupRetentionPeriod),
+	})
+	if err != nil {
+		if isTransient(err) {
+			return err
+		}
+		return h.replacementFailed(o, r, err.Error())
+	}
+	r.Phase = v1alpha1.ReplacementPhasePromoting
+	return h.setReplacement(o, r)
+}
+
+// switchReplacement points the secret at the new instance once it is
+// available, the old instance is kept until the bake period ends.
+func (h *Handler) switchReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	db, err := h.describeInstance(r.Instance)
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" || db.Endpoint == nil ||
+		db.ReadReplicaSourceDBInstanceIdentifier != nil {
+		return nil
+	}
+	if err := h.sdk.Update(h.createSecret(o, db)); err != nil {
+		return err
+	}
+
+	until := metav1.NewTime(time.Now().Add(bakePeriod(o, r)))
+	r.Phase = v1alpha1.ReplacementPhaseBaking
+	r.BakeUntil = &until
+	r.Message = fmt.Sprintf("the secret points at new instance %s, instance %s is deleted after %s",
+		r.Instance, dbName(o), until.UTC().Format(time.RFC3339))
+	h.logger(o).WithField("instance", r.Instance).Info("replacement instance is available")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "ReplacementReady",
+		"The "+r.Message)
+	return h.setReplacement(o, r)
+}
+
+// bakePeriod returns the bake period of the replacement. Replacements
+// started without one in their status use the spec or its default.
+func bakePeriod(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) time.Duration {
+	if r.BakePeriod != nil {
+		return r.BakePeriod.Duration
+	}
+	declared := o.DeepCopy()
+	if declared.Spec.Replacement == nil {
+		declared.Spec.Replacement = &v1alpha1.Replacement{}
+	}
+	v1alpha1.Defaults(declared)
+	return declared.Spec.Replacement.BakePeriod.Duration
+}
+
+func (h *Handler) retireReplaced(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	if r.BakeUntil != nil && time.Now().Before(r.BakeUntil.Time) {
+		return nil
+	}
+
+	deferred, err := h.unprotect(o, deferReplacement)
+	if err != nil {
+		return err
+	}
+	if deferred == nil {
+		h.logger(o).Info("deleting replaced instance")
+		_, err = h.rds.DeleteDBInstance(deleteInput(o, time.Now()))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		r.Phase = v1alpha1.ReplacementPhaseRetiring
+		r.Message = ""
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferReplacement, deferred)
+	if deferred != nil && sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	copy.Status.Replacement = r
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) renameReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	renamed, deferred, err := h.takeOver(o, r.Instance, deferReplacement)
+	if err != nil || !renamed && deferred == nil {
+		return err
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferReplacement, deferred)
+	if renamed {
+		r.Phase = v1alpha1.ReplacementPhaseRenaming
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	copy.Status.Replacement = r
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) finishReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	db, err := h.getDB(o)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil || db == nil {
+		return err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" || db.Endpoint == nil {
+		return nil
+	}
+	if err := h.sdk.Update(h.createSecret(o, db)); err != nil {
+		return err
+	}
+
+	h.logger(o).Info("replacement completed")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "ReplacementCompleted",
+		fmt.Sprintf("Instance %s was replaced, the old instance was deleted with a final snapshot", dbName(o)))
+
+	r.Phase = v1alpha1.ReplacementPhaseCompleted
+	r.Instance = ""
+	r.BakeUntil = nil
+	copy := o.DeepCopy()
+	copy.Status.Replacement = r
+	// The new instance was created without deletion protection or
+	// storage autoscaling.
+	copy.Status.DeletionProtection = false
+	copy.Status.MaxAllocatedStorage = 0
+	return h.sdk.Update(copy)
+}
+
+// deleteReplacement deletes the new instance of a replacement that has not
+// taken over the original identifier yet.
+func (h *Handler) deleteReplacement(o *v1alpha1.Database) {
+	r := o.Status.Replacement
+	if r == nil || r.Instance == "" || r.Phase == v1alpha1.ReplacementPhaseRenaming {
+		return
+	}
+	h.discard(o, r.Instance)
+}
+
+// replacing lists the fields left to a replacement, drift in these is not
+// reverted in place.
+func replacing(o *v1alpha1.Database) []string {
+	r := o.Status.Replacement
+	if r == nil || r.Phase == v1alpha1.ReplacementPhaseCompleted {
+		return nil
+	}
+	return r.Changes
+}
+
+func (h *Handler) replacementFailed(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus, msg string) error {
+	h.logger(o).Warn("replacement failed: " + msg)
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "ReplacementFailed",
+		"Replacement failed: "+msg)
+
+	r.Phase = v1alpha1.ReplacementPhaseFailed
+	r.Message = msg
+	return h.setReplacement(o, r)
+}
+
+func (h *Handler) setReplacement(o *v1alpha1.Database, r *v1alpha1.ReplacementStatus) error {
+	h.logger(o).WithField("phase", r.Phase).Debug("set replacement status")
+
+	copy := o.DeepCopy()
+	copy.Status.Replacement = r
+	return h.sdk.Update(copy)
+}
+
+// replacementSnapshotName returns e.g.
+// default-app-pre-replacement-20181020150405.
+func replacementSnapshotName(id string, now time.Time) string {
+	return id + "-pre-replacement-" + now.UTC().Format("20060102150405")
+}
@@ -0,0 +1,249 @@
+package rds
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/naming"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func replacementStatus(s *scenario) *v1alpha1.ReplacementStatus {
+	return s.sdk.database("app").Status.Replacement
+}
+
+// subnetScenario creates a database in subnet group a of vpc-1, subnet group
+// b is in vpc-2.
+func subnetScenario(t *testing.T) *scenario {
+	s := newScenario(t)
+	s.rds.AddSubnetGroup("a", "vpc-1")
+	s.rds.AddSubnetGroup("b", "vpc-2")
+	db := testDatabase("app")
+	db.Spec.SubnetGroup = "a"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	s.settle("app")
+	return s
+}
+
+// replaceSubnet moves the database to subnet group b with the BlueGreen
+// strategy and runs the replacement until it bakes.
+func replaceSubnet(t *testing.T) *scenario {
+	s := subnetScenario(t)
+	db := s.sdk.database("app")
+	db.Spec.SubnetGroup = "b"
+	db.Spec.Replacement = &v1alpha1.Replacement{
+		Strategy:   v1alpha1.ReplacementStrategyBlueGreen,
+		BakePeriod: &metav1.Duration{Duration: time.Hour},
+	}
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseSnapshotting, r.Phase)
+	require.Equal(t, v1alpha1.ReplacementMethodSnapshot, r.Method)
+	require.Equal(t, []string{"subnetGroup"}, r.Changes)
+	require.Len(t, events(s, "ReplacementStarted"), 1)
+
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseProvisioning, replacementStatus(s).Phase)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseProvisioning, replacementStatus(s).Phase)
+
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	r = replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseBaking, r.Phase)
+	require.Equal(t, "default-app-replacement", r.Instance)
+	require.NotNil(t, r.BakeUntil)
+	require.Len(t, events(s, "ReplacementReady"), 1)
+
+	replacement := s.rds.Instance("default-app-replacement")
+	require.Equal(t, "vpc-2", aws.StringValue(replacement.DBSubnetGroup.VpcId))
+	require.Equal(t, *replacement.Endpoint.Address, string(s.sdk.secret("app-db-credentials").Data["host"]))
+	return s
+}
+
+func TestReplacement_Snapshot(t *testing.T) {
+	s := replaceSubnet(t)
+
+	// The old instance is kept while baking.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+
+	db := s.sdk.database("app")
+	past := metav1.NewTime(time.Now().Add(-time.Minute))
+	db.Status.Replacement.BakeUntil = &past
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseRetiring, replacementStatus(s).Phase)
+	require.Equal(t, 1, s.rds.Calls("DeleteDBInstance"))
+
+	s.rds.Advance(3 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseRenaming, replacementStatus(s).Phase)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseCompleted, r.Phase)
+	require.Empty(t, r.Instance)
+	require.Len(t, events(s, "ReplacementCompleted"), 1)
+
+	require.Nil(t, s.rds.Instance("default-app-replacement"))
+	instance := s.rds.Instance("default-app")
+	require.Equal(t, "b", aws.StringValue(instance.DBSubnetGroup.DBSubnetGroupName))
+	require.Equal(t, *instance.Endpoint.Address, string(s.sdk.secret("app-db-credentials").Data["host"]))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBSnapshot"))
+}
+
+func TestReplacement_SpecRemoved(t *testing.T) {
+	s := subnetScenario(t)
+	db := s.sdk.database("app")
+	db.Spec.SubnetGroup = "b"
+	db.Spec.Replacement = &v1alpha1.Replacement{
+		Strategy:   v1alpha1.ReplacementStrategyBlueGreen,
+		BakePeriod: &metav1.Duration{Duration: time.Hour},
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, time.Hour, replacementStatus(s).BakePeriod.Duration)
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseProvisioning, replacementStatus(s).Phase)
+
+	// The replacement finishes with the bake period it started with.
+	db = s.sdk.database("app")
+	db.Spec.Replacement = nil
+	s.apply(db)
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseBaking, r.Phase)
+	require.WithinDuration(t, time.Now().Add(time.Hour), r.BakeUntil.Time, time.Minute)
+}
+
+func TestReplacement_DeleteWhileBaking(t *testing.T) {
+	s := replaceSubnet(t)
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, 2, s.rds.Calls("DeleteDBInstance"))
+	s.rds.Advance(3 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+	require.Nil(t, s.rds.Instance("default-app-replacement"))
+}
+
+func TestReplacement_ReplicaLongIdentifier(t *testing.T) {
+	name := strings.Repeat("a", 55)
+	s := createdScenario(t, name)
+	s.settle(name)
+	id := s.sdk.database(name).Status.InstanceIdentifier
+	require.Len(t, id, naming.MaxLength)
+
+	db := s.sdk.database(name)
+	db.Spec.StorageType = "standard"
+	db.Spec.Replacement = &v1alpha1.Replacement{Strategy: v1alpha1.ReplacementStrategyBlueGreen}
+	s.apply(db)
+
+	require.NoError(t, s.sync(name))
+	r := s.sdk.database(name).Status.Replacement
+	require.Equal(t, v1alpha1.ReplacementPhaseProvisioning, r.Phase)
+	require.Equal(t, naming.Suffix(id, "-replacement"), r.Instance)
+	require.NotNil(t, s.rds.Instance(r.Instance))
+}
+
+func TestReplacement_Replica(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.StorageType = "standard"
+	db.Spec.Replacement = &v1alpha1.Replacement{
+		Strategy:   v1alpha1.ReplacementStrategyBlueGreen,
+		BakePeriod: &metav1.Duration{},
+	}
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseProvisioning, r.Phase)
+	require.Equal(t, v1alpha1.ReplacementMethodReplica, r.Method)
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhasePromoting, replacementStatus(s).Phase)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhasePromoting, replacementStatus(s).Phase)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseBaking, replacementStatus(s).Phase)
+
+	// Without a bake period the old instance is deleted right away.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseRetiring, replacementStatus(s).Phase)
+	s.rds.Advance(3 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.ReplacementPhaseCompleted, replacementStatus(s).Phase)
+
+	instance := s.rds.Instance("default-app")
+	require.Equal(t, "standard", aws.StringValue(instance.StorageType))
+	require.Nil(t, instance.ReadReplicaSourceDBInstanceIdentifier)
+}
+
+func TestReplacement_Required(t *testing.T) {
+	s := subnetScenario(t)
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+
+	db := s.sdk.database("app")
+	db.Spec.SubnetGroup = "b"
+	s.apply(db)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseRequired, r.Phase)
+	require.Contains(t, r.Message, v1alpha1.ReplacementStrategyBlueGreen)
+	require.Len(t, events(s, "ReplacementRequired"), 1)
+	// The subnet group is not reverted in place.
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+
+	// Reverting the spec clears the replacement.
+	db = s.sdk.database("app")
+	db.Spec.SubnetGroup = "a"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Nil(t, replacementStatus(s))
+}
+
+func TestReplacement_CharacterSetName(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.CharacterSetName = "LATIN1"
+	db.Spec.Replacement = &v1alpha1.Replacement{Strategy: v1alpha1.ReplacementStrategyBlueGreen}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+
+	r := replacementStatus(s)
+	require.Equal(t, v1alpha1.ReplacementPhaseFailed, r.Phase)
+	require.Contains(t, r.Message, "characterSetName cannot be changed")
+	require.Len(t, events(s, "ReplacementFailed"), 1)
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+}
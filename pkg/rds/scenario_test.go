@@ -0,0 +1,535 @@
+package rds
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/coldog/rds-operator/version"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// memorySDK stores objects written by the handler so scenarios can feed the
+// latest version back into Handle, like the informer would.
+type memorySDK struct {
+	mu      sync.Mutex
+	objects map[string]sdk.Object
+	deleted []sdk.Object
+}
+
+func newMemorySDK() *memorySDK {
+	return &memorySDK{objects: map[string]sdk.Object{}}
+}
+
+func objectKey(object sdk.Object) string {
+	m, err := meta.Accessor(object)
+	if err != nil {
+		panic(err)
+	}
+	return object.GetObjectKind().GroupVersionKind().Kind + "/" + m.GetNamespace() + "/" + m.GetName()
+}
+
+func (m *memorySDK) Get(object sdk.Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := objectKey(object)
+	stored, ok := m.objects[key]
+	if !ok {
+		return k8errors.NewNotFound(schema.GroupResource{}, key)
+	}
+	reflect.ValueOf(object).Elem().Set(reflect.ValueOf(stored.DeepCopyObject()).Elem())
+	return nil
+}
+
+func (m *memorySDK) delete(object sdk.Object) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, objectKey(object))
+}
+
+func (m *memorySDK) list(kind string) (out []sdk.Object) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, o := range m.objects {
+		if strings.HasPrefix(key, kind+"/") {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func (m *memorySDK) List(namespace string, into sdk.Object) error {
+	switch l := into.(type) {
+	case *v1alpha1.DatabaseClassList:
+		for _, o := range m.list("DatabaseClass") {
+			l.Items = append(l.Items, *o.DeepCopyObject().(*v1alpha1.DatabaseClass))
+		}
+	case *v1alpha1.DatabasePolicyList:
+		for _, o := range m.list("DatabasePolicy") {
+			l.Items = append(l.Items, *o.DeepCopyObject().(*v1alpha1.DatabasePolicy))
+		}
+	case *v1alpha1.DatabaseList:
+		for _, o := range m.list("Database/" + namespace) {
+			l.Items = append(l.Items, *o.DeepCopyObject().(*v1alpha1.Database))
+		}
+	case *v1alpha1.DatabaseInstanceList:
+		for _, o := range m.list("DatabaseInstance") {
+			l.Items = append(l.Items, *o.DeepCopyObject().(*v1alpha1.DatabaseInstance))
+		}
+	}
+	return nil
+}
+
+// Delete removes the object, the deleted objects are kept for the scenario
+// to deliver their deletion events.
+func (m *memorySDK) Delete(object sdk.Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := objectKey(object)
+	stored, ok := m.objects[key]
+	if !ok {
+		return k8errors.NewNotFound(schema.GroupResource{}, key)
+	}
+	delete(m.objects, key)
+	m.deleted = append(m.deleted, stored)
+	return nil
+}
+
+func (m *memorySDK) Create(object sdk.Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := objectKey(object)
+	if _, ok := m.objects[key]; ok {
+		return k8errors.NewAlreadyExists(schema.GroupResource{}, key)
+	}
+	m.objects[key] = object.DeepCopyObject()
+	return nil
+}
+
+func (m *memorySDK) Update(object sdk.Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[objectKey(object)] = object.DeepCopyObject()
+	return nil
+}
+
+func (m *memorySDK) database(name string) *v1alpha1.Database {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects["Database/default/"+name]
+	if !ok {
+		return nil
+	}
+	return o.DeepCopyObject().(*v1alpha1.Database)
+}
+
+func (m *memorySDK) secret(name string) *corev1.Secret {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects["Secret/default/"+name]
+	if !ok {
+		return nil
+	}
+	return o.(*corev1.Secret)
+}
+
+type scenario struct {
+	t   *testing.T
+	rds *fake.RDS
+	sdk *memorySDK
+	h   *Handler
+}
+
+func newScenario(t *testing.T) *scenario {
+	f := fake.New()
+	s := newMemorySDK()
+	return &scenario{t: t, rds: f, sdk: s, h: &Handler{rds: f, sdk: s}}
+}
+
+func (s *scenario) apply(db *v1alpha1.Database) {
+	require.NoError(s.t, s.sdk.Update(db))
+}
+
+// sync runs the handler against the latest stored version of the database.
+func (s *scenario) sync(name string) error {
+	return s.h.Handle(context.Background(), sdk.Event{Object: s.sdk.database(name)})
+}
+
+// settle runs the syncs recording tags and the engine version on a created
+// database, each of which updates the status once.
+func (s *scenario) settle(name string) {
+	require.NoError(s.t, s.sync(name))
+	require.NoError(s.t, s.sync(name))
+}
+
+func (s *scenario) remove(name string) error {
+	return s.h.Handle(context.Background(), sdk.Event{Object: s.sdk.database(name), Deleted: true})
+}
+
+func testDatabase(name string) *v1alpha1.Database {
+	return &v1alpha1.Database{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Database",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+		},
+	}
+}
+
+func TestScenario_CreateAndDelete(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+	require.Equal(t, fake.StatusCreating, *s.rds.Instance("default-app").DBInstanceStatus)
+	require.Nil(t, s.sdk.secret("app-db-credentials"))
+
+	// Still creating, nothing changes.
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+
+	secret := s.sdk.secret("app-db-credentials")
+	require.NotNil(t, secret)
+	require.Equal(t, *s.rds.Instance("default-app").Endpoint.Address, string(secret.Data["host"]))
+
+	// The first syncs after creation record the ownership tags and the
+	// engine version, after that created databases are left alone.
+	s.settle("app")
+	require.Equal(t, "app", s.rds.Tags("default-app")[TagName])
+	require.Equal(t, 0, s.rds.Calls("AddTagsToResource"))
+	require.Equal(t, "10.4", s.sdk.database("app").Status.EngineVersion)
+
+	describes := s.rds.Calls("DescribeDBInstances")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, describes, s.rds.Calls("DescribeDBInstances"))
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("default-app").DBInstanceStatus)
+
+	s.rds.Advance(5 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+
+	snaps, err := s.rds.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{
+		DBInstanceIdentifier: str("default-app"),
+	})
+	require.NoError(t, err)
+	require.Len(t, snaps.DBSnapshots, 1)
+
+	// Deleting again once the instance is gone is a no-op.
+	require.NoError(t, s.remove("app"))
+}
+
+func TestScenario_GeneratedPassword(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+
+	// The syncs waiting for the endpoint keep the generated password.
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+
+	password := s.rds.MasterUserPassword("default-app")
+	require.NotEmpty(t, password)
+	require.Equal(t, password, s.sdk.database("app").Spec.Password)
+	secret := s.sdk.secret("app-db-credentials")
+	require.Equal(t, password, string(secret.Data["password"]))
+	require.Contains(t, string(secret.Data["url"]), ":"+password+"@")
+}
+
+func TestScenario_ThrottledDescribe(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	s.rds.Fail("DescribeDBInstances", fake.Throttling(), 2)
+
+	require.Error(t, s.sync("app"))
+	require.Error(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+}
+
+func TestScenario_ThrottledCreate(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	s.rds.Fail("CreateDBInstance", fake.Throttling(), 1)
+
+	require.Error(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StatePending, s.sdk.database("app").Status.State)
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+}
+
+func TestScenario_QuotaExceeded(t *testing.T) {
+	s := newScenario(t)
+	s.rds.InstanceQuota = 1
+	s.apply(testDatabase("first"))
+	s.apply(testDatabase("second"))
+
+	require.NoError(t, s.sync("first"))
+	require.NoError(t, s.sync("second"))
+
+	db := s.sdk.database("second")
+	require.Equal(t, v1alpha1.StateFailure, db.Status.State)
+	require.Contains(t, db.Status.Error, "InstanceQuotaExceeded")
+	require.Nil(t, s.rds.Instance("default-second"))
+}
+
+func TestScenario_DeleteFailure(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+
+	s.rds.Fail("DeleteDBInstance", fake.Throttling(), 1)
+	require.Error(t, s.remove("app"))
+	require.Equal(t, fake.StatusAvailable, *s.rds.Instance("default-app").DBInstanceStatus)
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("default-app").DBInstanceStatus)
+}
+
+func TestScenario_PlanOnlyAnnotation(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Annotations = map[string]string{v1alpha1.AnnotationPlanOnly: "true"}
+	db.Spec.Password = "secret"
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("CreateDBInstance"))
+
+	status := s.sdk.database("app").Status
+	require.Equal(t, v1alpha1.StatePlanned, status.State)
+	require.Len(t, status.Plan, 1)
+	require.Equal(t, "CreateDBInstance", status.Plan[0].Action)
+	require.Contains(t, status.Plan[0].Input, `"DBInstanceIdentifier":"default-app"`)
+	require.Contains(t, status.Plan[0].Input, `"MasterUserPassword":"REDACTED"`)
+	require.NotContains(t, status.Plan[0].Input, "secret")
+	require.NotContains(t, status.Plan[0].Input, "null")
+
+	// Removing the annotation applies the plan.
+	db = s.sdk.database("app")
+	db.Annotations = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+	require.Nil(t, s.sdk.database("app").Status.Plan)
+}
+
+func TestScenario_DryRunModifyAndDelete(t *testing.T) {
+	s := newScenario(t)
+	s.apply(testDatabase("app"))
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+
+	s.h.cfg.DryRun = true
+
+	// Nothing differs, the plan is empty and the database stays created.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+	require.Len(t, s.sdk.database("app").Status.Plan, 0)
+
+	// Spec changes are only applied by a drift revert.
+	db := s.sdk.database("app")
+	db.Spec.InstanceClass = "db.m4.large"
+	db.Spec.Storage = 100
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Len(t, s.sdk.database("app").Status.Plan, 0)
+
+	db = s.sdk.database("app")
+	db.Spec.DriftPolicy = v1alpha1.DriftPolicyRevert
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.StateCreated, s.sdk.database("app").Status.State)
+	plan := s.sdk.database("app").Status.Plan
+	require.Len(t, plan, 1)
+	require.Equal(t, "ModifyDBInstance", plan[0].Action)
+	require.Contains(t, plan[0].Input, `"DBInstanceClass":"db.m4.large"`)
+	require.Contains(t, plan[0].Input, `"AllocatedStorage":100`)
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+	require.Equal(t, "db.t2.micro", *s.rds.Instance("default-app").DBInstanceClass)
+
+	require.NoError(t, s.remove("app"))
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Equal(t, fake.StatusAvailable, *s.rds.Instance("default-app").DBInstanceStatus)
+}
+
+func TestScenario_DryRunPlansChanges(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+	s.h.cfg.DryRun = true
+	modifies := s.rds.Calls("ModifyDBInstance")
+
+	db := s.sdk.database("app")
+	db.Spec.DeletionProtection = true
+	db.Spec.StorageAutoscaling = &v1alpha1.StorageAutoscaling{
+		Mode:                v1alpha1.StorageAutoscalingNative,
+		MaxAllocatedStorage: 100,
+	}
+	db.Spec.EngineVersion = "11.1"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+
+	plan := s.sdk.database("app").Status.Plan
+	require.Len(t, plan, 4)
+	require.Contains(t, plan[0].Input, `"DeletionProtection":true`)
+	require.Contains(t, plan[1].Input, `"MaxAllocatedStorage":100`)
+	require.Equal(t, "CreateDBSnapshot", plan[2].Action)
+	require.Contains(t, plan[2].Input, `"DBSnapshotIdentifier":"default-app-pre-upgrade-11-1-yyyymmddhhmmss"`)
+	require.Equal(t, "ModifyDBInstance", plan[3].Action)
+	require.Contains(t, plan[3].Input, `"EngineVersion":"11.1"`)
+
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, plan, s.sdk.database("app").Status.Plan)
+	require.Equal(t, modifies, s.rds.Calls("ModifyDBInstance"))
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+}
+
+func TestScenario_DryRunOff(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.h.cfg.DryRun = true
+
+	db := s.sdk.database("app")
+	db.Spec.Tags = map[string]string{"team": "payments"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	status := s.sdk.database("app").Status
+	require.Equal(t, v1alpha1.StateCreated, status.State)
+	require.Len(t, status.Plan, 1)
+	require.Equal(t, "AddTagsToResource", status.Plan[0].Action)
+	require.Equal(t, 0, s.rds.Calls("AddTagsToResource"))
+
+	// The database is synced as created once plan mode is off.
+	s.h.cfg.DryRun = false
+	s.settle("app")
+	require.Equal(t, 1, s.rds.Calls("CreateDBInstance"))
+	require.Equal(t, 1, s.rds.Calls("AddTagsToResource"))
+	status = s.sdk.database("app").Status
+	require.Equal(t, v1alpha1.StateCreated, status.State)
+	require.Nil(t, status.Plan)
+	require.Equal(t, "payments", s.rds.Tags("default-app")["team"])
+}
+
+func TestScenario_TagSync(t *testing.T) {
+	s := newScenario(t)
+	s.h.cfg.ClusterID = "prod"
+	s.h.cfg.TagLabels = []string{"team"}
+
+	db := testDatabase("app")
+	db.Labels = map[string]string{"team": "payments", "ignored": "true"}
+	db.Spec.Tags = map[string]string{"cost-center": "42"}
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+
+	require.Equal(t, map[string]string{
+		"team":             "payments",
+		"cost-center":      "42",
+		TagClusterID:       "prod",
+		TagNamespace:       "default",
+		TagName:            "app",
+		TagOperatorVersion: version.Version,
+	}, s.rds.Tags("default-app"))
+
+	// Tags added outside the operator are kept.
+	_, err := s.rds.AddTagsToResource(&rds.AddTagsToResourceInput{
+		ResourceName: s.rds.Instance("default-app").DBInstanceArn,
+		Tags:         []*rds.Tag{{Key: str("owner"), Value: str("dba")}},
+	})
+	require.NoError(t, err)
+
+	db = s.sdk.database("app")
+	db.Labels["team"] = "billing"
+	db.Spec.Tags = map[string]string{TagName: "spoofed"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+
+	tags := s.rds.Tags("default-app")
+	require.Equal(t, "billing", tags["team"])
+	require.Equal(t, "dba", tags["owner"])
+	require.Equal(t, "app", tags[TagName])
+	require.NotContains(t, tags, "cost-center")
+	require.NotContains(t, tags, "ignored")
+
+	calls := s.rds.Calls("ListTagsForResource")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, calls, s.rds.Calls("ListTagsForResource"))
+}
+
+func TestScenario_DeletionPolicy(t *testing.T) {
+	finalSnapshots := func(s *scenario, id string) int {
+		snaps, err := s.rds.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{DBInstanceIdentifier: str(id)})
+		require.NoError(t, err)
+		return len(snaps.DBSnapshots)
+	}
+
+	s := createdScenario(t, "app", "kept")
+	s.h.cfg.DeletionPolicy = v1alpha1.DeletionPolicyDelete
+	require.NoError(t, s.remove("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.Nil(t, s.rds.Instance("default-app"))
+	require.Equal(t, 0, finalSnapshots(s, "default-app"))
+
+	// The spec overrides the operator default.
+	db := s.sdk.database("kept")
+	db.Spec.DeletionPolicy = v1alpha1.DeletionPolicyRetain
+	s.apply(db)
+	require.NoError(t, s.remove("kept"))
+	s.rds.Advance(5 * time.Minute)
+	require.Equal(t, fake.StatusAvailable, *s.rds.Instance("default-kept").DBInstanceStatus)
+	require.Len(t, events(s, "InstanceRetained"), 1)
+}
+
+func TestScenario_DefaultTags(t *testing.T) {
+	s := newScenario(t)
+	s.h.cfg.DefaultTags = map[string]string{"env": "prod", "team": "platform", TagName: "spoofed"}
+
+	db := testDatabase("app")
+	db.Spec.Tags = map[string]string{"team": "payments"}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	s.settle("app")
+
+	tags := s.rds.Tags("default-app")
+	require.Equal(t, "prod", tags["env"])
+	require.Equal(t, "payments", tags["team"])
+	require.Equal(t, "app", tags[TagName])
+}
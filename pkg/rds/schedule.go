@@ -0,0 +1,129 @@
+package rds
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/cron"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const checkSchedule = "schedule"
+
+// hibernate stops the instance outside the active hours of spec.schedule, or
+// while the schedule is stopped, and starts it again afterwards. RDS starts
+// instances that were stopped for 7 days, these are stopped again. The
+// Stopped condition is true while the operator keeps the instance stopped,
+// the remaining steps are skipped as RDS rejects changes to stopped
+// instances.
+func (h *Handler) hibernate(o *v1alpha1.Database) (handled bool, err error) {
+	stopped := conditionTrue(o.Status.Conditions, v1alpha1.ConditionStopped)
+	if o.Spec.Schedule == nil && !stopped {
+		return false, nil
+	}
+	// Instances stay as they are while schedules are disabled.
+	if !h.enabled(FeatureSchedules) {
+		return stopped, nil
+	}
+	now := time.Now()
+	if !h.due(checkSchedule, o, h.cfg.ScheduleInterval, now) {
+		return stopped, nil
+	}
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return stopped, err
+	}
+	h.markChecked(checkSchedule, o, now)
+
+	logger := h.logger(o)
+	status := aws.StringValue(db.DBInstanceStatus)
+	stop, reason := scheduledStop(o.Spec.Schedule, now)
+	cond := v1alpha1.DatabaseCondition{
+		Type:   v1alpha1.ConditionStopped,
+		Status: corev1.ConditionFalse,
+		Reason: "Active",
+	}
+	if stop {
+		cond.Status = corev1.ConditionTrue
+		cond.Reason = reason
+	}
+
+	switch {
+	case stop && status == "available":
+		logger.WithField("reason", reason).Info("stopping instance")
+		if _, err := h.rds.StopDBInstance(&rds.StopDBInstanceInput{DBInstanceIdentifier: db.DBInstanceIdentifier}); err != nil {
+			return true, err
+		}
+		if stopped {
+			recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "InstanceRestopped",
+				"Stopped instance "+dbName(o)+" again after RDS started it")
+		} else {
+			recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "InstanceStopped",
+				"Stopped instance "+dbName(o)+", "+stopMessage(reason))
+		}
+	case stop && (status == "stopping" || status == "stopped"):
+	case stop:
+		// Busy instances, including ones RDS is starting, are stopped
+		// once available.
+		return stopped, nil
+	case status == "stopped":
+		logger.Info("starting instance")
+		if _, err := h.rds.StartDBInstance(&rds.StartDBInstanceInput{DBInstanceIdentifier: db.DBInstanceIdentifier}); err != nil {
+			return true, err
+		}
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "InstanceStarted",
+			"Started instance "+dbName(o))
+	case status == "stopping":
+		return true, nil
+	}
+
+	conditions, changed := setCondition(o.Status.Conditions, cond, now)
+	if !changed {
+		return stop, nil
+	}
+	copy := o.DeepCopy()
+	copy.Status.Conditions = conditions
+	return true, h.sdk.Update(copy)
+}
+
+// scheduledStop reports whether the schedule stops the instance at the time
+// and why.
+func scheduledStop(s *v1alpha1.Schedule, now time.Time) (bool, string) {
+	if s == nil {
+		return false, ""
+	}
+	if s.Stopped {
+		return true, "Stopped"
+	}
+	if s.ActiveHours == "" {
+		return false, ""
+	}
+	// Both are validated.
+	expr, err := cron.Parse(s.ActiveHours)
+	if err != nil {
+		return false, ""
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false, ""
+	}
+	return !expr.Match(now.In(loc)), "OutsideActiveHours"
+}
+
+func stopMessage(reason string) string {
+	if reason == "Stopped" {
+		return "spec.schedule.stopped is set"
+	}
+	return "it is outside the active hours"
+}
+
+func conditionTrue(conds []v1alpha1.DatabaseCondition, t string) bool {
+	for _, c := range conds {
+		if c.Type == t {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
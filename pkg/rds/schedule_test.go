@@ -0,0 +1,93 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func setSchedule(s *scenario, name string, schedule *v1alpha1.Schedule) {
+	db := s.sdk.database(name)
+	db.Spec.Schedule = schedule
+	s.apply(db)
+}
+
+func stoppedCondition(s *scenario, name string) *v1alpha1.DatabaseCondition {
+	for _, c := range s.sdk.database(name).Status.Conditions {
+		if c.Type == v1alpha1.ConditionStopped {
+			return &c
+		}
+	}
+	return nil
+}
+
+func TestSchedule_ActiveHours(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	// February never has a 30th.
+	setSchedule(s, "app", &v1alpha1.Schedule{ActiveHours: "* * 30 2 *"})
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("StopDBInstance"))
+	require.Len(t, events(s, "InstanceStopped"), 1)
+	cond := stoppedCondition(s, "app")
+	require.Equal(t, corev1.ConditionTrue, cond.Status)
+	require.Equal(t, "OutsideActiveHours", cond.Reason)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, fake.StatusStopped, *s.rds.Instance("default-app").DBInstanceStatus)
+	require.Equal(t, 1, s.rds.Calls("StopDBInstance"))
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+
+	setSchedule(s, "app", &v1alpha1.Schedule{ActiveHours: "* * * * *"})
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("StartDBInstance"))
+	require.Len(t, events(s, "InstanceStarted"), 1)
+	require.Equal(t, corev1.ConditionFalse, stoppedCondition(s, "app").Status)
+
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, fake.StatusAvailable, *s.rds.Instance("default-app").DBInstanceStatus)
+	require.Equal(t, 1, s.rds.Calls("StopDBInstance"))
+}
+
+func TestSchedule_Stopped(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	setSchedule(s, "app", &v1alpha1.Schedule{ActiveHours: "* * * * *", Stopped: true})
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "Stopped", stoppedCondition(s, "app").Reason)
+	s.rds.Advance(2 * time.Minute)
+
+	// Removing the schedule starts the instance again.
+	setSchedule(s, "app", nil)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("StartDBInstance"))
+	require.Equal(t, corev1.ConditionFalse, stoppedCondition(s, "app").Status)
+}
+
+func TestSchedule_Restop(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	setSchedule(s, "app", &v1alpha1.Schedule{Stopped: true})
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+
+	// RDS starts the instance after 7 days.
+	s.rds.Advance(fake.AutoStart)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(2 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("StopDBInstance"))
+	require.Len(t, events(s, "InstanceRestopped"), 1)
+	require.Len(t, events(s, "InstanceStopped"), 1)
+}
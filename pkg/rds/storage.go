@@ -0,0 +1,170 @@
+package rds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	checkStorage       = "storage"
+	deferStorageGrowth = "StorageGrowth"
+	deferNativeStorage = "NativeStorage"
+
+	gib = 1 << 30
+
+	// storageCooldown is the time RDS requires between storage
+	// modifications.
+	storageCooldown = 6 * time.Hour
+
+	// maxStorageGrowths is the number of growths kept in the status.
+	maxStorageGrowths = 10
+)
+
+// growStorage grows the allocated storage by the configured step when free
+// storage drops below the threshold, never beyond maxAllocatedStorage and
+// not within the RDS cooldown of the last growth.
+func (h *Handler) growStorage(o *v1alpha1.Database) (handled bool, err error) {
+	if o.Spec.StorageAutoscaling == nil || h.metrics == nil {
+		return false, nil
+	}
+	declared := o.DeepCopy()
+	v1alpha1.Defaults(declared)
+	a := declared.Spec.StorageAutoscaling
+	if a.Mode != v1alpha1.StorageAutoscalingOperator {
+		return false, nil
+	}
+
+	now := time.Now()
+	if !h.due(checkStorage, o, h.cfg.StorageInterval, now) {
+		return false, nil
+	}
+
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return false, err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return false, nil
+	}
+	free, err := h.metrics.FreeStorageBytes(aws.StringValue(db.DBInstanceIdentifier))
+	if err != nil {
+		return false, err
+	}
+	h.markChecked(checkStorage, o, now)
+
+	allocated := aws.Int64Value(db.AllocatedStorage)
+	freePercent := int64(100 * free / float64(allocated*gib))
+	logger := h.logger(o).
+		WithField("allocated", allocated).
+		WithField("freePercent", freePercent)
+
+	if freePercent >= a.ThresholdPercent {
+		return false, nil
+	}
+	if allocated >= a.MaxAllocatedStorage {
+		logger.Warn("storage is low but already at maxAllocatedStorage")
+		return false, nil
+	}
+	if n := len(o.Status.StorageGrowth); n > 0 && now.Sub(o.Status.StorageGrowth[n-1].Time.Time) < storageCooldown {
+		logger.Info("storage is low, waiting for the storage modification cooldown")
+		return false, nil
+	}
+
+	target := allocated + a.Step
+	if min := (allocated*11 + 9) / 10; target < min {
+		target = min
+	}
+	if target > a.MaxAllocatedStorage {
+		target = a.MaxAllocatedStorage
+	}
+
+	logger.WithField("target", target).Info("growing storage")
+	deferred, err := h.modify(o, deferStorageGrowth, &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		AllocatedStorage:     aws.Int64(target),
+		ApplyImmediately:     aws.Bool(true),
+	})
+	if err != nil {
+		return true, err
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferStorageGrowth, deferred)
+	if deferred == nil {
+		copy.Status.StorageGrowth = append(copy.Status.StorageGrowth, v1alpha1.StorageGrowth{
+			Time:        metav1.NewTime(now),
+			From:        allocated,
+			To:          target,
+			FreePercent: freePercent,
+		})
+		if n := len(copy.Status.StorageGrowth); n > maxStorageGrowths {
+			copy.Status.StorageGrowth = copy.Status.StorageGrowth[n-maxStorageGrowths:]
+		}
+		recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "StorageGrown",
+			fmt.Sprintf("Grew storage from %dGiB to %dGiB at %d%% free", allocated, target, freePercent))
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return true, nil
+	}
+	return true, h.sdk.Update(copy)
+}
+
+// autoscaledStorage reports whether the allocated storage is managed by
+// storage autoscaling, in which case it may exceed the spec.
+func autoscaledStorage(spec v1alpha1.DatabaseSpec, db *rds.DBInstance) bool {
+	a := spec.StorageAutoscaling
+	allocated := aws.Int64Value(db.AllocatedStorage)
+	return a != nil && allocated >= spec.Storage && allocated <= a.MaxAllocatedStorage
+}
+
+// nativeMaxStorage returns the limit of native storage autoscaling, 0 when
+// RDS does not grow the storage.
+func nativeMaxStorage(o *v1alpha1.Database) int64 {
+	a := o.Spec.StorageAutoscaling
+	if a == nil || a.Mode != v1alpha1.StorageAutoscalingNative {
+		return 0
+	}
+	return a.MaxAllocatedStorage
+}
+
+// nativeStorageInput returns the modification applying the limit of native
+// storage autoscaling. A limit equal to the allocated storage turns
+// autoscaling off.
+func nativeStorageInput(o *v1alpha1.Database, db *rds.DBInstance) *rds.ModifyDBInstanceInput {
+	limit := nativeMaxStorage(o)
+	if limit == 0 {
+		limit = aws.Int64Value(db.AllocatedStorage)
+	}
+	return &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		MaxAllocatedStorage:  i64(limit),
+	}
+}
+
+// syncNativeStorage applies the limit of native storage autoscaling whenever
+// it differs from the limit last applied, regardless of the drift policy.
+func (h *Handler) syncNativeStorage(o *v1alpha1.Database) error {
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return err
+	}
+	max := nativeMaxStorage(o)
+	h.logger(o).WithField("maxAllocatedStorage", max).Info("setting native storage autoscaling")
+	deferred, err := h.modify(o, deferNativeStorage, nativeStorageInput(o, db))
+	if err != nil {
+		return err
+	}
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferNativeStorage, deferred)
+	if deferred == nil {
+		copy.Status.MaxAllocatedStorage = max
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	return h.sdk.Update(copy)
+}
@@ -0,0 +1,150 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func storageScenario(t *testing.T, max int64) (*scenario, *fake.Metrics) {
+	s := createdScenario(t, "app")
+	metrics := fake.NewMetrics()
+	s.h.metrics = metrics
+
+	db := s.sdk.database("app")
+	db.Spec.StorageAutoscaling = &v1alpha1.StorageAutoscaling{MaxAllocatedStorage: max}
+	s.apply(db)
+	s.settle("app")
+	return s, metrics
+}
+
+func TestStorage_Grows(t *testing.T) {
+	s, metrics := storageScenario(t, 100)
+
+	metrics.SetFreeStorage("default-app", 10*gib)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+
+	metrics.SetFreeStorage("default-app", 1*gib)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.Equal(t, int64(30), *s.rds.Instance("default-app").AllocatedStorage)
+
+	growth := s.sdk.database("app").Status.StorageGrowth
+	require.Len(t, growth, 1)
+	require.Equal(t, int64(20), growth[0].From)
+	require.Equal(t, int64(30), growth[0].To)
+	require.Equal(t, int64(5), growth[0].FreePercent)
+	require.Len(t, events(s, "StorageGrown"), 1)
+
+	// Grown storage is not drift.
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyReport)
+	require.NoError(t, s.sync("app"))
+	require.Empty(t, s.sdk.database("app").Status.Drift)
+}
+
+func TestStorage_Cooldown(t *testing.T) {
+	s, metrics := storageScenario(t, 100)
+	metrics.SetFreeStorage("default-app", 1*gib)
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+
+	db := s.sdk.database("app")
+	db.Status.StorageGrowth[0].Time = metav1.NewTime(time.Now().Add(-7 * time.Hour))
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 2, s.rds.Calls("ModifyDBInstance"))
+	require.Len(t, s.sdk.database("app").Status.StorageGrowth, 2)
+}
+
+func TestStorage_Max(t *testing.T) {
+	s, metrics := storageScenario(t, 25)
+	metrics.SetFreeStorage("default-app", 0)
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.Equal(t, int64(25), *s.rds.Instance("default-app").AllocatedStorage)
+
+	db := s.sdk.database("app")
+	db.Status.StorageGrowth = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestStorage_Native(t *testing.T) {
+	s := newScenario(t)
+	metrics := fake.NewMetrics()
+	s.h.metrics = metrics
+	db := testDatabase("app")
+	db.Spec.StorageAutoscaling = &v1alpha1.StorageAutoscaling{
+		Mode:                v1alpha1.StorageAutoscalingNative,
+		MaxAllocatedStorage: 100,
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, int64(100), s.rds.MaxAllocatedStorage("default-app"))
+	s.rds.Advance(10 * time.Minute)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+	require.Equal(t, int64(100), s.sdk.database("app").Status.MaxAllocatedStorage)
+
+	// RDS grows the storage, not the operator.
+	metrics.SetFreeStorage("default-app", 0)
+	calls := s.rds.Calls("ModifyDBInstance")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, calls, s.rds.Calls("ModifyDBInstance"))
+
+	db = s.sdk.database("app")
+	db.Spec.StorageAutoscaling.MaxAllocatedStorage = 200
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, int64(200), s.rds.MaxAllocatedStorage("default-app"))
+
+	// Removing autoscaling caps the storage at the allocated storage.
+	db = s.sdk.database("app")
+	db.Spec.StorageAutoscaling = nil
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, int64(20), s.rds.MaxAllocatedStorage("default-app"))
+	require.Equal(t, int64(0), s.sdk.database("app").Status.MaxAllocatedStorage)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, calls+2, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestStorage_NativeFreeze(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.settle("app")
+	setFreeze(s, time.Now().Add(time.Hour), "")
+
+	db := s.sdk.database("app")
+	db.Spec.StorageAutoscaling = &v1alpha1.StorageAutoscaling{
+		Mode:                v1alpha1.StorageAutoscalingNative,
+		MaxAllocatedStorage: 100,
+	}
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, int64(0), s.rds.MaxAllocatedStorage("default-app"))
+
+	db = s.sdk.database("app")
+	require.Equal(t, int64(0), db.Status.MaxAllocatedStorage)
+	require.Len(t, db.Status.Deferred, 1)
+	require.Equal(t, "NativeStorage", db.Status.Deferred[0].Reason)
+	require.Contains(t, db.Status.Deferred[0].Input, `"MaxAllocatedStorage":100`)
+
+	setFreeze(s, time.Now().Add(-time.Minute), "")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, int64(100), s.rds.MaxAllocatedStorage("default-app"))
+	db = s.sdk.database("app")
+	require.Equal(t, int64(100), db.Status.MaxAllocatedStorage)
+	require.Empty(t, db.Status.Deferred)
+}
@@ -0,0 +1,222 @@
+package rds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/logging"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// TagOrphanedAt records when the sweeper first found an instance orphaned.
+const TagOrphanedAt = "rds.aws.com/orphaned-at"
+
+// SweeperConfig configures the orphan sweeper.
+type SweeperConfig struct {
+	// ClusterID must match the cluster ownership tag of swept instances.
+	ClusterID string
+	// Namespace limits sweeping to instances of one namespace, empty sweeps
+	// all namespaces.
+	Namespace string
+	// Interval between sweeps.
+	Interval time.Duration
+	// DeleteAfter deletes orphans, with a final snapshot, once they have
+	// been orphaned this long. Zero only reports orphans.
+	DeleteAfter time.Duration
+	// DryRun reports orphans without tagging or deleting them.
+	DryRun bool
+}
+
+// Sweeper finds RDS instances carrying the operator's ownership tags whose
+// Database no longer exists, for example because it was deleted while the
+// operator was down or the deletion failed.
+type Sweeper struct {
+	rds   rdsiface.RDSAPI
+	sdk   SDK
+	cfg   SweeperConfig
+	clock clock.Clock
+}
+
+// NewSweeper returns a sweeper sharing the handler's clients.
+func NewSweeper(handler *Handler, cfg SweeperConfig) *Sweeper {
+	return &Sweeper{rds: handler.rds, sdk: handler.sdk, cfg: cfg, clock: clock.RealClock{}}
+}
+
+// Run sweeps every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) {
+	log.WithField("interval", s.cfg.Interval).
+		WithField("deleteAfter", s.cfg.DeleteAfter).
+		Info("starting orphan sweeper")
+
+	for {
+		if err := s.Sweep(); err != nil {
+			log.WithError(err).Error("orphan sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(s.cfg.Interval):
+		}
+	}
+}
+
+// Sweep runs a single pass over all instances.
+func (s *Sweeper) Sweep() error {
+	var instances []*rds.DBInstance
+	err := s.rds.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{},
+		func(out *rds.DescribeDBInstancesOutput, last bool) bool {
+			instances = append(instances, out.DBInstances...)
+			return true
+		})
+	if err != nil {
+		return err
+	}
+
+	orphans := map[string]int{}
+	for _, db := range instances {
+		ns, orphaned, err := s.check(db)
+		if err != nil {
+			log.WithError(err).
+				WithField(logging.FieldIdentifier, aws.StringValue(db.DBInstanceIdentifier)).
+				Warn("failed to check instance")
+			continue
+		}
+		if orphaned {
+			orphans[ns]++
+		}
+	}
+
+	orphanedInstances.Reset()
+	for ns, count := range orphans {
+		orphanedInstances.WithLabelValues(ns).Set(float64(count))
+	}
+	return nil
+}
+
+// check reports whether an instance is an orphan, handling it if so.
+func (s *Sweeper) check(db *rds.DBInstance) (string, bool, error) {
+	id := aws.StringValue(db.DBInstanceIdentifier)
+	if aws.StringValue(db.DBInstanceStatus) == "deleting" {
+		return "", false, nil
+	}
+
+	out, err := s.rds.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: db.DBInstanceArn})
+	if err != nil {
+		return "", false, err
+	}
+	tags := map[string]string{}
+	for _, t := range out.TagList {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	// Instances without a cluster ID may belong to any operator sharing the
+	// account.
+	ns, name, cluster := tags[TagNamespace], tags[TagName], tags[TagClusterID]
+	if ns == "" || name == "" || cluster == "" || cluster != s.cfg.ClusterID {
+		return "", false, nil
+	}
+	if s.cfg.Namespace != "" && ns != s.cfg.Namespace {
+		return "", false, nil
+	}
+
+	logger := log.WithFields(log.Fields{
+		logging.FieldIdentifier: id,
+		logging.FieldNamespace:  ns,
+		logging.FieldDatabase:   name,
+	})
+
+	exists, err := s.exists(ns, name)
+	if err != nil {
+		return "", false, err
+	}
+	if exists {
+		var stale []*string
+		for _, k := range []string{TagOrphanedAt, TagRetained} {
+			if _, ok := tags[k]; ok {
+				stale = append(stale, str(k))
+			}
+		}
+		if len(stale) > 0 && !s.cfg.DryRun {
+			logger.Info("database exists again, clearing orphaned and retained tags")
+			_, err := s.rds.RemoveTagsFromResource(&rds.RemoveTagsFromResourceInput{
+				ResourceName: db.DBInstanceArn,
+				TagKeys:      stale,
+			})
+			return ns, false, err
+		}
+		return ns, false, nil
+	}
+	// Instances kept by the deletion policy or deletion protection are not
+	// orphans.
+	if tags[TagRetained] != "" {
+		return ns, false, nil
+	}
+
+	now := s.clock.Now()
+	orphanedAt, err := time.Parse(time.RFC3339, tags[TagOrphanedAt])
+	if err != nil {
+		logger.Warn("found orphaned instance")
+		orphanedAt = now
+		if !s.cfg.DryRun {
+			_, err := s.rds.AddTagsToResource(&rds.AddTagsToResourceInput{
+				ResourceName: db.DBInstanceArn,
+				Tags:         []*rds.Tag{{Key: str(TagOrphanedAt), Value: str(now.UTC().Format(time.RFC3339))}},
+			})
+			if err != nil {
+				return ns, true, err
+			}
+		}
+		recordEvent(s.sdk, databaseRef(ns, name), corev1.EventTypeWarning, "OrphanedInstance",
+			s.orphanMessage(id))
+	}
+
+	if s.cfg.DeleteAfter <= 0 || s.cfg.DryRun || now.Sub(orphanedAt) < s.cfg.DeleteAfter {
+		return ns, true, nil
+	}
+
+	snapshot := finalSnapshotName(id, now)
+	logger.WithField("snapshot", snapshot).Warn("deleting orphaned instance")
+	_, err = s.rds.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      db.DBInstanceIdentifier,
+		FinalDBSnapshotIdentifier: str(snapshot),
+	})
+	if err != nil {
+		return ns, true, err
+	}
+	orphanedInstancesDeleted.Inc()
+	recordEvent(s.sdk, databaseRef(ns, name), corev1.EventTypeWarning, "OrphanedInstanceDeleted",
+		fmt.Sprintf("Deleted orphaned RDS instance %s, final snapshot %s", id, snapshot))
+	return ns, false, nil
+}
+
+func (s *Sweeper) exists(namespace, name string) (bool, error) {
+	err := s.sdk.Get(&v1alpha1.Database{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Database",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	})
+	if k8errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Sweeper) orphanMessage(id string) string {
+	if s.cfg.DeleteAfter > 0 && !s.cfg.DryRun {
+		return fmt.Sprintf("RDS instance %s has no matching Database, it will be deleted with a final snapshot after %s",
+			id, s.cfg.DeleteAfter)
+	}
+	return fmt.Sprintf("RDS instance %s has no matching Database", id)
+}
@@ -0,0 +1,191 @@
+package rds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func sweeper(s *scenario, cfg SweeperConfig) *Sweeper {
+	sw := NewSweeper(s.h, cfg)
+	sw.clock = s.rds.Clock
+	return sw
+}
+
+func events(s *scenario, reason string) (out []*corev1.Event) {
+	for _, o := range s.sdk.list("Event") {
+		if e := o.(*corev1.Event); e.Reason == reason {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+const testCluster = "test"
+
+func createdScenario(t *testing.T, names ...string) *scenario {
+	return created(newScenario(t), names...)
+}
+
+// clusterScenario creates the databases with a cluster ID, the sweeper only
+// sweeps instances tagged with one.
+func clusterScenario(t *testing.T, names ...string) *scenario {
+	s := newScenario(t)
+	s.h.cfg.ClusterID = testCluster
+	return created(s, names...)
+}
+
+func created(s *scenario, names ...string) *scenario {
+	t := s.t
+	for _, name := range names {
+		s.apply(testDatabase(name))
+		require.NoError(t, s.sync(name))
+	}
+	s.rds.Advance(10 * time.Minute)
+	for _, name := range names {
+		require.NoError(t, s.sync(name))
+		require.Equal(t, v1alpha1.StateCreated, s.sdk.database(name).Status.State)
+	}
+	return s
+}
+
+func TestSweeper_ReportsAndDeletesOrphans(t *testing.T) {
+	s := clusterScenario(t, "kept", "gone")
+	sw := sweeper(s, SweeperConfig{ClusterID: testCluster, DeleteAfter: time.Hour})
+
+	// The database is removed while the operator is down.
+	s.sdk.delete(testDatabase("gone"))
+
+	require.NoError(t, sw.Sweep())
+	require.Contains(t, s.rds.Tags("default-gone"), TagOrphanedAt)
+	require.NotContains(t, s.rds.Tags("default-kept"), TagOrphanedAt)
+	require.Len(t, events(s, "OrphanedInstance"), 1)
+	require.Equal(t, "gone", events(s, "OrphanedInstance")[0].InvolvedObject.Name)
+
+	// Within the grace period orphans are only reported once.
+	s.rds.Advance(30 * time.Minute)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Len(t, events(s, "OrphanedInstance"), 1)
+
+	s.rds.Advance(31 * time.Minute)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 1, s.rds.Calls("DeleteDBInstance"))
+	require.Equal(t, fake.StatusDeleting, *s.rds.Instance("default-gone").DBInstanceStatus)
+	require.Equal(t, fake.StatusAvailable, *s.rds.Instance("default-kept").DBInstanceStatus)
+	require.Len(t, events(s, "OrphanedInstanceDeleted"), 1)
+
+	s.rds.Advance(10 * time.Minute)
+	snaps, err := s.rds.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{DBInstanceIdentifier: str("default-gone")})
+	require.NoError(t, err)
+	require.Len(t, snaps.DBSnapshots, 1)
+}
+
+func TestSweeper_ReportOnly(t *testing.T) {
+	s := clusterScenario(t, "gone")
+	sw := sweeper(s, SweeperConfig{ClusterID: testCluster})
+	s.sdk.delete(testDatabase("gone"))
+
+	require.NoError(t, sw.Sweep())
+	s.rds.Advance(365 * 24 * time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Len(t, events(s, "OrphanedInstance"), 1)
+}
+
+func TestSweeper_DryRun(t *testing.T) {
+	s := clusterScenario(t, "gone")
+	sw := sweeper(s, SweeperConfig{ClusterID: testCluster, DeleteAfter: time.Minute, DryRun: true})
+	s.sdk.delete(testDatabase("gone"))
+
+	require.NoError(t, sw.Sweep())
+	s.rds.Advance(time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.Equal(t, 0, s.rds.Calls("AddTagsToResource"))
+}
+
+func TestSweeper_RecreatedDatabase(t *testing.T) {
+	s := clusterScenario(t, "app")
+	sw := sweeper(s, SweeperConfig{ClusterID: testCluster, DeleteAfter: time.Hour})
+	db := s.sdk.database("app")
+	s.sdk.delete(db)
+
+	require.NoError(t, sw.Sweep())
+	require.Contains(t, s.rds.Tags("default-app"), TagOrphanedAt)
+
+	s.apply(db)
+	require.NoError(t, sw.Sweep())
+	require.NotContains(t, s.rds.Tags("default-app"), TagOrphanedAt)
+
+	s.rds.Advance(2 * time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+}
+
+func TestSweeper_RetainedInstances(t *testing.T) {
+	s := clusterScenario(t, "retained", "protected")
+	sw := sweeper(s, SweeperConfig{ClusterID: testCluster, DeleteAfter: time.Minute})
+
+	db := s.sdk.database("retained")
+	db.Spec.DeletionPolicy = v1alpha1.DeletionPolicyRetain
+	s.apply(db)
+	require.NoError(t, s.remove("retained"))
+	s.sdk.delete(db)
+	require.Equal(t, retainedByPolicy, s.rds.Tags("default-retained")[TagRetained])
+
+	db = s.sdk.database("protected")
+	db.Spec.DeletionProtection = true
+	s.apply(db)
+	s.settle("protected")
+	require.NoError(t, s.remove("protected"))
+	s.sdk.delete(db)
+	require.Equal(t, retainedByProtection, s.rds.Tags("default-protected")[TagRetained])
+
+	require.NoError(t, sw.Sweep())
+	s.rds.Advance(time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+	require.NotContains(t, s.rds.Tags("default-retained"), TagOrphanedAt)
+	require.NotContains(t, s.rds.Tags("default-protected"), TagOrphanedAt)
+	require.Empty(t, events(s, "OrphanedInstance"))
+
+	// A recreated database clears the retained tag.
+	s.apply(testDatabase("retained"))
+	require.NoError(t, sw.Sweep())
+	require.NotContains(t, s.rds.Tags("default-retained"), TagRetained)
+}
+
+func TestSweeper_IgnoresOtherClusters(t *testing.T) {
+	s := clusterScenario(t, "app")
+	s.sdk.delete(testDatabase("app"))
+
+	sw := sweeper(s, SweeperConfig{ClusterID: "other", DeleteAfter: time.Minute})
+	require.NoError(t, sw.Sweep())
+	s.rds.Advance(time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.NotContains(t, s.rds.Tags("default-app"), TagOrphanedAt)
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+
+	sw = sweeper(s, SweeperConfig{ClusterID: testCluster, Namespace: "other", DeleteAfter: time.Minute})
+	require.NoError(t, sw.Sweep())
+	require.NotContains(t, s.rds.Tags("default-app"), TagOrphanedAt)
+}
+
+func TestSweeper_IgnoresInstancesWithoutCluster(t *testing.T) {
+	s := createdScenario(t, "app")
+	s.sdk.delete(testDatabase("app"))
+
+	// Without a cluster ID instances of other operators cannot be told apart.
+	sw := sweeper(s, SweeperConfig{DeleteAfter: time.Minute})
+	require.NoError(t, sw.Sweep())
+	s.rds.Advance(time.Hour)
+	require.NoError(t, sw.Sweep())
+	require.NotContains(t, s.rds.Tags("default-app"), TagOrphanedAt)
+	require.Equal(t, 0, s.rds.Calls("DeleteDBInstance"))
+}
@@ -0,0 +1,164 @@
+package rds
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/version"
+)
+
+// Ownership tags stamped on every instance created by the operator.
+const (
+	TagClusterID       = "rds.aws.com/cluster-id"
+	TagNamespace       = "rds.aws.com/namespace"
+	TagName            = "rds.aws.com/name"
+	TagOperatorVersion = "rds.aws.com/operator-version"
+)
+
+// TagRetained marks an instance kept when its Database was deleted, the
+// value is the reason: deletion-policy or deletion-protection. The orphan
+// sweeper leaves retained instances alone.
+const TagRetained = "rds.aws.com/retained"
+
+// Reasons recorded by TagRetained.
+const (
+	retainedByPolicy     = "deletion-policy"
+	retainedByProtection = "deletion-protection"
+)
+
+// RDS tag limits.
+const (
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// tags returns the tags the instance should carry. Default tags are
+// overridden by configured labels, then by configured annotations, then by
+// spec.tags, ownership tags always win.
+func (h *Handler) tags(o *v1alpha1.Database) map[string]string {
+	tags := map[string]string{}
+	for k, v := range h.cfg.DefaultTags {
+		tags[k] = v
+	}
+	for _, k := range h.cfg.TagLabels {
+		if v, ok := o.Labels[k]; ok {
+			tags[k] = v
+		}
+	}
+	for _, k := range h.cfg.TagAnnotations {
+		if v, ok := o.Annotations[k]; ok {
+			tags[k] = v
+		}
+	}
+	for k, v := range o.Spec.Tags {
+		tags[k] = v
+	}
+
+	for k, v := range tags {
+		if !validTag(k, v) {
+			h.logger(o).WithField("tag", k).Warn("skipping invalid tag")
+			delete(tags, k)
+		}
+	}
+
+	if h.cfg.ClusterID != "" {
+		tags[TagClusterID] = h.cfg.ClusterID
+	}
+	tags[TagNamespace] = o.Namespace
+	tags[TagName] = o.Name
+	tags[TagOperatorVersion] = version.Version
+	return tags
+}
+
+func validTag(k, v string) bool {
+	return k != "" && len(k) <= maxTagKeyLength && len(v) <= maxTagValueLength &&
+		!strings.HasPrefix(strings.ToLower(k), "aws:")
+}
+
+// syncTags brings the instance tags in line with the desired tags. Only tags
+// previously applied by the operator are removed, tags added outside the
+// operator are left alone. The applied tags are recorded in the status so the
+// AWS calls are skipped when nothing changed.
+func (h *Handler) syncTags(o *v1alpha1.Database) error {
+	desired := h.tags(o)
+	if reflect.DeepEqual(desired, o.Status.Tags) {
+		return nil
+	}
+
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return err
+	}
+	arn := db.DBInstanceArn
+
+	out, err := h.rds.ListTagsForResource(&rds.ListTagsForResourceInput{ResourceName: arn})
+	if err != nil {
+		return err
+	}
+	add, remove := tagChanges(desired, o.Status.Tags, out.TagList)
+
+	h.logger(o).
+		WithField("add", len(add)).
+		WithField("remove", len(remove)).
+		Debug("syncing tags")
+
+	if len(add) > 0 {
+		_, err := h.rds.AddTagsToResource(&rds.AddTagsToResourceInput{ResourceName: arn, Tags: add})
+		if err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		_, err := h.rds.RemoveTagsFromResource(&rds.RemoveTagsFromResourceInput{ResourceName: arn, TagKeys: remove})
+		if err != nil {
+			return err
+		}
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.Tags = desired
+	return h.sdk.Update(copy)
+}
+
+// tagChanges returns the tags to add or overwrite and the keys to remove.
+func tagChanges(desired, applied map[string]string, current []*rds.Tag) (add []*rds.Tag, remove []*string) {
+	actual := map[string]string{}
+	for _, t := range current {
+		actual[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	for _, t := range tagList(desired) {
+		if v, ok := actual[*t.Key]; !ok || v != *t.Value {
+			add = append(add, t)
+		}
+	}
+	for _, k := range sortedKeys(applied) {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+		if _, ok := actual[k]; ok {
+			remove = append(remove, str(k))
+		}
+	}
+	return add, remove
+}
+
+func tagList(tags map[string]string) (out []*rds.Tag) {
+	for _, k := range sortedKeys(tags) {
+		out = append(out, &rds.Tag{Key: str(k), Value: aws.String(tags[k])})
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
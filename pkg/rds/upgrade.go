@@ -0,0 +1,324 @@
+package rds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/naming"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// deferEngineUpgrade is the reason recorded for upgrades deferred by a change
+// freeze.
+const deferEngineUpgrade = "EngineUpgrade"
+
+// upgradePlan is a validated engine version upgrade.
+type upgradePlan struct {
+	version        string
+	major          bool
+	parameterGroup string
+}
+
+// upgradeEngine moves the instance to spec.engineVersion: the target is
+// validated against the engine's upgrade targets, a snapshot is taken and
+// the upgrade is applied. If the upgrade fails after it was started the
+// snapshot is restored into a new instance to fall back to. Each step is
+// recorded in status.upgrade, handled is false when there is nothing to do.
+func (h *Handler) upgradeEngine(o *v1alpha1.Database) (handled bool, err error) {
+	target := o.Spec.EngineVersion
+	u := o.Status.Upgrade
+	running := u != nil && (u.Phase == v1alpha1.UpgradePhaseSnapshotting || u.Phase == v1alpha1.UpgradePhaseUpgrading)
+	if !running {
+		if target == "" || sameVersion(target, o.Status.EngineVersion) ||
+			minorUpgraded(o.Spec, o.Status.EngineVersion) {
+			return false, nil
+		}
+		if u != nil && u.Phase == v1alpha1.UpgradePhaseFailed && sameVersion(target, u.ToVersion) {
+			return false, nil
+		}
+	}
+
+	db, err := h.getDB(o)
+	if err != nil || db == nil {
+		return true, err
+	}
+	if aws.StringValue(db.DBInstanceStatus) != "available" {
+		return true, nil
+	}
+
+	switch {
+	case !running:
+		return true, h.startUpgrade(o, db)
+	case u.Phase == v1alpha1.UpgradePhaseSnapshotting:
+		return true, h.applyUpgrade(o, db)
+	default:
+		return true, h.finishUpgrade(o, db)
+	}
+}
+
+func (h *Handler) startUpgrade(o *v1alpha1.Database, db *rds.DBInstance) error {
+	current, target := aws.StringValue(db.EngineVersion), o.Spec.EngineVersion
+	if sameVersion(target, current) || minorUpgraded(o.Spec, current) {
+		if !sameVersion(target, current) {
+			h.logger(o).WithField("version", current).Info("instance received an automatic minor upgrade")
+		}
+		copy := o.DeepCopy()
+		copy.Status.EngineVersion = current
+		return h.sdk.Update(copy)
+	}
+
+	u := &v1alpha1.UpgradeStatus{FromVersion: current, ToVersion: target}
+	plan, err := h.validateUpgrade(db, target)
+	if err != nil {
+		if isTransient(err) {
+			return err
+		}
+		return h.upgradeFailed(o, u, err.Error())
+	}
+
+	u.Phase = v1alpha1.UpgradePhaseSnapshotting
+	u.ToVersion = plan.version
+	u.Snapshot = upgradeSnapshotName(aws.StringValue(db.DBInstanceIdentifier), plan.version, time.Now())
+	h.logger(o).
+		WithField("from", current).
+		WithField("to", plan.version).
+		WithField("snapshot", u.Snapshot).
+		Info("starting engine upgrade")
+
+	_, err = h.rds.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: db.DBInstanceIdentifier,
+		DBSnapshotIdentifier: str(u.Snapshot),
+	})
+	if err != nil {
+		return err
+	}
+	return h.setUpgrade(o, u)
+}
+
+func (h *Handler) applyUpgrade(o *v1alpha1.Database, db *rds.DBInstance) error {
+	u := o.Status.Upgrade.DeepCopy()
+
+	if ok, err := h.snapshotAvailable(u.Snapshot); !ok || err != nil {
+		return err
+	}
+
+	plan, err := h.validateUpgrade(db, u.ToVersion)
+	if err != nil {
+		if isTransient(err) {
+			return err
+		}
+		return h.upgradeFailed(o, u, err.Error())
+	}
+
+	deferred, err := h.modify(o, deferEngineUpgrade, upgradeInput(db, plan))
+	if isTransient(err) {
+		return err
+	} else if err != nil {
+		return h.upgradeFailed(o, u, err.Error())
+	}
+
+	copy := o.DeepCopy()
+	copy.Status.Deferred = setDeferred(o.Status.Deferred, deferEngineUpgrade, deferred)
+	if deferred == nil {
+		u.Phase = v1alpha1.UpgradePhaseUpgrading
+	} else if sameDeferred(copy.Status.Deferred, o.Status.Deferred) {
+		return nil
+	}
+	copy.Status.Upgrade = u
+	return h.sdk.Update(copy)
+}
+
+func (h *Handler) finishUpgrade(o *v1alpha1.Database, db *rds.DBInstance) error {
+	if p := db.PendingModifiedValues; p != nil && p.EngineVersion != nil {
+		return nil
+	}
+	u := o.Status.Upgrade.DeepCopy()
+
+	if actual := aws.StringValue(db.EngineVersion); !sameVersion(u.ToVersion, actual) {
+		u.RestoredInstance = naming.Suffix(aws.StringValue(db.DBInstanceIdentifier), "-restored")
+		_, err := h.rds.RestoreDBInstanceFromDBSnapshot(&rds.RestoreDBInstanceFromDBSnapshotInput{
+			DBInstanceIdentifier: str(u.RestoredInstance),
+			DBSnapshotIdentifier: str(u.Snapshot),
+			DBInstanceClass:      db.DBInstanceClass,
+			DBSubnetGroupName:    str(o.Spec.SubnetGroup),
+			MultiAZ:              db.MultiAZ,
+		})
+		if err != nil && !isAlreadyExists(err) {
+			return err
+		}
+		return h.upgradeFailed(o, u, fmt.Sprintf(
+			"instance is on %s after the upgrade, snapshot %s is being restored into instance %s. "+
+				"Check the RDS events of %s, then point clients at %s or set spec.engineVersion back to %s",
+			actual, u.Snapshot, u.RestoredInstance, aws.StringValue(db.DBInstanceIdentifier),
+			u.RestoredInstance, actual))
+	}
+
+	h.logger(o).WithField("version", u.ToVersion).Info("engine upgrade completed")
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeNormal, "UpgradeCompleted",
+		fmt.Sprintf("Upgraded engine from %s to %s", u.FromVersion, u.ToVersion))
+
+	u.Phase = v1alpha1.UpgradePhaseCompleted
+	copy := o.DeepCopy()
+	copy.Status.Upgrade = u
+	copy.Status.EngineVersion = u.ToVersion
+	return h.sdk.Update(copy)
+}
+
+// sameVersion reports whether the instance runs the declared engine version.
+// A partial version like 9.6 matches any 9.6.x release.
+func sameVersion(declared, actual string) bool {
+	return actual == declared || strings.HasPrefix(actual, declared+".")
+}
+
+// minorUpgraded reports whether RDS moved the instance past the declared
+// version with an automatic minor upgrade. Minor upgrades only change the
+// last component of the version, 10.4 to 10.5 or 9.6.9 to 9.6.10.
+func minorUpgraded(spec v1alpha1.DatabaseSpec, actual string) bool {
+	declared := spec.EngineVersion
+	if !spec.AutoMinorVersionUpgrade || declared == "" || !newerVersion(actual, declared) {
+		return false
+	}
+	ds, as := strings.Split(declared, "."), strings.Split(actual, ".")
+	if len(ds) != len(as) {
+		return false
+	}
+	return strings.Join(ds[:len(ds)-1], ".") == strings.Join(as[:len(as)-1], ".")
+}
+
+func upgradeInput(db *rds.DBInstance, plan upgradePlan) *rds.ModifyDBInstanceInput {
+	return &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier:     db.DBInstanceIdentifier,
+		EngineVersion:            str(plan.version),
+		AllowMajorVersionUpgrade: aws.Bool(plan.major),
+		ApplyImmediately:         aws.Bool(true),
+		DBParameterGroupName:     str(plan.parameterGroup),
+	}
+}
+
+// newerVersion reports whether version a is newer than version b. Components
+// are compared as numbers, so 10.10 is newer than 10.9.
+func newerVersion(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(as[i])
+		y, errY := strconv.Atoi(bs[i])
+		if errX != nil || errY != nil {
+			return as[i] > bs[i]
+		}
+		return x > y
+	}
+	return len(as) > len(bs)
+}
+
+// validateUpgrade checks the target is a valid upgrade target of the current
+// version. A partial target like 11 resolves to the newest 11.x upgrade
+// target, the plan holds the version to upgrade to. Major upgrades need a parameter group of the new family, default
+// groups are switched to the new family's default, custom groups must
+// already be of the new family.
+func (h *Handler) validateUpgrade(db *rds.DBInstance, target string) (upgradePlan, error) {
+	engine, current := aws.StringValue(db.Engine), aws.StringValue(db.EngineVersion)
+
+	out, err := h.rds.DescribeDBEngineVersions(&rds.DescribeDBEngineVersionsInput{
+		Engine:        db.Engine,
+		EngineVersion: db.EngineVersion,
+	})
+	if err != nil {
+		return upgradePlan{}, err
+	}
+	var valid *rds.UpgradeTarget
+	for _, v := range out.DBEngineVersions {
+		for _, t := range v.ValidUpgradeTarget {
+			version := aws.StringValue(t.EngineVersion)
+			if sameVersion(target, version) &&
+				(valid == nil || newerVersion(version, aws.StringValue(valid.EngineVersion))) {
+				valid = t
+			}
+		}
+	}
+	if valid == nil {
+		return upgradePlan{}, fmt.Errorf("%s is not a valid upgrade target for %s %s", target, engine, current)
+	}
+
+	plan := upgradePlan{
+		version: aws.StringValue(valid.EngineVersion),
+		major:   aws.BoolValue(valid.IsMajorVersionUpgrade),
+	}
+	if !plan.major || len(db.DBParameterGroups) == 0 {
+		return plan, nil
+	}
+
+	out, err = h.rds.DescribeDBEngineVersions(&rds.DescribeDBEngineVersionsInput{
+		Engine:        db.Engine,
+		EngineVersion: str(plan.version),
+	})
+	if err != nil {
+		return upgradePlan{}, err
+	}
+	if len(out.DBEngineVersions) == 0 {
+		return upgradePlan{}, fmt.Errorf("engine version %s %s not found", engine, plan.version)
+	}
+	family := aws.StringValue(out.DBEngineVersions[0].DBParameterGroupFamily)
+
+	group := aws.StringValue(db.DBParameterGroups[0].DBParameterGroupName)
+	if strings.HasPrefix(group, "default.") {
+		plan.parameterGroup = "default." + family
+		return plan, nil
+	}
+	groups, err := h.rds.DescribeDBParameterGroups(&rds.DescribeDBParameterGroupsInput{
+		DBParameterGroupName: str(group),
+	})
+	if err != nil {
+		return upgradePlan{}, err
+	}
+	if len(groups.DBParameterGroups) == 0 ||
+		aws.StringValue(groups.DBParameterGroups[0].DBParameterGroupFamily) != family {
+		return upgradePlan{}, fmt.Errorf("parameter group %s is not of family %s required by %s %s",
+			group, family, engine, plan.version)
+	}
+	return plan, nil
+}
+
+func (h *Handler) upgradeFailed(o *v1alpha1.Database, u *v1alpha1.UpgradeStatus, msg string) error {
+	h.logger(o).WithField("to", u.ToVersion).Warn("engine upgrade failed: " + msg)
+	recordEvent(h.sdk, databaseRef(o.Namespace, o.Name), corev1.EventTypeWarning, "UpgradeFailed",
+		fmt.Sprintf("Upgrade to %s failed: %s", u.ToVersion, msg))
+
+	u.Phase = v1alpha1.UpgradePhaseFailed
+	u.Message = msg
+	return h.setUpgrade(o, u)
+}
+
+func (h *Handler) setUpgrade(o *v1alpha1.Database, u *v1alpha1.UpgradeStatus) error {
+	h.logger(o).WithField("phase", u.Phase).Debug("set upgrade status")
+
+	copy := o.DeepCopy()
+	copy.Status.Upgrade = u
+	return h.sdk.Update(copy)
+}
+
+// snapshotAvailable reports whether the snapshot finished creating.
+func (h *Handler) snapshotAvailable(id string) (bool, error) {
+	out, err := h.rds.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{DBSnapshotIdentifier: str(id)})
+	if err != nil {
+		return false, err
+	}
+	return len(out.DBSnapshots) > 0 && aws.StringValue(out.DBSnapshots[0].Status) == "available", nil
+}
+
+// upgradeSnapshotName returns e.g. default-app-pre-upgrade-11-1-20181020150405,
+// snapshot identifiers may not contain dots.
+func upgradeSnapshotName(id, version string, now time.Time) string {
+	return upgradeSnapshotPrefix(id, version) + now.UTC().Format("20060102150405")
+}
+
+func upgradeSnapshotPrefix(id, version string) string {
+	return fmt.Sprintf("%s-pre-upgrade-%s-", id, strings.Replace(version, ".", "-", -1))
+}
@@ -0,0 +1,239 @@
+package rds
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/coldog/rds-operator/pkg/naming"
+	"github.com/coldog/rds-operator/pkg/rds/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func upgradeScenario(t *testing.T, version string) *scenario {
+	s := createdScenario(t, "app")
+	s.settle("app")
+
+	db := s.sdk.database("app")
+	db.Spec.EngineVersion = version
+	s.apply(db)
+	return s
+}
+
+func upgradeStatus(s *scenario) *v1alpha1.UpgradeStatus {
+	return s.sdk.database("app").Status.Upgrade
+}
+
+func TestUpgrade_Major(t *testing.T) {
+	s := upgradeScenario(t, "11.1")
+
+	require.NoError(t, s.sync("app"))
+	u := upgradeStatus(s)
+	require.Equal(t, v1alpha1.UpgradePhaseSnapshotting, u.Phase)
+	require.Equal(t, "10.4", u.FromVersion)
+	require.Equal(t, fake.StatusCreating, *s.rds.Snapshot(u.Snapshot).Status)
+
+	// The upgrade waits for the snapshot.
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.UpgradePhaseUpgrading, upgradeStatus(s).Phase)
+	require.Equal(t, fake.StatusUpgrading, *s.rds.Instance("default-app").DBInstanceStatus)
+
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+	db := s.sdk.database("app")
+	require.Equal(t, v1alpha1.UpgradePhaseCompleted, db.Status.Upgrade.Phase)
+	require.Equal(t, "11.1", db.Status.EngineVersion)
+	require.Equal(t, "11.1", *s.rds.Instance("default-app").EngineVersion)
+	require.Len(t, events(s, "UpgradeCompleted"), 1)
+
+	// Nothing left to do.
+	describes := s.rds.Calls("DescribeDBInstances")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, describes, s.rds.Calls("DescribeDBInstances"))
+}
+
+func TestUpgrade_PartialVersion(t *testing.T) {
+	s := upgradeScenario(t, "10")
+	s.h.cfg.DriftPolicy = v1alpha1.DriftPolicyReport
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+	db := s.sdk.database("app")
+	require.Nil(t, db.Status.Upgrade)
+	require.Empty(t, db.Status.Drift)
+	require.Len(t, db.Status.Conditions, 1)
+	require.Equal(t, "InSync", db.Status.Conditions[0].Reason)
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+	require.Equal(t, 0, s.rds.Calls("ModifyDBInstance"))
+
+	// Prefixes only match whole version components.
+	db.Spec.EngineVersion = "10.40"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.UpgradePhaseFailed, upgradeStatus(s).Phase)
+}
+
+func TestUpgrade_PartialTarget(t *testing.T) {
+	s := upgradeScenario(t, "11")
+	s.rds.AddEngineVersion("postgres", "11.2", "postgres11")
+	s.rds.AddEngineVersion("postgres", "10.4", "postgres10", "10.5", "11.2", "11.1")
+
+	require.NoError(t, s.sync("app"))
+	u := upgradeStatus(s)
+	require.Equal(t, v1alpha1.UpgradePhaseSnapshotting, u.Phase)
+	require.Equal(t, "11.2", u.ToVersion)
+	require.Contains(t, u.Snapshot, "default-app-pre-upgrade-11-2-")
+
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, v1alpha1.UpgradePhaseUpgrading, upgradeStatus(s).Phase)
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+
+	db := s.sdk.database("app")
+	require.Equal(t, v1alpha1.UpgradePhaseCompleted, db.Status.Upgrade.Phase)
+	require.Equal(t, "11.2", db.Status.EngineVersion)
+	require.Equal(t, "11.2", *s.rds.Instance("default-app").EngineVersion)
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+}
+
+func TestUpgrade_AutoMinorUpgrade(t *testing.T) {
+	s := newScenario(t)
+	db := testDatabase("app")
+	db.Spec.EngineVersion = "10.4"
+	db.Spec.AutoMinorVersionUpgrade = true
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(10 * time.Minute)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+	setDriftPolicy(s, "app", v1alpha1.DriftPolicyRevert)
+	require.Equal(t, "10.4", s.sdk.database("app").Status.EngineVersion)
+
+	// RDS applies a minor upgrade in the maintenance window.
+	_, err := s.rds.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("default-app"),
+		EngineVersion:        aws.String("10.5"),
+		ApplyImmediately:     aws.Bool(true),
+	})
+	require.NoError(t, err)
+	s.rds.Advance(10 * time.Minute)
+	modifies := s.rds.Calls("ModifyDBInstance")
+
+	s.h.forgetChecks(s.sdk.database("app"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.sync("app"))
+	}
+	db = s.sdk.database("app")
+	require.Equal(t, "10.5", db.Status.EngineVersion)
+	require.Nil(t, db.Status.Upgrade)
+	require.Empty(t, db.Status.Drift)
+	require.Equal(t, modifies, s.rds.Calls("ModifyDBInstance"))
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+
+	// Major versions still need the upgrade workflow.
+	require.False(t, minorUpgraded(db.Spec, "11.1"))
+}
+
+func TestUpgrade_InvalidTarget(t *testing.T) {
+	s := upgradeScenario(t, "9.6.9")
+
+	require.NoError(t, s.sync("app"))
+	u := upgradeStatus(s)
+	require.Equal(t, v1alpha1.UpgradePhaseFailed, u.Phase)
+	require.Contains(t, u.Message, "9.6.9 is not a valid upgrade target for postgres 10.4")
+	require.Equal(t, 0, s.rds.Calls("CreateDBSnapshot"))
+	require.Len(t, events(s, "UpgradeFailed"), 1)
+
+	// The failed target is not retried.
+	describes := s.rds.Calls("DescribeDBEngineVersions")
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, describes, s.rds.Calls("DescribeDBEngineVersions"))
+}
+
+func TestUpgrade_ParameterGroupFamily(t *testing.T) {
+	s := createdScenario(t, "app")
+	_, err := s.rds.CreateDBParameterGroup(&rds.CreateDBParameterGroupInput{
+		DBParameterGroupName:   aws.String("custom"),
+		DBParameterGroupFamily: aws.String("postgres10"),
+		Description:            aws.String("custom"),
+	})
+	require.NoError(t, err)
+	_, err = s.rds.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String("default-app"),
+		DBParameterGroupName: aws.String("custom"),
+	})
+	require.NoError(t, err)
+
+	s.settle("app")
+	db := s.sdk.database("app")
+	db.Spec.EngineVersion = "11.1"
+	s.apply(db)
+
+	require.NoError(t, s.sync("app"))
+	u := upgradeStatus(s)
+	require.Equal(t, v1alpha1.UpgradePhaseFailed, u.Phase)
+	require.Contains(t, u.Message, "parameter group custom is not of family postgres11")
+}
+
+func TestUpgrade_RestoresLongIdentifier(t *testing.T) {
+	name := strings.Repeat("a", 55)
+	s := createdScenario(t, name)
+	s.settle(name)
+	id := s.sdk.database(name).Status.InstanceIdentifier
+	require.Len(t, id, naming.MaxLength)
+
+	db := s.sdk.database(name)
+	db.Spec.EngineVersion = "11.1"
+	s.apply(db)
+	s.rds.FailUpgrade(id)
+	require.NoError(t, s.sync(name))
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync(name))
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync(name))
+
+	u := s.sdk.database(name).Status.Upgrade
+	require.Equal(t, v1alpha1.UpgradePhaseFailed, u.Phase)
+	require.Equal(t, naming.Suffix(id, "-restored"), u.RestoredInstance)
+	require.NotNil(t, s.rds.Instance(u.RestoredInstance))
+}
+
+func TestUpgrade_FailureRestoresSnapshot(t *testing.T) {
+	s := upgradeScenario(t, "11.1")
+	s.rds.FailUpgrade("default-app")
+
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(time.Minute)
+	require.NoError(t, s.sync("app"))
+	s.rds.Advance(5 * time.Minute)
+	require.NoError(t, s.sync("app"))
+
+	u := upgradeStatus(s)
+	require.Equal(t, v1alpha1.UpgradePhaseFailed, u.Phase)
+	require.Equal(t, "default-app-restored", u.RestoredInstance)
+	require.Contains(t, u.Message, "set spec.engineVersion back to 10.4")
+	require.Equal(t, "10.4", *s.rds.Instance("default-app").EngineVersion)
+
+	restored := s.rds.Instance("default-app-restored")
+	require.NotNil(t, restored)
+	require.Equal(t, "10.4", *restored.EngineVersion)
+	require.Len(t, events(s, "UpgradeFailed"), 1)
+
+	// Reverting the spec clears the pending upgrade.
+	db := s.sdk.database("app")
+	db.Spec.EngineVersion = "10.4"
+	s.apply(db)
+	require.NoError(t, s.sync("app"))
+	require.Equal(t, "10.4", s.sdk.database("app").Status.EngineVersion)
+	require.Equal(t, 1, s.rds.Calls("ModifyDBInstance"))
+}
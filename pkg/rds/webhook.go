@@ -0,0 +1,156 @@
+package rds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// WebhookPath is the path the validating admission webhook is served on.
+const WebhookPath = "/validate"
+
+// admissionReview is the part of an admission.k8s.io/v1beta1 AdmissionReview
+// the webhook uses, the vendored k8s.io/api does not include the admission
+// types.
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *admissionRequest  `json:"request,omitempty"`
+	Response        *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       types.UID               `json:"uid"`
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Namespace string                  `json:"namespace,omitempty"`
+	Operation string                  `json:"operation"`
+	Object    runtime.RawExtension    `json:"object,omitempty"`
+	OldObject runtime.RawExtension    `json:"oldObject,omitempty"`
+}
+
+type admissionResponse struct {
+	UID     types.UID      `json:"uid"`
+	Allowed bool           `json:"allowed"`
+	Result  *metav1.Status `json:"result,omitempty"`
+}
+
+// Webhook is a validating admission webhook rejecting new databases that
+// violate a policy and changes to invalid database specs. It checks the same
+// rules as the handler, which still holds databases admitted while the
+// webhook was unavailable.
+type Webhook struct {
+	r *Reconciler
+}
+
+// NewWebhook returns a webhook sharing the reconciler's handler, reviews
+// wait for the config to be replaced like syncs.
+func NewWebhook(r *Reconciler) *Webhook {
+	return &Webhook{r: r}
+}
+
+// Run serves the webhook with TLS on addr until ctx is done.
+func (w *Webhook) Run(ctx context.Context, addr, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.Handle(WebhookPath, w)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.WithField("addr", addr).Info("serving admission webhook")
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP answers an AdmissionReview.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var review admissionReview
+	if err := json.NewDecoder(req.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(rw, "expected an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	review.Response = w.review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(review)
+}
+
+func (w *Webhook) review(req *admissionRequest) *admissionResponse {
+	if req.Kind.Kind != "Database" {
+		return &admissionResponse{Allowed: true}
+	}
+	o := &v1alpha1.Database{}
+	if err := json.Unmarshal(req.Object.Raw, o); err != nil {
+		return deny(http.StatusBadRequest, fmt.Sprintf("invalid database: %v", err))
+	}
+	if o.Namespace == "" {
+		o.Namespace = req.Namespace
+	}
+
+	w.r.syncing.RLock()
+	defer w.r.syncing.RUnlock()
+	h := w.r.h
+	logger := h.logger(o).WithField("operation", req.Operation)
+
+	switch req.Operation {
+	case "CREATE":
+		// Classes that are missing or invalid hold the database, it is
+		// checked once the class is fixed.
+		class, err := h.class(o.Spec.ClassName)
+		if err != nil && !isClassError(err) {
+			logger.WithError(err).Warn("admitting database, failed reading class")
+			return &admissionResponse{Allowed: true}
+		}
+		if err == nil && class != nil && v1alpha1.ValidateClass(class) == nil {
+			v1alpha1.ApplyClass(o, class)
+		}
+		if err := v1alpha1.Validate(o); err != nil {
+			return deny(http.StatusUnprocessableEntity, "invalid database spec: "+err.Error())
+		}
+		err = h.checkPolicies(o)
+		if isPolicyError(err) {
+			logger.WithError(err).Info("rejecting database violating a policy")
+			return deny(http.StatusForbidden, err.Error())
+		}
+		if err != nil {
+			// The handler checks the policies again before creating the
+			// instance.
+			logger.WithError(err).Warn("admitting database, failed checking policies")
+		}
+	case "UPDATE":
+		old := &v1alpha1.Database{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return deny(http.StatusBadRequest, fmt.Sprintf("invalid database: %v", err))
+		}
+		// Status, metadata and deletions are never blocked. Policies do not
+		// apply to changes.
+		if o.DeletionTimestamp != nil || reflect.DeepEqual(o.Spec, old.Spec) {
+			break
+		}
+		if err := v1alpha1.Validate(o); err != nil {
+			return deny(http.StatusUnprocessableEntity, "invalid database spec: "+err.Error())
+		}
+	}
+	return &admissionResponse{Allowed: true}
+}
+
+func deny(code int32, msg string) *admissionResponse {
+	return &admissionResponse{Result: &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Message: msg,
+	}}
+}
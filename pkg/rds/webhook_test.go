@@ -0,0 +1,95 @@
+package rds
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coldog/rds-operator/pkg/apis/rds/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// admit sends an AdmissionReview for the database to the webhook.
+func admit(t *testing.T, w *Webhook, operation string, db, old *v1alpha1.Database) *admissionResponse {
+	raw := func(o *v1alpha1.Database) runtime.RawExtension {
+		if o == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(o)
+		require.NoError(t, err)
+		return runtime.RawExtension{Raw: data}
+	}
+	body, err := json.Marshal(admissionReview{Request: &admissionRequest{
+		UID:       "1",
+		Kind:      metav1.GroupVersionKind{Group: "rds.aws.com", Version: "v1alpha1", Kind: "Database"},
+		Namespace: "default",
+		Operation: operation,
+		Object:    raw(db),
+		OldObject: raw(old),
+	}})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("POST", WebhookPath, bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var review admissionReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &review))
+	require.Equal(t, "1", string(review.Response.UID))
+	return review.Response
+}
+
+func TestWebhook_Policies(t *testing.T) {
+	s := createdScenario(t, "one")
+	w := NewWebhook(NewReconciler(s.h, ReconcilerConfig{}))
+	require.NoError(t, s.sdk.Create(testPolicy("quota", v1alpha1.DatabasePolicySpec{
+		MaxInstances:    2,
+		InstanceClasses: []string{"db.t2.*"},
+	})))
+
+	db := testDatabase("two")
+	db.Spec.InstanceClass = "db.r5.24xlarge"
+	resp := admit(t, w, "CREATE", db, nil)
+	require.False(t, resp.Allowed)
+	require.Equal(t, int32(http.StatusForbidden), resp.Result.Code)
+	require.Equal(t, "instanceClass db.r5.24xlarge is not allowed by databasePolicy quota", resp.Result.Message)
+
+	require.True(t, admit(t, w, "CREATE", testDatabase("two"), nil).Allowed)
+	s.apply(testDatabase("two"))
+	resp = admit(t, w, "CREATE", testDatabase("three"), nil)
+	require.False(t, resp.Allowed)
+	require.Contains(t, resp.Result.Message, "would have 3 databases, 2 are allowed")
+
+	// Policies do not apply to changes.
+	changed := s.sdk.database("one")
+	changed.Spec.InstanceClass = "db.r5.large"
+	require.True(t, admit(t, w, "UPDATE", changed, s.sdk.database("one")).Allowed)
+}
+
+func TestWebhook_Validation(t *testing.T) {
+	s := createdScenario(t, "app")
+	w := NewWebhook(NewReconciler(s.h, ReconcilerConfig{}))
+
+	invalid := testDatabase("new")
+	invalid.Spec.DeletionPolicy = "Archive"
+	resp := admit(t, w, "CREATE", invalid, nil)
+	require.False(t, resp.Allowed)
+	require.Contains(t, resp.Result.Message, "invalid database spec")
+
+	old := s.sdk.database("app")
+	changed := old.DeepCopy()
+	changed.Spec.DeletionPolicy = "Archive"
+	require.False(t, admit(t, w, "UPDATE", changed, old).Allowed)
+
+	// Changes that leave the spec alone are not blocked.
+	old.Spec.DeletionPolicy = "Archive"
+	changed = old.DeepCopy()
+	changed.Annotations = map[string]string{"team": "payments"}
+	require.True(t, admit(t, w, "UPDATE", changed, old).Allowed)
+
+	// Valid databases are admitted.
+	require.True(t, admit(t, w, "CREATE", testDatabase("other"), nil).Allowed)
+}